@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// installedBinaryPath Ruta donde se copia este programa cuando una unidad
+// systemd necesita ejecutarlo: el servicio de cada impresora y el anuncio de IP.
+var installedBinaryPath = "/usr/local/sbin/escpos-socket-install"
+
+// Rutas de las unidades del anuncio de IP al arrancar.
+var (
+	announceServicePath = "/etc/systemd/system/escpos-printer-announce.service"
+	announceTimerPath   = "/etc/systemd/system/escpos-printer-announce.timer"
+)
+
+// announceWaitTimeout Tiempo máximo que el anuncio espera a que la impresora
+// esté disponible después del arranque.
+const announceWaitTimeout = 2 * time.Minute
+
+// announceServiceContent Unidad oneshot que imprime la IP de la máquina.
+func announceServiceContent(binaryPath string) string {
+	return fmt.Sprintf(`[Unit]
+Description=ESC/POS Printer boot announcement
+After=network-online.target sockets.target
+Wants=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=%s print-announce
+`, binaryPath)
+}
+
+// announceTimerContent Temporizador que lanza el anuncio poco después del arranque,
+// para dar tiempo a que DHCP asigne la dirección y la impresora se inicialice.
+const announceTimerContent = `[Unit]
+Description=ESC/POS Printer boot announcement
+
+[Timer]
+OnBootSec=30s
+
+[Install]
+WantedBy=timers.target
+`
+
+// copyExecutable Copia este programa a la ruta indicada con permisos de ejecución.
+func copyExecutable(dst string) error {
+	src, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf(tr("no se pudo determinar la ruta del programa: %w"), err)
+	}
+	if src == dst {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf(tr("error al leer %s: %w"), src, err)
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf(tr("error al crear %s: %w"), filepath.Dir(dst), err)
+	}
+	// Se escribe a un archivo temporal y se renombra para no dejar un
+	// binario a medias si la copia falla, ni tocar uno que esté en ejecución.
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf(tr("error al crear %s: %w"), tmp, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return fmt.Errorf(tr("error al copiar el programa a %s: %w"), dst, err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf(tr("error al copiar el programa a %s: %w"), dst, err)
+	}
+	return os.Rename(tmp, dst)
+}
+
+// announceFiles Devuelve las unidades del anuncio de IP al arrancar.
+func announceFiles() []plannedFile {
+	return []plannedFile{
+		{"servicio", announceServicePath, announceServiceContent(installedBinaryPath)},
+		{"temporizador", announceTimerPath, announceTimerContent},
+	}
+}
+
+// announceReceipt Construye el recibo con la IP de la máquina y el estado de
+// cada socket instalado.
+func announceReceipt(installs []installation) (*receipt, error) {
+	ips, err := hostIPv4s()
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	r := newReceipt().
+		align(alignCenter).bold(true).line("Impresora lista").bold(false).
+		line(hostname).feed(1).size(2, 2)
+	if len(ips) == 0 {
+		r.line("Sin IP")
+	}
+	for _, ip := range ips {
+		r.line(ip.String())
+	}
+	r.size(1, 1).feed(1)
+
+	for _, inst := range installs {
+		out, _ := systemctlCommand("is-active", inst.Name+".socket").Output()
+		state := strings.TrimSpace(string(out))
+		if state == "" {
+			state = "desconocido"
+		}
+		r.line(fmt.Sprintf("%s %s: %s", inst.Listen, inst.Device, state))
+	}
+	r.line(time.Now().Format("2006-01-02 15:04:05"))
+	return r.feed(3).cut(), nil
+}
+
+// runPrintAnnounce Implementa el subcomando "print-announce", que ejecuta la
+// unidad de anuncio al arrancar. Espera a que la primera impresora instalada
+// esté disponible y la usa para imprimir el estado de todas.
+func runPrintAnnounce(args []string) {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s print-announce\n"), filepath.Base(os.Args[0]))
+		os.Exit(2)
+	}
+
+	installs, err := readInstallations()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if len(installs) == 0 {
+		log.Fatalf(tr("Error: no se encontró ninguna instalación en %s"), unitDir)
+	}
+	device := installs[0].Device
+
+	deadline := time.Now().Add(announceWaitTimeout)
+	for probePrinter(device) != nil {
+		if time.Now().After(deadline) {
+			log.Fatalf(tr("Error: la impresora %s no está disponible"), device)
+		}
+		time.Sleep(2 * time.Second)
+	}
+
+	r, err := announceReceipt(installs)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := writeToDevice(device, r.Bytes()); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	logger.Info(fmt.Sprintf(tr("✓ Anuncio impreso en %s\n"), device))
+}
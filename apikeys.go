@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// httpKeysCredential Credencial de systemd con las claves de la API HTTP.
+const httpKeysCredential = "http-api-keys"
+
+// minAPIKeyLength Longitud mínima de una clave, para que no se pueda adivinar
+// probando.
+const minAPIKeyLength = 16
+
+// apiKey Clave de un cliente de la API HTTP.
+type apiKey struct {
+	Client string // Nombre del cliente en el registro, por ejemplo caja-1
+	Token  string
+}
+
+// loadAPIKeys Lee el archivo de claves: una línea "CLIENTE CLAVE" por
+// terminal, con líneas vacías y comentarios con # permitidos.
+func loadAPIKeys(path string) ([]apiKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf(tr("error al leer las claves de la API: %w"), err)
+	}
+	defer f.Close()
+
+	var keys []apiKey
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf(tr("%s:%d: se esperaba \"CLIENTE CLAVE\""), path, n)
+		}
+		key := apiKey{Client: fields[0], Token: fields[1]}
+		if len(key.Token) < minAPIKeyLength {
+			return nil, fmt.Errorf(tr("%s:%d: la clave de %s tiene menos de %d caracteres"), path, n, key.Client, minAPIKeyLength)
+		}
+		if seen[key.Token] {
+			return nil, fmt.Errorf(tr("%s:%d: la clave de %s está repetida"), path, n, key.Client)
+		}
+		seen[key.Token] = true
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf(tr("error al leer las claves de la API: %w"), err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf(tr("%s no contiene ninguna clave"), path)
+	}
+	return keys, nil
+}
+
+// requestToken Devuelve la clave de la petición: Authorization: Bearer,
+// X-API-Key o, para los WebSocket del navegador, que no pueden añadir
+// cabeceras, el parámetro access_token.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if scheme, token, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	if token := r.Header.Get("X-API-Key"); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+// apiClientKey Clave del contexto con el nombre del cliente autenticado.
+type apiClientKey struct{}
+
+// apiClient Devuelve cómo se nombra al cliente de la petición en el registro:
+// su nombre en el archivo de claves y su dirección, o solo la dirección.
+func apiClient(r *http.Request) string {
+	if name, ok := r.Context().Value(apiClientKey{}).(string); ok {
+		return name + " (" + r.RemoteAddr + ")"
+	}
+	return r.RemoteAddr
+}
+
+// apiSource Devuelve la IP de la petición, a la que se aplican los límites
+// por minuto.
+func apiSource(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// authorize Exige una clave válida en todas las rutas si la API tiene
+// claves. Las consultas previas de CORS (OPTIONS) no llevan credenciales y se
+// dejan pasar, igual que /healthz, que consultan los balanceadores. Las
+// aplicaciones del ePOS SDK no saben enviar claves, así que con claves el
+// servicio ePOS-Print solo sirve a las que pasen por un proxy.
+func (s *apiServer) authorize(next http.Handler) http.Handler {
+	if len(s.keys) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || r.URL.Path == "/healthz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token := requestToken(r)
+		client := ""
+		// Se comparan todas las claves en tiempo constante para que el tiempo
+		// de respuesta no revele cuánto de la clave era correcto.
+		for _, key := range s.keys {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(key.Token)) == 1 {
+				client = key.Client
+			}
+		}
+		if client == "" {
+			err := errors.New(tr("la clave de la API no es válida"))
+			if token == "" {
+				err = errors.New(tr("la API necesita una clave (Authorization: Bearer CLAVE)"))
+			}
+			logger.Warn(fmt.Sprintf(tr("Petición de %s rechazada: %v"), r.RemoteAddr, err), "client", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="escpos"`)
+			writeAPIError(w, http.StatusUnauthorized, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiClientKey{}, client)))
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// apparmorDir Directorio de los perfiles de AppArmor, que apparmor.service
+// vuelve a cargar en cada arranque.
+const apparmorDir = "/etc/apparmor.d"
+
+// apparmorEnabledFile Vale "Y" si el núcleo tiene AppArmor activo.
+const apparmorEnabledFile = "/sys/module/apparmor/parameters/enabled"
+
+// apparmorProfileName Devuelve el nombre del perfil del servicio de una
+// impresora; también es el nombre de su archivo en apparmorDir.
+func apparmorProfileName(name string) string {
+	return "escpos-socket-install." + name
+}
+
+// apparmorProfilePath Devuelve el archivo del perfil de una impresora.
+func apparmorProfilePath(name string) string {
+	return filepath.Join(apparmorDir, apparmorProfileName(name))
+}
+
+// apparmorEnabled Indica si AppArmor está activo y se pueden cargar perfiles.
+func apparmorEnabled() bool {
+	data, err := os.ReadFile(apparmorEnabledFile)
+	if err != nil || strings.TrimSpace(string(data)) != "Y" {
+		return false
+	}
+	_, err = exec.LookPath("apparmor_parser")
+	return err == nil
+}
+
+// confinedByAppArmor Indica si el servicio se ejecuta con su perfil. Solo se
+// confinan relay y serve; LPD, IPP y la API HTTP necesitan más permisos y
+// los servicios que pasan por CUPS no son este programa.
+func (opts installOptions) confinedByAppArmor() bool {
+	return opts.AppArmor && !opts.NoAppArmor && !opts.NoHardening && !userMode && opts.Frontend == "" && opts.CUPSQueue == ""
+}
+
+// apparmorDevice Devuelve la ruta del nodo de la impresora en el perfil.
+// AppArmor sigue los enlaces, así que con el enlace estable de udev se
+// permite el nodo real, cuyo número cambia al desconectar la impresora: se
+// admite cualquier nodo de la misma clase (/dev/usb/lp[0-9]*).
+func apparmorDevice(opts installOptions) string {
+	switch {
+	case opts.Printer.Kind == kindNetwork:
+		return ""
+	case opts.hasStablePath():
+		base := strings.TrimRight(opts.Printer.Path, "0123456789")
+		if base == "" {
+			base = "/dev/usb/lp"
+		}
+		return base + "[0-9]*"
+	}
+	return opts.Printer.Path
+}
+
+// apparmorProfileContent Devuelve el perfil del servicio: el programa solo
+// puede leer lo imprescindible para arrancar, escribir en la impresora, usar
+// los sockets que le pasa systemd (o conectar con la impresora de red) y
+// leer sus credenciales, su directorio de ejecución y sus directorios de trabajos.
+func apparmorProfileContent(opts installOptions) string {
+	name := opts.unitName()
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Perfil de AppArmor de escpos-socket-install para %s; se quita al desinstalar.\n", name)
+	b.WriteString("#include <tunables/global>\n\n")
+	fmt.Fprintf(&b, "profile %s {\n", apparmorProfileName(name))
+	b.WriteString("  #include <abstractions/base>\n\n")
+	b.WriteString("  network unix stream,\n")
+	b.WriteString("  network inet stream,\n")
+	b.WriteString("  network inet6 stream,\n\n")
+	fmt.Fprintf(&b, "  %s mr,\n", installedBinaryPath)
+	b.WriteString("  /etc/localtime r,\n")
+	b.WriteString("  /usr/share/zoneinfo/** r,\n")
+	b.WriteString("  /sys/kernel/mm/transparent_hugepage/hpage_pmd_size r,\n")
+	if device := apparmorDevice(opts); device != "" {
+		fmt.Fprintf(&b, "  %s rw,\n", device)
+	}
+	if opts.Printer.Kind == kindSerial {
+		// ExecStartPre= configura el puerto con stty dentro del mismo perfil.
+		b.WriteString("  /{usr/,}bin/stty ix,\n")
+	}
+	if opts.USBResetOnHang {
+		// resetUSBDevice busca el dispositivo en sysfs y lo reinicia por /dev/bus/usb.
+		b.WriteString("  /sys/class/usbmisc/ r,\n")
+		b.WriteString("  /sys/devices/** r,\n")
+		b.WriteString("  /dev/bus/usb/*/* w,\n")
+	}
+	if opts.TLS != nil {
+		fmt.Fprintf(&b, "  /run/credentials/%s{,@*}.service/* r,\n", name)
+	}
+	if rateDirectives(opts) != "" {
+		fmt.Fprintf(&b, "  /run/escpos-printer/%s/ r,\n", name)
+		fmt.Fprintf(&b, "  /run/escpos-printer/%s/* rwk,\n", name)
+	}
+	for _, dir := range opts.writableDirs() {
+		fmt.Fprintf(&b, "  %s/ r,\n", dir)
+		fmt.Fprintf(&b, "  %s/* rw,\n", dir)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// apparmorCommand Devuelve el comando que carga (o recarga) el perfil antes
+// de arrancar el socket. -W guarda la caché para el próximo arranque.
+func apparmorCommand(name string) plannedCommand {
+	path := apparmorProfilePath(name)
+	return plannedCommand{[]string{"apparmor_parser", "-r", "-W", path}, []string{path}}
+}
+
+// apparmorUninstallCommands Devuelve el comando que descarga el perfil de la
+// impresora, si la instalación lo creó.
+func apparmorUninstallCommands(name string) [][]string {
+	path := apparmorProfilePath(name)
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	return [][]string{{"apparmor_parser", "-R", path}}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultArchiveMaxJobs Trabajos que se guardan por impresora si no se indica
+// otro límite.
+const defaultArchiveMaxJobs = 1000
+
+// archiveSettings Archivo de los trabajos recibidos, para reimprimir un ticket
+// que se perdió en un atasco de papel.
+type archiveSettings struct {
+	Dir     string        `yaml:"dir"`      // Cada impresora guarda sus trabajos en un subdirectorio con su nombre
+	MaxJobs int           `yaml:"max_jobs"` // 0 para defaultArchiveMaxJobs
+	MaxAge  time.Duration `yaml:"max_age"`  // 0 para no borrar por antigüedad
+}
+
+// validate Comprueba el archivo de trabajos.
+func (s *archiveSettings) validate() error {
+	if !filepath.IsAbs(s.Dir) {
+		return fmt.Errorf(tr("el directorio del archivo de trabajos %q no es una ruta absoluta"), s.Dir)
+	}
+	if s.MaxJobs < 0 || s.MaxAge < 0 {
+		return errors.New(tr("los límites del archivo de trabajos no pueden ser negativos"))
+	}
+	return nil
+}
+
+// archiveDir Devuelve el directorio con los trabajos de la impresora.
+func (opts installOptions) archiveDir() string {
+	return filepath.Join(opts.Archive.Dir, opts.unitName())
+}
+
+// checkArchive Rechaza el archivo con una cola de CUPS: el servicio entrega
+// la conexión a lp y no pasa por relay, que es quien guarda los trabajos.
+func checkArchive(opts installOptions) error {
+	if opts.Archive != nil && opts.CUPSQueue != "" {
+		return fmt.Errorf(tr("%s: el archivo de trabajos no admite colas de CUPS"), opts.Printer.Path)
+	}
+	return nil
+}
+
+// archiveFlags Devuelve las opciones del archivo de relay y serve.
+func archiveFlags(opts installOptions) string {
+	if opts.Archive == nil {
+		return ""
+	}
+	flags := " --archive " + opts.archiveDir()
+	if opts.Archive.MaxJobs > 0 {
+		flags += " --archive-max-jobs " + strconv.Itoa(opts.Archive.MaxJobs)
+	}
+	if opts.Archive.MaxAge > 0 {
+		flags += " --archive-max-age " + opts.Archive.MaxAge.String()
+	}
+	return flags
+}
+
+// archiveFromExecStart Extrae el directorio del archivo de la línea
+// ExecStart= del servicio, o devuelve una cadena vacía si no guarda trabajos.
+func archiveFromExecStart(execStart string) string {
+	fields := strings.Fields(execStart)
+	for i, field := range fields {
+		if field == "--archive" && i+1 < len(fields) {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
+
+// archiveServerFlags Añade las opciones del archivo a relay o serve y
+// devuelve la función que lo crea después de fs.Parse; nil sin archivo.
+func archiveServerFlags(fs *flag.FlagSet) func() *jobArchive {
+	dir := fs.String("archive", "", tr("guardar una copia de cada trabajo en este directorio para poder reimprimirlo"))
+	maxJobs := fs.Int("archive-max-jobs", defaultArchiveMaxJobs, tr("trabajos que se conservan en el archivo"))
+	maxAge := fs.Duration("archive-max-age", 0, tr("antigüedad máxima de los trabajos del archivo (0 sin límite)"))
+	return func() *jobArchive {
+		if *dir == "" {
+			return nil
+		}
+		return &jobArchive{dir: *dir, maxJobs: *maxJobs, maxAge: *maxAge}
+	}
+}
+
+// archivedJob Datos de un trabajo guardado, en ID.json junto a sus bytes en
+// ID.bin.
+type archivedJob struct {
+	ID       string    `json:"id"`
+	Received time.Time `json:"received"`
+	Client   string    `json:"client"`
+	Target   string    `json:"target"`
+	Bytes    int64     `json:"bytes"`   // Bytes recibidos del cliente
+	Printed  int64     `json:"printed"` // Bytes que aceptó la impresora
+	Error    string    `json:"error,omitempty"`
+}
+
+// jobArchive Directorio con los trabajos de una impresora.
+type jobArchive struct {
+	dir     string
+	maxJobs int
+	maxAge  time.Duration
+}
+
+// capture Empieza a guardar el trabajo mientras se imprime. Si no se puede
+// guardar solo se avisa: el ticket se imprime igualmente.
+func (a *jobArchive) capture(job jobRecord, in io.Reader) io.Reader {
+	f, err := os.OpenFile(filepath.Join(a.dir, job.ID+".bin.tmp"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		logger.Warn(fmt.Sprintf(tr("⚠ No se pudo guardar el trabajo %s: %v"), job.ID, err), "job_id", job.ID)
+		return in
+	}
+	return &archiveCapture{in: in, f: f, archive: a, job: job}
+}
+
+// archiveCapture Lector que copia en el archivo lo que recibe del cliente.
+type archiveCapture struct {
+	in      io.Reader
+	f       *os.File
+	archive *jobArchive
+	job     jobRecord
+	n       int64
+}
+
+func (c *archiveCapture) Read(p []byte) (int, error) {
+	n, err := c.in.Read(p)
+	if n > 0 {
+		written, _ := c.f.Write(p[:n])
+		c.n += int64(written)
+	}
+	return n, err
+}
+
+// finishArchive Cierra la copia del trabajo y borra los que sobran. Si la
+// impresión falló se lee el resto del trabajo, que nadie había leído, para
+// que la copia esté completa y se pueda reimprimir.
+func finishArchive(in io.Reader, printed int64, printErr error) {
+	c, ok := in.(*archiveCapture)
+	if !ok {
+		return
+	}
+	if printErr != nil {
+		io.Copy(io.Discard, c)
+	}
+	entry := archivedJob{
+		ID:       c.job.ID,
+		Received: c.job.Start,
+		Client:   c.job.Client,
+		Target:   c.job.Target,
+		Bytes:    c.n,
+		Printed:  printed,
+	}
+	if printErr != nil {
+		entry.Error = printErr.Error()
+	}
+	base := filepath.Join(c.archive.dir, c.job.ID)
+	meta, _ := json.Marshal(entry)
+	err := c.f.Close()
+	if err == nil {
+		err = os.Rename(base+".bin.tmp", base+".bin")
+	}
+	if err == nil {
+		err = os.WriteFile(base+".json", meta, 0600)
+	}
+	if err != nil {
+		os.Remove(base + ".bin.tmp")
+		logger.Warn(fmt.Sprintf(tr("⚠ No se pudo guardar el trabajo %s: %v"), c.job.ID, err), "job_id", c.job.ID)
+		return
+	}
+	c.archive.prune()
+}
+
+// prune Borra los trabajos más antiguos que maxAge y, de los que quedan, los
+// que pasan de maxJobs.
+func (a *jobArchive) prune() {
+	jobs, err := readArchive(a.dir)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("⚠ %v", err))
+		return
+	}
+	keep := len(jobs)
+	if a.maxJobs > 0 && keep > a.maxJobs {
+		keep = a.maxJobs
+	}
+	for i, job := range jobs {
+		old := a.maxAge > 0 && time.Since(job.Received) > a.maxAge
+		if i < len(jobs)-keep || old {
+			base := filepath.Join(a.dir, job.ID)
+			os.Remove(base + ".bin")
+			os.Remove(base + ".json")
+		}
+	}
+}
+
+// readArchive Devuelve los trabajos guardados en dir, del más antiguo al más
+// reciente.
+func readArchive(dir string) ([]archivedJob, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf(tr("error al leer el archivo de trabajos %s: %w"), dir, err)
+	}
+	var jobs []archivedJob
+	for _, match := range matches {
+		data, err := os.ReadFile(match)
+		if err != nil {
+			continue
+		}
+		var job archivedJob
+		if json.Unmarshal(data, &job) != nil || job.ID != strings.TrimSuffix(filepath.Base(match), ".json") {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Received.Before(jobs[j].Received) })
+	return jobs, nil
+}
+
+// runReprint Implementa el subcomando "reprint": vuelve a enviar un trabajo
+// guardado al socket de su impresora, o con --list muestra los guardados. El
+// identificador es el campo ESC_POS_JOB_ID del registro.
+func runReprint(args []string) {
+	fs := flag.NewFlagSet("reprint", flag.ExitOnError)
+	list := fs.Bool("list", false, tr("mostrar los trabajos guardados"))
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s reprint --list | TRABAJO\n"), filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *list == (fs.NArg() == 1) || fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	installs, err := readInstallations()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	found := false
+	for _, inst := range installs {
+		dir := inst.Archive
+		if dir == "" {
+			continue
+		}
+		found = true
+		jobs, err := readArchive(dir)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if *list {
+			fmt.Printf("%s (%s)\n", inst.Name, dir)
+			for _, job := range jobs {
+				result := tr("impreso")
+				if job.Error != "" {
+					result = job.Error
+				}
+				fmt.Printf("  %s  %s  %-21s %7d B  %s\n", job.ID, job.Received.Local().Format("2006-01-02 15:04:05"), job.Client, job.Bytes, result)
+			}
+			continue
+		}
+		for _, job := range jobs {
+			if job.ID != fs.Arg(0) {
+				continue
+			}
+			reprintJob(inst, job)
+			return
+		}
+	}
+	switch {
+	case !found:
+		log.Fatal(tr("Error: ninguna impresora instalada guarda sus trabajos (--archive)"))
+	case !*list:
+		log.Fatalf(tr("Error: no se encontró el trabajo %s"), fs.Arg(0))
+	}
+}
+
+// reprintJob Envía el trabajo guardado al socket de la impresora, como un
+// trabajo más: queda en el registro y en el archivo con su propio identificador.
+func reprintJob(inst installation, job archivedJob) {
+	data, err := os.ReadFile(filepath.Join(inst.Archive, job.ID+".bin"))
+	if err != nil {
+		log.Fatalf(tr("Error al leer el trabajo %s: %v"), job.ID, err)
+	}
+	addr, err := inst.localAddr()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	send := sendToSocket
+	if inst.TLS {
+		send = sendToTLSSocket
+	}
+	if err := send(addr, data); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	logger.Info(fmt.Sprintf(tr("✓ Trabajo %s del %s reenviado a %s"), job.ID, job.Received.Local().Format("2006-01-02 15:04:05"), addr), "job_id", job.ID, "bytes", len(data))
+}
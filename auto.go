@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// sendToSocket Envía datos a un socket TCP (o Unix si addr es una ruta),
+// como lo haría un punto de venta.
+func sendToSocket(addr string, data []byte) error {
+	network := "tcp"
+	if filepath.IsAbs(addr) {
+		network = "unix"
+	}
+	conn, err := net.DialTimeout(network, addr, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf(tr("error al conectar con %s: %w"), addr, err)
+	}
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(data); err != nil {
+		conn.Close()
+		return fmt.Errorf(tr("error al enviar datos a %s: %w"), addr, err)
+	}
+	return conn.Close()
+}
+
+// loopbackHost Devuelve la dirección por la que esta máquina puede conectarse
+// a un socket que escucha en bind: 127.0.0.1 (o ::1 en IPv6) si escucha en
+// todas las interfaces, o la dirección concreta si no. Si bind es una lista
+// se usa la primera dirección.
+func loopbackHost(bind string) string {
+	host := bindHosts(bind)[0]
+	ip := net.ParseIP(host)
+	switch {
+	case ip != nil && !ip.IsUnspecified():
+		return host
+	case ip != nil && ip.To4() == nil:
+		return "::1"
+	}
+	return "127.0.0.1"
+}
+
+// confirmationReceipt Construye el ticket que confirma la instalación automática.
+func confirmationReceipt(p printer, port int, host string) *receipt {
+	hostname, _ := os.Hostname()
+	r := newReceipt().
+		align(alignCenter).bold(true).size(2, 2).line("Instalación completa").size(1, 1).bold(false).
+		feed(1).
+		line(printerName(p)).
+		line(p.Path)
+	if p.Caps != nil {
+		r.line(p.Caps.String())
+	}
+	r.feed(1).line(hostname)
+	if host != "127.0.0.1" {
+		r.line(net.JoinHostPort(host, strconv.Itoa(port)))
+	} else if ips, err := hostIPv4s(); err == nil {
+		for _, ip := range ips {
+			r.line(fmt.Sprintf("%s:%d", ip, port))
+		}
+	}
+	return r.line(time.Now().Format("2006-01-02 15:04:05")).feed(3).cut()
+}
+
+// usbPrinters Devuelve solo las impresoras USB. --auto no tiene en cuenta los
+// puertos serie ni los paralelos: muchas máquinas tienen uno sin nada conectado.
+func usbPrinters(printers []printer) []printer {
+	var usb []printer
+	for _, p := range printers {
+		if p.Kind == kindUSB {
+			usb = append(usb, p)
+		}
+	}
+	return usb
+}
+
+// runAutoInstall Instala sin preguntas cuando hay exactamente una impresora,
+// verifica el socket enviando por él el ticket de confirmación.
+func runAutoInstall(printers []printer, port int, bind string, dryRun bool) {
+	switch len(printers) {
+	case 0:
+		failInstall(errors.New(tr("no se encontraron impresoras USB en /dev/usb/lpX")), exitNoDevice)
+	case 1:
+	default:
+		failInstall(fmt.Errorf(tr("hay %d impresoras conectadas; --auto requiere exactamente una. Usa --printer o la instalación interactiva"), len(printers)), exitUsage)
+	}
+
+	p := printers[0]
+	logger.Info(fmt.Sprintf(tr("✓ Impresora detectada: %s\n"), p), "device", p.Path)
+	if p.Caps != nil {
+		logger.Info(fmt.Sprintf(tr("  Perfil: %s\n"), p.Caps))
+	} else {
+		logger.Info(tr("  Modelo no reconocido en la base de capacidades; se usan los valores por defecto."))
+	}
+
+	// Con otra impresora ya instalada se usan unas unidades nuevas en lugar
+	// de sobrescribir las suyas.
+	list := []installOptions{{Printer: p, Port: port, Bind: bind}}
+	assignUnitNames(list)
+	if err := installAll(list, false, dryRun); err != nil {
+		failInstall(err, exitFailure)
+	}
+	if dryRun {
+		finishInstall()
+		return
+	}
+
+	// Se envía por la dirección local para probar el camino completo
+	// socket → servicio → impresora.
+	host := loopbackHost(bind)
+	loopbackAddr := net.JoinHostPort(host, strconv.Itoa(port))
+	logger.Info(fmt.Sprintf(tr("Enviando el ticket de confirmación por %s...\n"), loopbackAddr))
+	if err := sendToSocket(loopbackAddr, confirmationReceipt(p, port, host).Bytes()); err != nil {
+		failInstall(fmt.Errorf(tr("la verificación falló: %w"), err), exitFailure)
+	}
+	logger.Info(tr("✓ Ticket de confirmación enviado."))
+
+	logger.Info(tr("\n🎉 ¡Configuración completa! El socket de la impresora ESC/POS está activo y habilitado."))
+	logger.Info(fmt.Sprintf(tr("La PC está lista para aceptar trabajos de impresión en %s.\n"), list[0].listenAddr()), "listen", list[0].listenAddr())
+	finishInstall()
+}
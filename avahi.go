@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// avahiServicesDir Directorio que vigila avahi-daemon: publica por mDNS los
+// servicios de cada archivo en cuanto aparece, sin reiniciarlo.
+const avahiServicesDir = "/etc/avahi/services"
+
+// avahiServicePath Devuelve la ruta del archivo de servicios de Avahi de la impresora.
+func avahiServicePath(name string) string {
+	return filepath.Join(avahiServicesDir, name+".service")
+}
+
+// checkMDNS Comprueba que se puede anunciar la impresora: el anuncio es del
+// socket TCP y el directorio de Avahi solo lo puede escribir root.
+func checkMDNS(opts installOptions) error {
+	switch {
+	case !opts.MDNS:
+		return nil
+	case userMode:
+		return errors.New(tr("--mdns no está disponible con --user: los servicios de Avahi se instalan en /etc"))
+	case !opts.listensTCP():
+		return errors.New(tr("el anuncio mDNS necesita que el socket escuche en TCP; quita --unix-only"))
+	}
+	if _, err := os.Stat(avahiServicesDir); err != nil {
+		logger.Warn(fmt.Sprintf(tr("⚠ No se encontró %s; el anuncio mDNS solo funcionará cuando se instale avahi-daemon"), avahiServicesDir))
+	}
+	return nil
+}
+
+// avahiServiceName Devuelve el nombre con el que se anuncia la impresora: la
+// etiqueta o el modelo, y el nombre del equipo (%h lo pone Avahi).
+func avahiServiceName(opts installOptions) string {
+	name := opts.Printer.Label
+	if name == "" {
+		name = strings.TrimSpace(opts.Printer.Vendor + " " + opts.Printer.Product)
+	}
+	if name == "" {
+		name = opts.unitName()
+	}
+	return name + " @ %h"
+}
+
+// avahiServiceContent Crea el archivo de servicios de Avahi de la impresora:
+// _pdl-datastream._tcp para el socket RAW, que es lo que buscan las tabletas y
+// las aplicaciones de punto de venta, y _printer._tcp o _ipp._tcp si la
+// impresora también atiende LPD o IPP.
+func avahiServiceContent(opts installOptions) string {
+	model := strings.TrimSpace(opts.Printer.Vendor + " " + opts.Printer.Product)
+	if model == "" {
+		model = "ESC/POS"
+	}
+	txt := []string{"txtvers=1", "qtotal=1", "ty=" + model, "pdl=application/octet-stream"}
+	if opts.Printer.Label != "" {
+		txt = append(txt, "note="+opts.Printer.Label)
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" standalone='no'?>
+<!DOCTYPE service-group SYSTEM "avahi-service.dtd">
+<!-- Generado por escpos-socket-install; se borra al desinstalar. -->
+<service-group>
+`)
+	fmt.Fprintf(&b, "  <name replace-wildcards=\"yes\">%s</name>\n", xmlEscape(avahiServiceName(opts)))
+	writeService := func(kind string, port int, extra ...string) {
+		b.WriteString("  <service>\n")
+		fmt.Fprintf(&b, "    <type>%s</type>\n    <port>%d</port>\n", kind, port)
+		for _, record := range append(txt, extra...) {
+			fmt.Fprintf(&b, "    <txt-record>%s</txt-record>\n", xmlEscape(record))
+		}
+		b.WriteString("  </service>\n")
+	}
+	writeService("_pdl-datastream._tcp", opts.Port)
+	if opts.LPD != nil {
+		writeService("_printer._tcp", opts.LPD.Port, "rp="+opts.lpdQueue())
+	}
+	if opts.IPP != nil {
+		writeService("_ipp._tcp", opts.IPP.Port, "rp=ipp/print")
+	}
+	b.WriteString("</service-group>\n")
+	return b.String()
+}
+
+// xmlEscape Escapa los caracteres especiales de XML de un texto.
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;").Replace(s)
+}
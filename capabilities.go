@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// capabilitiesFilePath Archivo opcional con capacidades adicionales o corregidas,
+// con el mismo formato que builtinCapabilities, indexado por "vid:pid".
+const capabilitiesFilePath = "/etc/escpos-printer/capabilities.json"
+
+// capabilities Describe lo que soporta un modelo de impresora.
+type capabilities struct {
+	Model      string   `json:"model"`
+	PaperWidth int      `json:"paper_width_mm"` // Ancho del papel en milímetros
+	Columns    int      `json:"columns"`        // Columnas con la fuente A
+	Cutter     bool     `json:"cutter"`         // Tiene cortador automático
+	Codepages  []string `json:"codepages"`      // Tablas de caracteres útiles (ESC t n)
+	Raster     bool     `json:"raster"`         // Soporta imágenes raster (GS v 0)
+	MaxBuffer  int      `json:"max_buffer"`     // Tamaño del búfer de recepción en bytes
+}
+
+// builtinCapabilities Base de datos incluida de modelos conocidos, indexada por VID:PID.
+// Los valores son los de fábrica; un sitio puede corregirlos con capabilitiesFilePath.
+var builtinCapabilities = map[string]capabilities{
+	"04b8:0202": {
+		Model:      "EPSON TM (M129C)",
+		PaperWidth: 80,
+		Columns:    48,
+		Cutter:     true,
+		Codepages:  []string{"PC437", "PC850", "PC858"},
+		Raster:     true,
+		MaxBuffer:  4096,
+	},
+	"04b8:0e03": {
+		Model:      "EPSON TM-T20",
+		PaperWidth: 80,
+		Columns:    48,
+		Cutter:     true,
+		Codepages:  []string{"PC437", "PC850", "PC858"},
+		Raster:     true,
+		MaxBuffer:  4096,
+	},
+	"04b8:0e15": {
+		Model:      "EPSON TM-T20II",
+		PaperWidth: 80,
+		Columns:    48,
+		Cutter:     true,
+		Codepages:  []string{"PC437", "PC850", "PC858", "WPC1252"},
+		Raster:     true,
+		MaxBuffer:  4096,
+	},
+	"04b8:0e28": {
+		Model:      "EPSON TM-T20III",
+		PaperWidth: 80,
+		Columns:    48,
+		Cutter:     true,
+		Codepages:  []string{"PC437", "PC850", "PC858", "WPC1252"},
+		Raster:     true,
+		MaxBuffer:  4096,
+	},
+	"04b8:0e27": {
+		Model:      "EPSON TM-T88VI",
+		PaperWidth: 80,
+		Columns:    48,
+		Cutter:     true,
+		Codepages:  []string{"PC437", "PC850", "PC858", "WPC1252"},
+		Raster:     true,
+		MaxBuffer:  4096,
+	},
+}
+
+// loadCapabilities Devuelve la base de datos incluida con las correcciones del
+// sitio aplicadas encima. Si el archivo de correcciones no existe se usa solo
+// la base incluida.
+func loadCapabilities() (map[string]capabilities, error) {
+	db := make(map[string]capabilities, len(builtinCapabilities))
+	for id, c := range builtinCapabilities {
+		db[id] = c
+	}
+
+	data, err := os.ReadFile(capabilitiesFilePath)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(tr("error al leer %s: %w"), capabilitiesFilePath, err)
+	}
+
+	var overrides map[string]capabilities
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf(tr("error en el formato de %s: %w"), capabilitiesFilePath, err)
+	}
+	for id, c := range overrides {
+		db[strings.ToLower(id)] = c
+	}
+	return db, nil
+}
+
+// applyCapabilities Asigna a cada impresora las capacidades de su modelo, si se conoce.
+func applyCapabilities(printers []printer, db map[string]capabilities) {
+	for i := range printers {
+		p := &printers[i]
+		if p.VendorID == "" || p.ProductID == "" {
+			continue
+		}
+		if c, ok := db[p.VendorID+":"+p.ProductID]; ok {
+			p.Caps = &c
+		}
+	}
+}
+
+// String Devuelve un resumen de las capacidades para mostrarlo al usuario.
+func (c capabilities) String() string {
+	parts := []string{c.Model}
+	if c.PaperWidth > 0 {
+		parts = append(parts, fmt.Sprintf("%d mm", c.PaperWidth))
+	}
+	if c.Columns > 0 {
+		parts = append(parts, fmt.Sprintf("%d columnas", c.Columns))
+	}
+	if c.Cutter {
+		parts = append(parts, "cortador")
+	}
+	return strings.Join(parts, ", ")
+}
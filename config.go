@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// installConfig Configuración declarativa de la instalación (--config install.yaml).
+//
+// Ejemplo:
+//
+//	announce: true
+//	printers:
+//	  - device: /dev/usb/lp0
+//	    port: 9100
+//	    bind: 192.168.1.10,fd00::10
+//	    label: caja
+//	    mdns: true
+//	    max_connections: 16
+//	    max_connections_per_source: 4
+//	    max_connections_per_minute: 30
+//	    max_bytes_per_minute: 1048576
+//	    allow: [192.168.1.0/24]
+//	    open_firewall: true
+//	    idle_timeout: 30s
+//	    usb_reset_on_hang: true
+//	    archive:
+//	      dir: /var/lib/escpos-printer/jobs
+//	      max_jobs: 500
+//	      max_age: 720h
+//	    lpd:
+//	      queue: caja
+//	    ipp:
+//	      port: 8631
+//	    http_api:
+//	      port: 8100
+//	      keys_file: /etc/escpos-printer/api-keys
+//	    socket_options:
+//	      KeepAlive: "yes"
+//	  - device: /dev/ttyUSB0
+//	    serial:
+//	      baud: 38400
+//	      flow_control: rtscts
+//	    tls:
+//	      cert: /etc/ssl/certs/caja2.pem
+//	      key: /etc/ssl/private/caja2.key
+//	  - device: cocina
+//	    cups_queue: TM-T20III
+//	    mqtt:
+//	      broker: mqtts://broker.example.com:8883
+//	      topics: [store/42/kitchen]
+//	      username: tienda42
+//	      password_file: /etc/escpos-printer/mqtt.pass
+//	    unix_socket:
+//	      path: /run/escpos/cocina.sock
+//	      only: true
+//	      mode: "0660"
+//	      group: lp
+//	  - device: tcp://192.168.1.50:9100
+//	    port: 9101
+//	    daemon: true
+//	    metrics: 127.0.0.1:9464
+//	    spool:
+//	      dir: /var/spool/escpos-printer
+//	      max_jobs: 50
+//	    cups_raw_queue: true
+type installConfig struct {
+	Announce bool            `yaml:"announce"`
+	Printers []printerConfig `yaml:"printers"`
+}
+
+// printerConfig Declara una impresora y las opciones de sus unidades.
+type printerConfig struct {
+	Device         string            `yaml:"device"` // Ruta, nombre (lp0), puerto USB, etiqueta, usb:VID:PID[:SERIE] o tcp://HOST[:PUERTO]
+	Port           int               `yaml:"port"`
+	Bind           string            `yaml:"bind"`           // Una o varias direcciones separadas por comas
+	BindIPv6Only   string            `yaml:"bind_ipv6_only"` // both o ipv6-only para el socket en ::
+	Unix           *unixSocket       `yaml:"unix_socket"`    // Socket Unix adicional o único
+	LPD            *lpdSettings      `yaml:"lpd"`            // Servidor LPD adicional
+	IPP            *ippSettings      `yaml:"ipp"`            // Servidor IPP adicional
+	HTTP           *httpSettings     `yaml:"http_api"`       // API HTTP adicional
+	Label          string            `yaml:"label"`
+	Serial         *serialSettings   `yaml:"serial"`         // Solo para impresoras serie
+	CUPSQueue      string            `yaml:"cups_queue"`     // Cola de CUPS que recibe los trabajos en lugar del dispositivo
+	RawQueue       bool              `yaml:"cups_raw_queue"` // Crear una cola en crudo de CUPS que imprime en el socket
+	MDNS           bool              `yaml:"mdns"`           // Anunciar la impresora por mDNS con Avahi
+	MQTT           *mqttSettings     `yaml:"mqtt"`           // Puente MQTT que imprime los mensajes de unos temas
+	TLS            *tlsSettings      `yaml:"tls"`            // Cifrar el socket RAW con TLS
+	OpenFirewall   bool              `yaml:"open_firewall"`  // Abrir los puertos en ufw o firewalld
+	TakeOver       bool              `yaml:"take_over"`      // Deshabilitar el servicio que ya escuche en el puerto
+	Daemon         bool              `yaml:"daemon"`         // Un solo proceso para todas las conexiones (Accept=no)
+	Metrics        string            `yaml:"metrics"`        // HOST:PUERTO de /metrics, solo con daemon
+	Archive        *archiveSettings  `yaml:"archive"`        // Guardar los trabajos para reimprimirlos
+	Spool          *spoolSettings    `yaml:"spool"`          // Cola en disco con la impresora apagada, solo con daemon
+	MaxConnections int               `yaml:"max_connections"`
+	MaxPerSource   int               `yaml:"max_connections_per_source"`
+	PerMinute      int               `yaml:"max_connections_per_minute"`
+	BytesPerMinute int64             `yaml:"max_bytes_per_minute"` // Se corta el trabajo que los supera
+	Allow          []string          `yaml:"allow"`                // Redes (CIDR) que pueden imprimir; el resto se rechaza
+	NoHardening    bool              `yaml:"no_hardening"`         // No aislar el servicio
+	NoAppArmor     bool              `yaml:"no_apparmor"`          // No confinar el servicio con AppArmor
+	USBResetOnHang bool              `yaml:"usb_reset_on_hang"`    // Reiniciar el puerto USB de la impresora colgada
+	IdleTimeout    time.Duration     `yaml:"idle_timeout"`         // Por ejemplo 30s
+	JobTimeout     time.Duration     `yaml:"job_timeout"`          // Por ejemplo 5m
+	SocketOptions  map[string]string `yaml:"socket_options"`
+	ServiceOptions map[string]string `yaml:"service_options"`
+}
+
+// loadConfig Lee y valida el archivo de configuración. Las claves desconocidas
+// se rechazan para que un error de escritura no pase desapercibido.
+func loadConfig(path string) (installConfig, error) {
+	var cfg installConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf(tr("error al leer la configuración: %w"), err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf(tr("error en el formato de %s: %w"), path, err)
+	}
+
+	if len(cfg.Printers) == 0 {
+		return cfg, fmt.Errorf(tr("%s no declara ninguna impresora"), path)
+	}
+	for i := range cfg.Printers {
+		pc := &cfg.Printers[i]
+		if pc.Device == "" {
+			return cfg, fmt.Errorf(tr("la impresora %d de %s no indica device"), i+1, path)
+		}
+		if pc.Port == 0 {
+			pc.Port = defaultPort + i // Puertos consecutivos: 9100, 9101...
+		}
+		if pc.Port < 1 || pc.Port > 65535 {
+			return cfg, fmt.Errorf(tr("puerto inválido %d para %s"), pc.Port, pc.Device)
+		}
+		if err := validateBind(pc.Bind, pc.BindIPv6Only); err != nil {
+			return cfg, fmt.Errorf("%s: %w", pc.Device, err)
+		}
+		if pc.Metrics != "" {
+			if !pc.Daemon {
+				return cfg, fmt.Errorf(tr("%s: metrics requiere daemon"), pc.Device)
+			}
+			if err := checkMetricsAddr(pc.Metrics); err != nil {
+				return cfg, fmt.Errorf("%s: %w", pc.Device, err)
+			}
+		}
+		if pc.Archive != nil {
+			if err := pc.Archive.validate(); err != nil {
+				return cfg, fmt.Errorf("%s: %w", pc.Device, err)
+			}
+		}
+		if pc.Spool != nil {
+			if !pc.Daemon {
+				return cfg, fmt.Errorf(tr("%s: spool requiere daemon"), pc.Device)
+			}
+			if err := pc.Spool.validate(); err != nil {
+				return cfg, fmt.Errorf("%s: %w", pc.Device, err)
+			}
+		}
+		if pc.Unix != nil {
+			if err := pc.Unix.validate(); err != nil {
+				return cfg, fmt.Errorf("%s: %w", pc.Device, err)
+			}
+		}
+		if pc.LPD != nil {
+			if err := pc.LPD.validate(); err != nil {
+				return cfg, fmt.Errorf("%s: %w", pc.Device, err)
+			}
+		}
+		if pc.IPP != nil {
+			if err := pc.IPP.validate(); err != nil {
+				return cfg, fmt.Errorf("%s: %w", pc.Device, err)
+			}
+		}
+		if pc.HTTP != nil {
+			if err := pc.HTTP.validate(); err != nil {
+				return cfg, fmt.Errorf("%s: %w", pc.Device, err)
+			}
+		}
+		if pc.MQTT != nil {
+			if err := pc.MQTT.validate(); err != nil {
+				return cfg, fmt.Errorf("%s: %w", pc.Device, err)
+			}
+		}
+		if pc.TLS != nil {
+			if err := pc.TLS.validate(); err != nil {
+				return cfg, fmt.Errorf("%s: %w", pc.Device, err)
+			}
+		}
+		if pc.IdleTimeout < 0 || pc.JobTimeout < 0 {
+			return cfg, fmt.Errorf(tr("plazo negativo para %s"), pc.Device)
+		}
+		if pc.MaxConnections < 0 || pc.MaxPerSource < 0 || pc.PerMinute < 0 || pc.BytesPerMinute < 0 {
+			return cfg, fmt.Errorf(tr("límite de conexiones negativo para %s"), pc.Device)
+		}
+		if err := validateAllowList(pc.Allow); err != nil {
+			return cfg, fmt.Errorf("%s: %w", pc.Device, err)
+		}
+		if pc.Serial != nil {
+			if err := pc.Serial.validate(); err != nil {
+				return cfg, fmt.Errorf("%s: %w", pc.Device, err)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// installFromConfig Resuelve las impresoras de la configuración y ejecuta la
+// instalación, o solo la muestra con dryRun.
+func installFromConfig(cfg installConfig, dryRun bool) ([]installOptions, error) {
+	list := make([]installOptions, 0, len(cfg.Printers))
+	for _, pc := range cfg.Printers {
+		p, err := lookupPrinter(pc.Device)
+		if err != nil {
+			return nil, err
+		}
+		if pc.Label != "" {
+			if err := applyLabel(&p, pc.Label, dryRun); err != nil {
+				return nil, err
+			}
+		}
+		logger.Info(fmt.Sprintf(tr("✓ Impresora seleccionada: %s\n"), p), "device", p.Path)
+
+		serial := pc.Serial
+		if serial == nil {
+			serial = defaultSerial(p)
+		}
+		list = append(list, installOptions{
+			Printer:      p,
+			Serial:       serial,
+			CUPSQueue:    pc.CUPSQueue,
+			RawQueue:     pc.RawQueue,
+			MDNS:         pc.MDNS,
+			MQTT:         pc.MQTT,
+			TLS:          pc.TLS,
+			OpenFirewall: pc.OpenFirewall,
+			TakeOver:     pc.TakeOver,
+			Daemon:       pc.Daemon,
+			Metrics:      pc.Metrics,
+			Archive:      pc.Archive,
+			Spool:        pc.Spool,
+
+			USBResetOnHang: pc.USBResetOnHang,
+
+			MaxConnections:          pc.MaxConnections,
+			MaxConnectionsPerSource: pc.MaxPerSource,
+			ConnectionsPerMinute:    pc.PerMinute,
+			BytesPerMinute:          pc.BytesPerMinute,
+			AllowFrom:               pc.Allow,
+			NoHardening:             pc.NoHardening,
+			NoAppArmor:              pc.NoAppArmor,
+			IdleTimeout:             pc.IdleTimeout,
+			JobTimeout:              pc.JobTimeout,
+			Port:                    pc.Port,
+			Bind:                    pc.Bind,
+			BindIPv6Only:            pc.BindIPv6Only,
+			Unix:                    pc.Unix,
+			LPD:                     pc.LPD,
+			IPP:                     pc.IPP,
+			HTTP:                    pc.HTTP,
+			SocketOptions:           pc.SocketOptions,
+			ServiceOptions:          pc.ServiceOptions,
+		})
+	}
+	assignUnitNames(list)
+	return list, installAll(list, cfg.Announce, dryRun)
+}
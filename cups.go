@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// lpPath Programa de CUPS con el que el servicio envía los trabajos a la cola.
+const lpPath = "/usr/bin/lp"
+
+// cupsQueue Cola de CUPS y el dispositivo al que imprime.
+type cupsQueue struct {
+	Name string // Nombre de la cola, por ejemplo TM-T20III
+	URI  string // URI del dispositivo, por ejemplo usb://EPSON/TM-T20III?serial=X4BG012345
+}
+
+// cupsQueues Devuelve las colas configuradas en CUPS según "lpstat -v". Si
+// CUPS no está instalado o no responde devuelve una lista vacía.
+func cupsQueues() []cupsQueue {
+	cmd := exec.Command("lpstat", "-v")
+	// La salida de lpstat está traducida; se pide en inglés para leerla.
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	var queues []cupsQueue
+	for _, line := range strings.Split(string(out), "\n") {
+		// device for TM-T20III: usb://EPSON/TM-T20III?serial=X4BG012345
+		rest, ok := strings.CutPrefix(line, "device for ")
+		if !ok {
+			continue
+		}
+		name, uri, ok := strings.Cut(rest, ": ")
+		if ok {
+			queues = append(queues, cupsQueue{Name: name, URI: strings.TrimSpace(uri)})
+		}
+	}
+	return queues
+}
+
+// matchesPrinter Indica si la cola imprime en la impresora. Las USB se
+// reconocen por su número de serie o, si no lo tienen, por el modelo; las del
+// puerto paralelo por su nodo (parallel:/dev/lp0).
+func (q cupsQueue) matchesPrinter(p printer) bool {
+	u, err := url.Parse(q.URI)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "usb":
+		if p.Kind != kindUSB {
+			return false
+		}
+		if serial := u.Query().Get("serial"); serial != "" && p.Serial != "" {
+			return serial == p.Serial
+		}
+		return p.Product != "" && strings.EqualFold(path.Base(u.Path), p.Product)
+	case "parallel":
+		return p.Kind == kindParallel && u.Path == p.Path
+	}
+	return false
+}
+
+// findCUPSQueue Busca la cola de CUPS que imprime en la impresora.
+func findCUPSQueue(p printer, queues []cupsQueue) (cupsQueue, bool) {
+	for _, q := range queues {
+		if q.matchesPrinter(p) {
+			return q, true
+		}
+	}
+	return cupsQueue{}, false
+}
+
+// cupsExecStart Devuelve el comando del servicio que envía cada conexión como
+// un trabajo en crudo a la cola, sin que CUPS lo convierta. Así la impresora
+// se comparte con CUPS en lugar de pelear con él por el dispositivo.
+func cupsExecStart(queue string) string {
+	return "-" + lpPath + " -s -d " + queue + " -o raw -t escpos-socket"
+}
+
+// queueFromExecStart Extrae la cola de CUPS de la línea ExecStart= del
+// servicio, o devuelve una cadena vacía si el servicio escribe en el dispositivo.
+func queueFromExecStart(execStart string) string {
+	fields := strings.Fields(execStart)
+	if len(fields) == 0 || strings.TrimPrefix(fields[0], "-") != lpPath {
+		return ""
+	}
+	for i, field := range fields {
+		if field == "-d" && i+1 < len(fields) {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
+
+// checkCUPSQueue Comprueba que la cola existe y acepta trabajos. Usa los
+// mismos campos que checkDevice: Exists si la cola existe y Writable si acepta
+// trabajos.
+func checkCUPSQueue(queue string) deviceStatus {
+	st := deviceStatus{Path: queue}
+	cmd := exec.Command("lpstat", "-a", queue)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		st.Error = strings.TrimSpace(string(out))
+		if st.Error == "" {
+			st.Error = err.Error()
+		}
+		return st
+	}
+	st.Exists = true
+	if strings.Contains(string(out), "not accepting") {
+		st.Error = tr("la cola de CUPS no acepta trabajos")
+		return st
+	}
+	st.Writable = true
+	return st
+}
+
+// checkRawQueue Comprueba que se puede crear la cola en crudo de la impresora:
+// hace falta lpadmin, y el socket de CUPS solo imprime por TCP. Con una cola
+// de CUPS como destino los trabajos darían la vuelta por CUPS dos veces.
+func checkRawQueue(opts installOptions) error {
+	switch {
+	case !opts.RawQueue:
+		return nil
+	case opts.CUPSQueue != "":
+		return fmt.Errorf(tr("%s: la impresora ya imprime a través de la cola de CUPS %s; no hace falta otra cola"), opts.Printer.Path, opts.CUPSQueue)
+	case !opts.listensTCP():
+		return errors.New(tr("la cola de CUPS necesita que el socket escuche en TCP; quita --unix-only"))
+	}
+	if _, err := exec.LookPath("lpadmin"); err != nil {
+		return errors.New(tr("no se encontró lpadmin; instala CUPS para crear la cola"))
+	}
+	return nil
+}
+
+// rawQueueURI Devuelve la URI con la que CUPS imprime en el socket.
+func rawQueueURI(opts installOptions) string {
+	return "socket://" + net.JoinHostPort(loopbackHost(opts.Bind), strconv.Itoa(opts.Port))
+}
+
+// rawQueueCommand Devuelve la orden que crea, o actualiza si ya existe, la
+// cola en crudo con el nombre de las unidades. La cola no se comparte en la
+// red: para eso ya está el socket. CUPS avisa de que las colas en crudo están
+// obsoletas, pero siguen funcionando y son las que no tocan los datos.
+func rawQueueCommand(opts installOptions) []string {
+	return []string{"lpadmin", "-p", opts.unitName(), "-E", "-v", rawQueueURI(opts), "-m", "raw",
+		"-D", "ESC/POS " + opts.unitName(), "-o", "printer-is-shared=false"}
+}
+
+// rawQueuesOf Devuelve las colas en crudo creadas para las instalaciones: las
+// que tienen su nombre e imprimen en su puerto con el socket de CUPS.
+func rawQueuesOf(installs []installation) []string {
+	var names []string
+	for _, q := range cupsQueues() {
+		u, err := url.Parse(q.URI)
+		if err != nil || u.Scheme != "socket" {
+			continue
+		}
+		for _, inst := range installs {
+			if q.Name == inst.Name && strings.HasSuffix(inst.Listen, ":"+u.Port()) {
+				names = append(names, q.Name)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// listenFDsStart Primer descriptor que systemd pasa con la activación por
+// socket (SD_LISTEN_FDS_START).
+const listenFDsStart = 3
+
+// daemonServicePath Devuelve la ruta del servicio del modo daemon. Con
+// Accept=no el servicio se llama igual que el socket, sin plantilla.
+func daemonServicePath(name string) string {
+	return filepath.Join(unitDir, name+".service")
+}
+
+// serviceFile Devuelve la ruta del archivo de servicio según el modo.
+func (opts installOptions) serviceFile() string {
+	if opts.Daemon {
+		return daemonServicePath(opts.socketName())
+	}
+	return serviceUnitPath(opts.socketName())
+}
+
+// daemonExecStart Devuelve el comando del servicio del modo daemon.
+func daemonExecStart(opts installOptions) string {
+	if opts.Printer.Kind == kindNetwork {
+		return installedBinaryPath + " serve --to " + opts.Printer.Path + timeoutFlags(opts) + tlsFlags(opts) + rateFlags(opts) + archiveFlags(opts) + spoolFlags(opts) + metricsFlags(opts)
+	}
+	return installedBinaryPath + " serve --device " + opts.devicePath() + timeoutFlags(opts) + tlsFlags(opts) + rateFlags(opts) + archiveFlags(opts) + spoolFlags(opts) + metricsFlags(opts) + usbResetFlags(opts)
+}
+
+// systemdListener Devuelve el socket que systemd pasó al servicio según
+// LISTEN_PID y LISTEN_FDS (sd_listen_fds). Solo se admite uno.
+func systemdListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, errors.New(tr("no se recibió ningún socket de systemd (LISTEN_PID); serve solo se ejecuta desde la unidad"))
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n != 1 {
+		return nil, fmt.Errorf(tr("se esperaba un socket de systemd y se recibieron %q"), os.Getenv("LISTEN_FDS"))
+	}
+	// Los procesos hijos no deben heredar las variables.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(listenFDsStart, "systemd-socket")
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf(tr("error al usar el socket de systemd: %w"), err)
+	}
+	return ln, nil
+}
+
+// runServe Implementa el subcomando "serve", el servicio del modo daemon:
+// recibe de systemd el socket que escucha (Accept=no) y atiende todas las
+// conexiones en un único proceso. Los trabajos se imprimen de uno en uno, en
+// el orden en que llegan, para que dos clientes no mezclen sus tickets. Con
+// --spool los trabajos se guardan primero en disco y esperan en cola a que la
+// impresora esté disponible.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	device := fs.String("device", "", tr("nodo de la impresora, por ejemplo /dev/usb/lp0"))
+	to := fs.String("to", "", tr("dirección HOST:PUERTO de la impresora"))
+	timeout := fs.Duration("timeout", defaultWriteTimeout, tr("tiempo máximo de espera a que la impresora acepte datos"))
+	idle := fs.Duration("idle-timeout", defaultIdleTimeout, tr("tiempo máximo sin recibir datos del cliente (0 sin límite)"))
+	total := fs.Duration("job-timeout", defaultJobTimeout, tr("duración máxima de un trabajo (0 sin límite)"))
+	loadTLS := tlsServerFlags(fs)
+	newLimiter := rateServerFlags(fs)
+	newArchive := archiveServerFlags(fs)
+	newSpool := spoolServerFlags(fs)
+	recoverHung := usbResetServerFlags(fs)
+	metricsAddr := fs.String("metrics", "", tr("dirección HOST:PUERTO en la que publicar las métricas de Prometheus (/metrics) y el estado (/healthz)"))
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s serve --device NODO | --to HOST:PUERTO\n"), filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if (*device == "") == (*to == "") {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	tlsConfig, err := loadTLS()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	ln, err := systemdListener()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	target := *device
+	if *to != "" {
+		target = *to
+	}
+	logger.Info(fmt.Sprintf(tr("Atendiendo %s para %s"), ln.Addr(), target), "listen", ln.Addr().String(), "target", target)
+
+	limiter := newLimiter("")
+	archive := newArchive()
+	spool := newSpool()
+	var printing sync.Mutex
+	var metrics *serveMetrics
+	if *metricsAddr != "" {
+		check := func() deviceStatus { return checkDevice(*device) }
+		if *to != "" {
+			check = func() deviceStatus { return checkRemote(*to) }
+		}
+		read := conditionReader(*device, *to)
+		condition := func() *printerCondition { return probeCondition(&printing, read) }
+		metrics = newServeMetrics(ln.Addr().String(), check, condition)
+		if spool != nil {
+			metrics.spooled = spool.size
+		}
+		go metrics.listen(*metricsAddr)
+	}
+	// printJob Imprime un trabajo; quien la llama tiene el cerrojo printing.
+	printJob := func(job jobRecord, in io.Reader) (int64, error) {
+		if archive != nil {
+			in = archive.capture(job, in)
+		}
+		meter := metrics.meter(in)
+		var n int64
+		var err error
+		if *to != "" {
+			n, err = relayNetwork(meter, *to)
+		} else {
+			n, err = relayDevice(meter, *device, *timeout, *total)
+			recoverHung(*device, err)
+		}
+		meter.finish()
+		finishArchive(in, n, err)
+		metrics.jobDone(n, err)
+		return n, err
+	}
+	if spool != nil {
+		go spool.run(func(job jobRecord, in io.Reader) (int64, error) {
+			printing.Lock()
+			defer printing.Unlock()
+			return printJob(job, in)
+		})
+	}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			log.Fatalf("Error: %v", err)
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			metrics.connOpened()
+			defer metrics.connClosed()
+			source := rateClient(conn.RemoteAddr())
+			if limiter != nil {
+				if err := limiter.admit(source); err != nil {
+					logger.Warn(fmt.Sprintf(tr("Conexión rechazada: %v"), err), "client", source)
+					return
+				}
+			}
+			// El saludo TLS se hace antes de esperar turno, con su propio plazo.
+			if tc, ok := conn.(*tls.Conn); ok {
+				if err := handshakeTLS(tc); err != nil {
+					logger.Warn(fmt.Sprintf("⚠ %v", err), "client", conn.RemoteAddr().String())
+					return
+				}
+			}
+			if spool != nil {
+				// Con cola no se espera turno: el trabajo se recibe entero
+				// en disco y run lo imprime cuando le toca.
+				job := newJobRecord(conn.RemoteAddr().String(), target)
+				in := withTimeouts(conn, jobTimeouts{Idle: *idle, Total: *total})
+				if limiter != nil {
+					in = limiter.limit(in, source)
+				}
+				n, err := spool.add(job, in)
+				if limiter != nil {
+					limiter.record(source, n)
+				}
+				if err != nil {
+					logger.Error(fmt.Sprintf(tr("Error en el trabajo de %s: %v"), job.Client, err), job.attrs(n, err)...)
+					resetConn(conn)
+					return
+				}
+				logger.Debug(fmt.Sprintf(tr("Trabajo de %d bytes de %s en la cola"), n, job.Client), "job_id", job.ID)
+				return
+			}
+			printing.Lock()
+			defer printing.Unlock()
+			job := newJobRecord(conn.RemoteAddr().String(), target)
+
+			// Los plazos cuentan desde que le toca imprimir, no desde que
+			// se conectó: la espera en la cola no es culpa del cliente.
+			in := withTimeouts(conn, jobTimeouts{Idle: *idle, Total: *total})
+			if limiter != nil {
+				in = limiter.limit(in, source)
+			}
+			n, err := printJob(job, in)
+			if limiter != nil {
+				limiter.record(source, n)
+			}
+			if err != nil {
+				logger.Error(fmt.Sprintf(tr("Error en el trabajo de %s: %v"), job.Client, err), job.attrs(n, err)...)
+				resetConn(conn)
+				return
+			}
+			logger.Info(fmt.Sprintf(tr("Trabajo de %d bytes de %s enviado a %s"), n, job.Client, target), job.attrs(n, nil)...)
+		}(conn)
+	}
+}
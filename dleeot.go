@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+// dleEOTTimeout Espera de cada respuesta a DLE EOT. La impresora responde en
+// tiempo real, incluso fuera de línea; si no responde es que el nodo no es
+// bidireccional o la impresora no admite el comando.
+const dleEOTTimeout = 500 * time.Millisecond
+
+// Bits de las respuestas a DLE EOT n de ESC/POS.
+const (
+	dleEOTFixedMask  = 0x93 // Los bits 0, 1, 4 y 7 son fijos en toda respuesta
+	dleEOTFixedValue = 0x12
+
+	dleEOTOffline       = 0x08 // n=1: fuera de línea
+	dleEOTCoverOpen     = 0x04 // n=2: tapa abierta
+	dleEOTPaperStop     = 0x20 // n=2: se detuvo la impresión por falta de papel
+	dleEOTCutterError   = 0x08 // n=3: error del cortador
+	dleEOTUnrecoverable = 0x20 // n=3: error irrecuperable
+	dleEOTAutoRecover   = 0x40 // n=3: error que se recupera solo, como el cabezal caliente
+	dleEOTPaperEnd      = 0x60 // n=4: sensor de fin de rollo
+)
+
+// dleEOTConn Conexión con la impresora en la que se puede preguntar: el nodo
+// abierto para lectura y escritura o el socket de una impresora de red.
+type dleEOTConn interface {
+	io.ReadWriter
+	SetReadDeadline(time.Time) error
+	SetWriteDeadline(time.Time) error
+}
+
+// queryDLEEOT Pregunta a la impresora su estado, la causa de estar fuera de
+// línea, la de un error y el sensor de papel (DLE EOT 1 a 4). Devuelve nil si
+// no responde.
+func queryDLEEOT(conn dleEOTConn) *printerCondition {
+	var status [4]byte
+	for i := range status {
+		b, ok := askDLEEOT(conn, byte(i+1))
+		if !ok {
+			return nil
+		}
+		status[i] = b
+	}
+	return &printerCondition{
+		Online:    status[0]&dleEOTOffline == 0,
+		CoverOpen: status[1]&dleEOTCoverOpen != 0,
+		PaperOut:  status[1]&dleEOTPaperStop != 0 || status[3]&dleEOTPaperEnd != 0,
+		Error:     status[2]&(dleEOTCutterError|dleEOTUnrecoverable|dleEOTAutoRecover) != 0,
+	}
+}
+
+// askDLEEOT Envía DLE EOT n y devuelve la respuesta. Los bytes que no tienen
+// los bits fijos de una respuesta (un estado automático ASB que quedó sin
+// leer, por ejemplo) se saltan.
+func askDLEEOT(conn dleEOTConn, n byte) (byte, bool) {
+	deadline := time.Now().Add(dleEOTTimeout)
+	conn.SetWriteDeadline(deadline)
+	if _, err := conn.Write([]byte{0x10, 0x04, n}); err != nil {
+		return 0, false
+	}
+	conn.SetReadDeadline(deadline)
+	var b [1]byte
+	for {
+		if _, err := io.ReadFull(conn, b[:]); err != nil {
+			return 0, false
+		}
+		if b[0]&dleEOTFixedMask == dleEOTFixedValue {
+			return b[0], true
+		}
+	}
+}
+
+// readRemoteCondition Pregunta su estado a una impresora de red por su
+// puerto RAW. Devuelve nil si no se puede conectar o no responde.
+func readRemoteCondition(addr string) *printerCondition {
+	conn, err := net.DialTimeout("tcp", addr, relayDialTimeout)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	return queryDLEEOT(conn)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Niveles de un hallazgo de doctor.
+const (
+	findingOK   = "ok"
+	findingWarn = "warn"
+	findingFail = "fail"
+)
+
+// finding Resultado de una comprobación de doctor, con la acción sugerida
+// cuando algo no está bien.
+type finding struct {
+	Check  string `json:"check"`
+	Level  string `json:"level"`
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// checkSystemd Comprueba que la máquina arrancó con systemd y que systemctl existe.
+func checkSystemd() finding {
+	f := finding{Check: "systemd"}
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		f.Level = findingFail
+		f.Detail = tr("la máquina no arrancó con systemd")
+		f.Fix = tr("el instalador necesita systemd para activar el socket")
+		return f
+	}
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		f.Level = findingFail
+		f.Detail = tr("no se encontró systemctl")
+		return f
+	}
+	f.Level = findingOK
+	f.Detail = tr("systemd disponible")
+	return f
+}
+
+// checkUSBLP Comprueba que el controlador usblp está cargado o integrado en el
+// kernel; sin él no aparecen los nodos /dev/usb/lpX.
+func checkUSBLP() finding {
+	f := finding{Check: "usblp"}
+	if _, err := os.Stat("/sys/module/usblp"); err == nil {
+		f.Level = findingOK
+		f.Detail = tr("módulo usblp cargado")
+		return f
+	}
+	f.Level = findingFail
+	f.Detail = tr("el módulo usblp no está cargado")
+	f.Fix = tr("ejecuta \"modprobe usblp\" y revisa que no esté en una lista negra de /etc/modprobe.d")
+	return f
+}
+
+// checkPrinterNodes Comprueba que hay impresoras y que se puede escribir en ellas.
+func checkPrinterNodes() []finding {
+	printers, err := findPrinters()
+	if err != nil {
+		return []finding{{Check: tr("impresoras"), Level: findingFail, Detail: err.Error()}}
+	}
+	if len(printers) == 0 {
+		return []finding{{
+			Check:  tr("impresoras"),
+			Level:  findingFail,
+			Detail: tr("no se encontraron impresoras USB en /dev/usb/lpX"),
+			Fix:    tr("revisa el cable y la alimentación, confirma con lsusb que el equipo ve la impresora y que CUPS (ippusbxd/ipp-usb) no la tiene tomada"),
+		}}
+	}
+
+	var findings []finding
+	for _, p := range printers {
+		st := checkDevice(p.Path)
+		f := finding{Check: p.Path}
+		if st.Writable {
+			f.Level = findingOK
+			f.Detail = tr("listo")
+		} else {
+			f.Level = findingWarn
+			f.Detail = st.Error
+			f.Fix = tr("ejecuta como root") + deviceGroupHint(p.Path)
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// deviceGroup Devuelve el nombre del grupo dueño del nodo, o una cadena vacía.
+func deviceGroup(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	g, err := user.LookupGroupId(strconv.Itoa(int(st.Gid)))
+	if err != nil {
+		return ""
+	}
+	return g.Name
+}
+
+// deviceGroupHint Sugiere el grupo del nodo al que hay que añadir al usuario.
+func deviceGroupHint(path string) string {
+	g := deviceGroup(path)
+	if g == "" {
+		return ""
+	}
+	return fmt.Sprintf(tr(" o agrega el usuario al grupo %s (usermod -aG %s USUARIO)"), g, g)
+}
+
+// doctorPorts Devuelve los puertos a revisar: los de las instalaciones
+// existentes o, si no hay ninguna, el puerto por defecto.
+func doctorPorts(installs []installation) map[int]*installation {
+	ports := make(map[int]*installation)
+	for i := range installs {
+		if port, err := installs[i].Port(); err == nil {
+			ports[port] = &installs[i]
+		}
+	}
+	if len(ports) == 0 {
+		ports[defaultPort] = nil
+	}
+	return ports
+}
+
+// checkPort Comprueba que el puerto está libre o que lo usa nuestro socket.
+func checkPort(port int, inst *installation, listening map[int]bool) finding {
+	f := finding{Check: fmt.Sprintf(tr("puerto %d"), port), Level: findingOK}
+	switch {
+	case inst != nil && listening[port]:
+		f.Detail = fmt.Sprintf(tr("en uso por %s.socket"), inst.Name)
+	case inst != nil:
+		f.Level = findingFail
+		f.Detail = fmt.Sprintf(tr("%s.socket está instalado pero nadie escucha en el puerto"), inst.Name)
+		f.Fix = fmt.Sprintf("systemctl status %s.socket", inst.Name)
+	case listening[port]:
+		f.Level = findingFail
+		f.Detail = tr("otro programa ya escucha en el puerto")
+		f.Fix = fmt.Sprintf(tr("identifícalo con \"ss -ltnp sport = :%d\" o instala con --port"), port)
+	default:
+		f.Detail = tr("libre")
+	}
+	return f
+}
+
+// checkFirewall Comprueba si el firewall deja pasar las conexiones al puerto.
+func checkFirewall(port int) finding {
+	f := finding{Check: fmt.Sprintf("firewall %d/tcp", port), Level: findingOK}
+	if _, err := exec.LookPath("ufw"); err == nil {
+		out, err := exec.Command("ufw", "status").CombinedOutput()
+		status := string(out)
+		switch {
+		case err != nil:
+			f.Level = findingWarn
+			f.Detail = tr("no se pudo consultar ufw: ") + strings.TrimSpace(status)
+		case !strings.Contains(status, "Status: active"):
+			f.Detail = tr("ufw inactivo")
+		case strings.Contains(status, strconv.Itoa(port)):
+			f.Detail = tr("ufw permite el puerto")
+		default:
+			f.Level = findingWarn
+			f.Detail = tr("ufw está activo y no permite el puerto")
+			f.Fix = fmt.Sprintf("ufw allow %d/tcp", port)
+		}
+		return f
+	}
+	if _, err := exec.LookPath("firewall-cmd"); err == nil {
+		if exec.Command("firewall-cmd", "--state").Run() != nil {
+			f.Detail = tr("firewalld inactivo")
+			return f
+		}
+		out, _ := exec.Command("firewall-cmd", fmt.Sprintf("--query-port=%d/tcp", port)).Output()
+		if strings.TrimSpace(string(out)) == "yes" {
+			f.Detail = tr("firewalld permite el puerto")
+			return f
+		}
+		f.Level = findingWarn
+		f.Detail = tr("firewalld está activo y no permite el puerto")
+		f.Fix = fmt.Sprintf("firewall-cmd --permanent --add-port=%d/tcp && firewall-cmd --reload", port)
+		return f
+	}
+	f.Detail = tr("no se detectó ufw ni firewalld")
+	return f
+}
+
+// runDoctor Implementa el subcomando "doctor", que revisa los requisitos de la
+// instalación y sugiere cómo corregir lo que falle. Termina con código 1 si
+// alguna comprobación falla.
+func runDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, tr("mostrar los resultados en formato JSON"))
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s doctor [--json]\n"), filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	installs, err := readInstallations()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	findings := []finding{checkSystemd(), checkUSBLP()}
+	findings = append(findings, checkPrinterNodes()...)
+	listening := make(map[int]bool)
+	for _, port := range listeningTCPPorts() {
+		listening[port] = true
+	}
+	ports := doctorPorts(installs)
+	sorted := make([]int, 0, len(ports))
+	for port := range ports {
+		sorted = append(sorted, port)
+	}
+	sort.Ints(sorted)
+	for _, port := range sorted {
+		findings = append(findings, checkPort(port, ports[port], listening), checkFirewall(port))
+	}
+
+	failed := false
+	for _, f := range findings {
+		failed = failed || f.Level == findingFail
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(findings)
+	} else {
+		marks := map[string]string{findingOK: "✓", findingWarn: "⚠", findingFail: "✗"}
+		for _, f := range findings {
+			fmt.Printf("%s %s: %s\n", marks[f.Level], f.Check, f.Detail)
+			if f.Fix != "" {
+				fmt.Printf("    → %s\n", f.Fix)
+			}
+		}
+	}
+
+	if failed {
+		os.Exit(exitFailure)
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// eposNamespace Espacio de nombres de los documentos y respuestas de ePOS-Print.
+const eposNamespace = "http://www.epson-pos.com/schemas/2011/03/epos-print"
+
+// eposDefaultDevice Identificador de la impresora que usan por defecto las
+// aplicaciones del ePOS SDK (devid=local_printer).
+const eposDefaultDevice = "local_printer"
+
+// Estado ASB de la respuesta: solo se distingue si la impresora aceptó el
+// trabajo, porque el socket no devuelve el estado real.
+const (
+	eposASBNoResponse   = 0x00000001
+	eposASBPrintSuccess = 0x00000002
+)
+
+// Códigos de error de la respuesta de ePOS-Print.
+const (
+	eposSchemaError      = "SchemaError"
+	eposDeviceNotFound   = "DeviceNotFound"
+	eposPrintSystemError = "PrintSystemError"
+)
+
+// eposElement Orden de un documento ePOS-Print, con sus atributos y su texto.
+type eposElement struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Text    string     `xml:",chardata"`
+}
+
+// attr Devuelve el valor de un atributo o una cadena vacía si no está.
+func (e eposElement) attr(name string) string {
+	for _, a := range e.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// intAttr Devuelve un atributo numérico entre min y max, o def si no está.
+func (e eposElement) intAttr(name string, def, min, max int) (int, error) {
+	v := e.attr(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf(tr("valor inválido %q en el atributo %s de <%s>"), v, name, e.XMLName.Local)
+	}
+	return n, nil
+}
+
+// choice Traduce un atributo con valores fijos; def se usa si no está.
+func (e eposElement) choice(name string, values map[string]byte, def byte) (byte, error) {
+	v := e.attr(name)
+	if v == "" {
+		return def, nil
+	}
+	b, ok := values[v]
+	if !ok {
+		return 0, fmt.Errorf(tr("valor inválido %q en el atributo %s de <%s>"), v, name, e.XMLName.Local)
+	}
+	return b, nil
+}
+
+// Valores de los atributos de ePOS-Print y su traducción a ESC/POS.
+var (
+	eposAligns   = map[string]byte{"left": alignLeft, "center": alignCenter, "right": alignRight}
+	eposBools    = map[string]byte{"false": 0, "true": 1}
+	eposFonts    = map[string]byte{"font_a": 0, "font_b": 1, "font_c": 2}
+	eposColors   = map[string]byte{"none": 0, "color_1": 0, "color_2": 1}
+	eposHRI      = map[string]byte{"none": 0, "above": 1, "below": 2, "both": 3}
+	eposQRLevels = map[string]byte{"level_l": 48, "level_m": 49, "level_q": 50, "level_h": 51, "default": 49}
+	eposQRModels = map[string]byte{"qrcode_model_1": 49, "qrcode_model_2": 50}
+	eposDrawers  = map[string]byte{"drawer_1": 0, "drawer_2": 1}
+	eposCuts     = map[string]byte{"no_feed": 49, "feed": 66, "reserve": 104}
+	// Función B de GS k: el tipo va en m y la longitud de los datos en n.
+	eposBarcodes = map[string]byte{
+		"upc_a": 65, "upc_e": 66, "ean13": 67, "jan13": 67, "ean8": 68, "jan8": 68,
+		"code39": 69, "itf": 70, "codabar": 71, "code93": 72, "code128": 73,
+	}
+	// Duración del pulso del cajón, en unidades de 2 ms de ESC p.
+	eposPulses = map[string]byte{"pulse_100": 50, "pulse_200": 100, "pulse_300": 150, "pulse_400": 200, "pulse_500": 250}
+)
+
+// eposTranslator Convierte las órdenes de un documento ePOS-Print en ESC/POS.
+// Los atributos de <text> se mantienen hasta que otra orden los cambia, como
+// en las impresoras Epson, así que hay que recordar el tamaño actual.
+type eposTranslator struct {
+	r             *receipt
+	width, height byte
+}
+
+// element Traduce una orden. Las que no se pueden imitar con un socket (modo
+// página, logotipos guardados en la impresora, zumbador) se rechazan para no
+// imprimir un recibo distinto del que la aplicación espera.
+func (t *eposTranslator) element(e eposElement) error {
+	buf := &t.r.buf
+	switch e.XMLName.Local {
+	case "text":
+		return t.text(e)
+	case "feed":
+		switch {
+		case e.attr("pos") != "":
+			return errors.New(tr("<feed pos> no está admitido"))
+		case e.attr("unit") != "":
+			n, err := e.intAttr("unit", 0, 0, 255)
+			if err != nil {
+				return err
+			}
+			buf.Write([]byte{0x1b, 0x4a, byte(n)})
+		case e.attr("line") != "":
+			n, err := e.intAttr("line", 0, 0, 255)
+			if err != nil {
+				return err
+			}
+			t.r.feed(byte(n))
+		default:
+			buf.WriteByte('\n')
+		}
+	case "cut":
+		m, err := e.choice("type", eposCuts, 66)
+		if err != nil {
+			return err
+		}
+		buf.Write([]byte{0x1d, 0x56, m})
+		if m != 49 {
+			buf.WriteByte(0)
+		}
+	case "pulse":
+		m, err := e.choice("drawer", eposDrawers, 0)
+		if err != nil {
+			return err
+		}
+		on, err := e.choice("time", eposPulses, 50)
+		if err != nil {
+			return err
+		}
+		buf.Write([]byte{0x1b, 0x70, m, on, on})
+	case "barcode":
+		return t.barcode(e)
+	case "symbol":
+		return t.symbol(e)
+	case "image":
+		return t.image(e)
+	case "command":
+		data, err := hex.DecodeString(strings.Join(strings.Fields(e.Text), ""))
+		if err != nil {
+			return fmt.Errorf(tr("<command> no es hexadecimal: %w"), err)
+		}
+		buf.Write(data)
+	default:
+		return fmt.Errorf(tr("la orden <%s> no está admitida"), e.XMLName.Local)
+	}
+	return nil
+}
+
+// text Aplica los atributos de <text> y escribe su contenido en PC850.
+func (t *eposTranslator) text(e eposElement) error {
+	buf := &t.r.buf
+	for _, a := range []struct {
+		name   string
+		values map[string]byte
+		cmd    []byte
+	}{
+		{"align", eposAligns, []byte{0x1b, 0x61}},
+		{"font", eposFonts, []byte{0x1b, 0x4d}},
+		{"smooth", eposBools, []byte{0x1d, 0x62}},
+		{"em", eposBools, []byte{0x1b, 0x45}},
+		{"ul", eposBools, []byte{0x1b, 0x2d}},
+		{"reverse", eposBools, []byte{0x1d, 0x42}},
+		{"color", eposColors, []byte{0x1b, 0x72}},
+	} {
+		if e.attr(a.name) == "" {
+			continue
+		}
+		n, err := e.choice(a.name, a.values, 0)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(a.cmd, n))
+	}
+
+	resize := false
+	for _, a := range []struct {
+		name   string
+		double string
+		size   *byte
+	}{
+		{"width", "dw", &t.width},
+		{"height", "dh", &t.height},
+	} {
+		if e.attr(a.name) != "" {
+			n, err := e.intAttr(a.name, 1, 1, 8)
+			if err != nil {
+				return err
+			}
+			*a.size, resize = byte(n), true
+		}
+		if e.attr(a.double) != "" {
+			on, err := e.choice(a.double, eposBools, 0)
+			if err != nil {
+				return err
+			}
+			*a.size, resize = 1+on, true
+		}
+	}
+	if resize {
+		t.r.size(t.width, t.height)
+	}
+
+	if e.attr("linespc") != "" {
+		n, err := e.intAttr("linespc", 0, 0, 255)
+		if err != nil {
+			return err
+		}
+		buf.Write([]byte{0x1b, 0x33, byte(n)})
+	}
+	if e.attr("x") != "" {
+		x, err := e.intAttr("x", 0, 0, 65535)
+		if err != nil {
+			return err
+		}
+		buf.Write([]byte{0x1b, 0x24, byte(x), byte(x >> 8)})
+	}
+	t.r.text(e.Text)
+	return nil
+}
+
+// barcode Imprime un código de barras con GS k (función B).
+func (t *eposTranslator) barcode(e eposElement) error {
+	m, ok := eposBarcodes[e.attr("type")]
+	if !ok {
+		return fmt.Errorf(tr("tipo de código de barras no admitido %q"), e.attr("type"))
+	}
+	hri, err := e.choice("hri", eposHRI, 0)
+	if err != nil {
+		return err
+	}
+	font, err := e.choice("font", eposFonts, 0)
+	if err != nil {
+		return err
+	}
+	width, err := e.intAttr("width", 3, 2, 6)
+	if err != nil {
+		return err
+	}
+	height, err := e.intAttr("height", 162, 1, 255)
+	if err != nil {
+		return err
+	}
+	if len(e.Text) == 0 || len(e.Text) > 255 {
+		return errors.New(tr("los datos del código de barras deben tener entre 1 y 255 caracteres"))
+	}
+	buf := &t.r.buf
+	buf.Write([]byte{0x1d, 0x48, hri, 0x1d, 0x66, font, 0x1d, 0x77, byte(width), 0x1d, 0x68, byte(height)})
+	buf.Write([]byte{0x1d, 0x6b, m, byte(len(e.Text))})
+	buf.WriteString(e.Text)
+	return nil
+}
+
+// symbol Imprime un código QR con GS ( k. Los demás símbolos bidimensionales
+// (PDF417, MaxiCode, GS1 DataBar) no están admitidos.
+func (t *eposTranslator) symbol(e eposElement) error {
+	model, ok := eposQRModels[e.attr("type")]
+	if !ok {
+		return fmt.Errorf(tr("tipo de símbolo no admitido %q"), e.attr("type"))
+	}
+	level, err := e.choice("level", eposQRLevels, 49)
+	if err != nil {
+		return err
+	}
+	module, err := e.intAttr("width", 3, 1, 16)
+	if err != nil {
+		return err
+	}
+	if len(e.Text) == 0 || len(e.Text) > 7089 {
+		return errors.New(tr("los datos del código QR deben tener entre 1 y 7089 caracteres"))
+	}
+	n := len(e.Text) + 3
+	buf := &t.r.buf
+	buf.Write([]byte{0x1d, 0x28, 0x6b, 0x04, 0x00, 0x31, 0x41, model, 0x00})
+	buf.Write([]byte{0x1d, 0x28, 0x6b, 0x03, 0x00, 0x31, 0x43, byte(module)})
+	buf.Write([]byte{0x1d, 0x28, 0x6b, 0x03, 0x00, 0x31, 0x45, level})
+	buf.Write([]byte{0x1d, 0x28, 0x6b, byte(n), byte(n >> 8), 0x31, 0x50, 0x30})
+	buf.WriteString(e.Text)
+	buf.Write([]byte{0x1d, 0x28, 0x6b, 0x03, 0x00, 0x31, 0x51, 0x30})
+	return nil
+}
+
+// image Imprime una imagen monocroma con GS v 0. El contenido es la imagen
+// en base64, una fila tras otra y un bit por punto, como la genera el SDK.
+func (t *eposTranslator) image(e eposElement) error {
+	if mode := e.attr("mode"); mode != "" && mode != "mono" {
+		return fmt.Errorf(tr("modo de imagen no admitido %q"), mode)
+	}
+	width, err := e.intAttr("width", 0, 1, 65535)
+	if err != nil {
+		return err
+	}
+	height, err := e.intAttr("height", 0, 1, 65535)
+	if err != nil {
+		return err
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(e.Text), ""))
+	if err != nil {
+		return fmt.Errorf(tr("la imagen no está en base64: %w"), err)
+	}
+	row := (width + 7) / 8
+	if len(data) != row*height {
+		return fmt.Errorf(tr("la imagen tiene %d bytes y deberían ser %d"), len(data), row*height)
+	}
+	align, err := e.choice("align", eposAligns, alignLeft)
+	if err != nil {
+		return err
+	}
+	buf := &t.r.buf
+	t.r.align(align)
+	buf.Write([]byte{0x1d, 0x76, 0x30, 0x00, byte(row), byte(row >> 8), byte(height), byte(height >> 8)})
+	buf.Write(data)
+	return nil
+}
+
+// translateEPOS Busca el elemento epos-print del sobre SOAP y convierte sus
+// órdenes en ESC/POS.
+func translateEPOS(body io.Reader) ([]byte, error) {
+	d := xml.NewDecoder(io.LimitReader(body, maxTextJob))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil, errors.New(tr("el documento no contiene <epos-print>"))
+		}
+		if err != nil {
+			return nil, fmt.Errorf(tr("documento ePOS-Print inválido: %w"), err)
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "epos-print" {
+			break
+		}
+	}
+
+	t := &eposTranslator{r: newReceipt(), width: 1, height: 1}
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, fmt.Errorf(tr("documento ePOS-Print inválido: %w"), err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			var e eposElement
+			if err := d.DecodeElement(&e, &tok); err != nil {
+				return nil, fmt.Errorf(tr("documento ePOS-Print inválido: %w"), err)
+			}
+			if err := t.element(e); err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			return t.r.Bytes(), nil
+		}
+	}
+}
+
+// writeEPOSResponse Contesta con el sobre SOAP de ePOS-Print. Los errores
+// también van con el estado 200, en el atributo code, como en las impresoras.
+func writeEPOSResponse(w http.ResponseWriter, code string) {
+	status := eposASBPrintSuccess
+	if code != "" {
+		status = eposASBNoResponse
+	}
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>`+
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`+
+		`<response success="%t" code="%s" status="%d" battery="0" xmlns="%s"/>`+
+		`</s:Body></s:Envelope>`, code == "", code, status, eposNamespace)
+}
+
+// serveEPOS Atiende POST /cgi-bin/epos/service.cgi, el servicio ePOS-Print de
+// las impresoras Epson inteligentes, para que las aplicaciones hechas con el
+// ePOS SDK impriman sin cambios. El SDK de JavaScript llama desde el
+// navegador, así que se permiten peticiones de cualquier origen.
+func (s *apiServer) serveEPOS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, SOAPAction, If-Modified-Since")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if dev := r.URL.Query().Get("devid"); dev != "" && dev != eposDefaultDevice && dev != s.name {
+		logger.Warn(fmt.Sprintf(tr("Trabajo ePOS-Print de %s para la impresora desconocida %q"), r.RemoteAddr, dev), "client", r.RemoteAddr)
+		writeEPOSResponse(w, eposDeviceNotFound)
+		return
+	}
+	data, err := translateEPOS(r.Body)
+	if err != nil {
+		logger.Warn(fmt.Sprintf(tr("Trabajo ePOS-Print de %s rechazado: %v"), r.RemoteAddr, err), "client", r.RemoteAddr)
+		writeEPOSResponse(w, eposSchemaError)
+		return
+	}
+	if job := s.print(bytes.NewReader(data), r); job.Status == jobFailed {
+		writeEPOSResponse(w, eposPrintSystemError)
+		return
+	}
+	writeEPOSResponse(w, "")
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// Alineaciones de ESC a n.
+const (
+	alignLeft   = 0
+	alignCenter = 1
+	alignRight  = 2
+)
+
+// cp850 Traduce los caracteres del español que no están en ASCII a la tabla
+// PC850, que se selecciona al inicio de cada recibo con ESC t 2.
+var cp850 = map[rune]byte{
+	'á': 0xa0, 'é': 0x82, 'í': 0xa1, 'ó': 0xa2, 'ú': 0xa3,
+	'Á': 0xb5, 'É': 0x90, 'Í': 0xd6, 'Ó': 0xe0, 'Ú': 0xe9,
+	'ñ': 0xa4, 'Ñ': 0xa5, 'ü': 0x81, 'Ü': 0x9a,
+	'¿': 0xa8, '¡': 0xad, '°': 0xf8,
+}
+
+// receipt Construye un recibo con comandos ESC/POS.
+type receipt struct {
+	buf bytes.Buffer
+}
+
+// newReceipt Crea un recibo que empieza inicializando la impresora (ESC @)
+// y seleccionando la tabla de caracteres PC850 (ESC t 2).
+func newReceipt() *receipt {
+	r := &receipt{}
+	r.buf.Write([]byte{0x1b, 0x40, 0x1b, 0x74, 0x02})
+	return r
+}
+
+// text Escribe texto convirtiéndolo a PC850. Los caracteres que no existen
+// en la tabla se sustituyen por '?'.
+func (r *receipt) text(s string) *receipt {
+	for _, c := range s {
+		switch {
+		case c < 0x80:
+			r.buf.WriteByte(byte(c))
+		case cp850[c] != 0:
+			r.buf.WriteByte(cp850[c])
+		default:
+			r.buf.WriteByte('?')
+		}
+	}
+	return r
+}
+
+// line Escribe una línea de texto terminada en salto de línea.
+func (r *receipt) line(s string) *receipt {
+	return r.text(s + "\n")
+}
+
+// align Selecciona la alineación (ESC a n).
+func (r *receipt) align(a byte) *receipt {
+	r.buf.Write([]byte{0x1b, 0x61, a})
+	return r
+}
+
+// bold Activa o desactiva la negrita (ESC E n).
+func (r *receipt) bold(on bool) *receipt {
+	var n byte
+	if on {
+		n = 1
+	}
+	r.buf.Write([]byte{0x1b, 0x45, n})
+	return r
+}
+
+// size Selecciona el tamaño de los caracteres (GS ! n), de 1 a 8 veces en cada eje.
+func (r *receipt) size(width, height byte) *receipt {
+	r.buf.Write([]byte{0x1d, 0x21, (width-1)<<4 | (height - 1)})
+	return r
+}
+
+// feed Avanza el papel n líneas (ESC d n).
+func (r *receipt) feed(n byte) *receipt {
+	r.buf.Write([]byte{0x1b, 0x64, n})
+	return r
+}
+
+// qr Imprime un código QR modelo 2 con el tamaño de módulo indicado (1-16)
+// y corrección de errores M, usando los comandos GS ( k.
+func (r *receipt) qr(data string, moduleSize byte) *receipt {
+	n := len(data) + 3
+	r.buf.Write([]byte{0x1d, 0x28, 0x6b, 0x04, 0x00, 0x31, 0x41, 0x32, 0x00}) // Modelo 2
+	r.buf.Write([]byte{0x1d, 0x28, 0x6b, 0x03, 0x00, 0x31, 0x43, moduleSize}) // Tamaño del módulo
+	r.buf.Write([]byte{0x1d, 0x28, 0x6b, 0x03, 0x00, 0x31, 0x45, 0x31})       // Corrección M
+	r.buf.Write([]byte{0x1d, 0x28, 0x6b, byte(n), byte(n >> 8), 0x31, 0x50, 0x30})
+	r.buf.WriteString(data)
+	r.buf.Write([]byte{0x1d, 0x28, 0x6b, 0x03, 0x00, 0x31, 0x51, 0x30}) // Imprime el símbolo
+	return r
+}
+
+// cut Avanza el papel hasta el cortador y hace un corte parcial (GS V 66 n).
+func (r *receipt) cut() *receipt {
+	r.buf.Write([]byte{0x1d, 0x56, 0x42, 0x00})
+	return r
+}
+
+// Bytes Devuelve el recibo completo.
+func (r *receipt) Bytes() []byte {
+	return r.buf.Bytes()
+}
+
+// writeToDevice Envía datos directamente al nodo de la impresora.
+func writeToDevice(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf(tr("error al abrir la impresora %s: %w"), path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf(tr("error al escribir en la impresora %s: %w"), path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf(tr("error al cerrar la impresora %s: %w"), path, err)
+	}
+	return nil
+}
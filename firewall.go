@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Firewalls que la instalación sabe configurar.
+const (
+	firewallUFW       = "ufw"
+	firewallFirewalld = "firewalld"
+)
+
+// firewallDir Directorio en el que se anotan las reglas que abrió la
+// instalación, para quitar exactamente esas al desinstalar y no las que el
+// administrador ya tuviera.
+const firewallDir = "/etc/escpos-printer/firewall"
+
+// firewallStatePath Devuelve el archivo con las reglas de un socket.
+func firewallStatePath(name string) string {
+	return filepath.Join(firewallDir, name+".rules")
+}
+
+// detectFirewall Devuelve el firewall activo (firewallUFW o
+// firewallFirewalld), o una cadena vacía si no hay ninguno activo.
+func detectFirewall() string {
+	if _, err := exec.LookPath("ufw"); err == nil {
+		out, err := exec.Command("ufw", "status").CombinedOutput()
+		if err == nil && strings.Contains(string(out), "Status: active") {
+			return firewallUFW
+		}
+	}
+	if _, err := exec.LookPath("firewall-cmd"); err == nil {
+		if exec.Command("firewall-cmd", "--state").Run() == nil {
+			return firewallFirewalld
+		}
+	}
+	return ""
+}
+
+// firewallRule Regla que deja pasar las conexiones a un puerto TCP, desde
+// todas partes o solo desde una dirección o red.
+type firewallRule struct {
+	Tool   string // firewallUFW o firewallFirewalld
+	Port   int
+	Source string // Dirección o red CIDR, vacía para cualquier origen
+}
+
+// String Devuelve la regla como una línea del archivo de reglas.
+func (r firewallRule) String() string {
+	return strings.TrimSpace(fmt.Sprintf("%s %d %s", r.Tool, r.Port, r.Source))
+}
+
+// richRule Devuelve la regla enriquecida de firewalld para un origen concreto.
+func (r firewallRule) richRule() string {
+	family := "ipv4"
+	if strings.Contains(r.Source, ":") {
+		family = "ipv6"
+	}
+	return fmt.Sprintf(`rule family="%s" source address="%s" port port="%d" protocol="tcp" accept`, family, r.Source, r.Port)
+}
+
+// openArgs Devuelve el comando que abre el puerto. En firewalld la regla es
+// permanente y se aplica con firewall-cmd --reload.
+func (r firewallRule) openArgs() []string {
+	port := strconv.Itoa(r.Port)
+	switch {
+	case r.Tool == firewallUFW && r.Source == "":
+		return []string{"ufw", "allow", port + "/tcp"}
+	case r.Tool == firewallUFW:
+		return []string{"ufw", "allow", "proto", "tcp", "from", r.Source, "to", "any", "port", port}
+	case r.Source == "":
+		return []string{"firewall-cmd", "--permanent", "--add-port=" + port + "/tcp"}
+	}
+	return []string{"firewall-cmd", "--permanent", "--add-rich-rule=" + r.richRule()}
+}
+
+// closeArgs Devuelve el comando que quita la regla.
+func (r firewallRule) closeArgs() []string {
+	args := r.openArgs()
+	if r.Tool == firewallUFW {
+		return append([]string{"ufw", "delete"}, args[1:]...)
+	}
+	args[2] = strings.Replace(args[2], "--add-", "--remove-", 1)
+	return args
+}
+
+// parseFirewallRules Lee el archivo de reglas: una regla "HERRAMIENTA PUERTO
+// [ORIGEN]" por línea. Las líneas que no se entienden se ignoran.
+func parseFirewallRules(content string) []firewallRule {
+	var rules []firewallRule
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || (fields[0] != firewallUFW && fields[0] != firewallFirewalld) {
+			continue
+		}
+		port, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		rule := firewallRule{Tool: fields[0], Port: port}
+		if len(fields) > 2 {
+			rule.Source = fields[2]
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// exposedTCP Indica si el socket escucha en TCP en alguna dirección que no es
+// de loopback; solo esas conexiones pasan por el firewall.
+func (opts installOptions) exposedTCP() bool {
+	if !opts.listensTCP() {
+		return false
+	}
+	for _, host := range bindHosts(opts.Bind) {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return true
+		}
+	}
+	return false
+}
+
+// firewallRules Devuelve las reglas que abren el puerto del socket: una por
+// cada red de --allow o, sin --allow, una para cualquier origen.
+func firewallRules(opts installOptions, tool string) []firewallRule {
+	if !opts.exposedTCP() {
+		return nil
+	}
+	sources := opts.AllowFrom
+	if len(sources) == 0 {
+		sources = []string{""}
+	}
+	var rules []firewallRule
+	for _, source := range sources {
+		rules = append(rules, firewallRule{Tool: tool, Port: opts.Port, Source: source})
+	}
+	return rules
+}
+
+// firewallFileContent Devuelve el archivo de reglas del socket.
+func firewallFileContent(rules []firewallRule) string {
+	var b strings.Builder
+	b.WriteString("# Reglas de firewall abiertas por escpos-socket-install; se quitan al desinstalar.\n")
+	for _, rule := range rules {
+		b.WriteString(rule.String() + "\n")
+	}
+	return b.String()
+}
+
+// runtimeArgs Devuelve el comando sin --permanent, que en firewalld cambia
+// las reglas activas en el momento en lugar de las que carga --reload.
+func runtimeArgs(args []string) []string {
+	var runtime []string
+	for _, arg := range args {
+		if arg != "--permanent" {
+			runtime = append(runtime, arg)
+		}
+	}
+	return runtime
+}
+
+// revertArgs Devuelve los comandos que deshacen el de abrir la regla (open)
+// o el de quitarla. En firewalld se cambian también las reglas activas: la
+// instalación que falla puede haber ejecutado ya firewall-cmd --reload.
+func (r firewallRule) revertArgs(open bool) [][]string {
+	revert := r.openArgs()
+	if open {
+		revert = r.closeArgs()
+	}
+	if r.Tool == firewallUFW {
+		return [][]string{revert}
+	}
+	return [][]string{revert, runtimeArgs(revert)}
+}
+
+// firewallCommands Devuelve los comandos que dejan el firewall como piden
+// las reglas: quita las anotadas en una instalación anterior que ya no se
+// necesitan y abre las nuevas. Solo se ejecutan si el archivo de reglas cambia.
+// Anota en el plan cómo deshacer cada uno: el archivo de reglas se restaura
+// si la instalación falla, y el firewall tiene que quedar como dice.
+func firewallCommands(plan *installPlan, path string, rules []firewallRule) []plannedCommand {
+	wanted := make(map[string]bool)
+	for _, rule := range rules {
+		wanted[rule.String()] = true
+	}
+	var cmds []plannedCommand
+	reload := false
+	if old, err := os.ReadFile(path); err == nil {
+		for _, rule := range parseFirewallRules(string(old)) {
+			if !wanted[rule.String()] {
+				cmd := plannedCommand{rule.closeArgs(), []string{path}}
+				plan.undoWith(cmd, rule.revertArgs(false)...)
+				cmds = append(cmds, cmd)
+				reload = reload || rule.Tool == firewallFirewalld
+			}
+		}
+	}
+	for _, rule := range rules {
+		cmd := plannedCommand{rule.openArgs(), []string{path}}
+		plan.undoWith(cmd, rule.revertArgs(true)...)
+		cmds = append(cmds, cmd)
+		reload = reload || rule.Tool == firewallFirewalld
+	}
+	if reload {
+		cmds = append(cmds, plannedCommand{[]string{"firewall-cmd", "--reload"}, []string{path}})
+	}
+	return cmds
+}
+
+// askFirewall Si hay un firewall activo, ofrece abrir los puertos de las
+// impresoras que escuchan en la red. Sin la regla la instalación termina
+// bien pero los puntos de venta no pueden conectar.
+func askFirewall(list []installOptions) {
+	exposed := false
+	for _, opts := range list {
+		exposed = exposed || (opts.exposedTCP() && !opts.OpenFirewall)
+	}
+	if !exposed || userMode {
+		return
+	}
+	tool := detectFirewall()
+	if tool == "" {
+		return
+	}
+	if !askYesNo(fmt.Sprintf(tr("%s está activo y bloquearía las conexiones. ¿Abrir los puertos de las impresoras?"), tool), true) {
+		return
+	}
+	for i := range list {
+		list[i].OpenFirewall = true
+	}
+}
+
+// firewallUninstallCommands Devuelve los comandos que quitan las reglas que
+// abrió la instalación del socket, según su archivo de reglas.
+func firewallUninstallCommands(name string) [][]string {
+	data, err := os.ReadFile(firewallStatePath(name))
+	if err != nil {
+		return nil
+	}
+	var cmds [][]string
+	reload := false
+	for _, rule := range parseFirewallRules(string(data)) {
+		cmds = append(cmds, rule.closeArgs())
+		reload = reload || rule.Tool == firewallFirewalld
+	}
+	if reload {
+		cmds = append(cmds, []string{"firewall-cmd", "--reload"})
+	}
+	return cmds
+}
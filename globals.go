@@ -0,0 +1,52 @@
+package main
+
+import "strings"
+
+// globalFlags Opciones que valen para todos los subcomandos y se pueden
+// escribir en cualquier posición: --lang, --verbose, --quiet, --log-format y
+// --user.
+type globalFlags struct {
+	Lang      string
+	Verbose   bool
+	Quiet     bool
+	LogFormat string
+	User      bool
+}
+
+// extractGlobalFlags Quita las opciones globales de los argumentos. Devuelve
+// sus valores y el resto de argumentos para el subcomando. Lo que sigue a
+// "--" no se toca.
+func extractGlobalFlags(args []string) (globalFlags, []string) {
+	var g globalFlags
+	values := map[string]*string{"lang": &g.Lang, "log-format": &g.LogFormat}
+	bools := map[string]*bool{"verbose": &g.Verbose, "v": &g.Verbose, "quiet": &g.Quiet, "q": &g.Quiet, "user": &g.User}
+
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return g, append(rest, args[i:]...)
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") {
+			rest = append(rest, arg)
+			continue
+		}
+		if dst, ok := values[name]; ok {
+			switch {
+			case hasValue:
+				*dst = value
+			case i+1 < len(args):
+				*dst = args[i+1]
+				i++
+			}
+			continue
+		}
+		if dst, ok := bools[name]; ok && !hasValue {
+			*dst = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return g, rest
+}
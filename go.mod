@@ -1,3 +1,5 @@
 module github.com/henrietto13/epson-tmx-socket-install
 
 go 1.24.6
+
+require gopkg.in/yaml.v3 v3.0.1
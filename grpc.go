@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Códigos de estado de gRPC.
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcNotFound        = 5
+	grpcUnimplemented   = 12
+	grpcInternal        = 13
+	grpcUnavailable     = 14
+)
+
+// grpcWatchInterval Cada cuánto comprueba WatchPrinter el estado de la impresora.
+const grpcWatchInterval = 2 * time.Second
+
+// grpcError Error con su código de gRPC.
+type grpcError struct {
+	code int
+	err  error
+}
+
+func (e grpcError) Error() string { return e.err.Error() }
+
+// protoField Campo de un mensaje de protocol buffers recibido.
+type protoField struct {
+	num   int
+	value []byte // Valor de los campos de longitud variable
+	n     uint64 // Valor de los campos varint
+}
+
+// parseProto Lee los campos de un mensaje. Solo admite los tipos varint y de
+// longitud variable, los únicos que usan los mensajes de escpos.proto.
+func parseProto(msg []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(msg) > 0 {
+		tag, k := binary.Uvarint(msg)
+		if k <= 0 {
+			return nil, errors.New(tr("mensaje protobuf inválido"))
+		}
+		msg = msg[k:]
+		f := protoField{num: int(tag >> 3)}
+		switch tag & 7 {
+		case 0:
+			f.n, k = binary.Uvarint(msg)
+			if k <= 0 {
+				return nil, errors.New(tr("mensaje protobuf inválido"))
+			}
+			msg = msg[k:]
+		case 2:
+			size, k := binary.Uvarint(msg)
+			if k <= 0 || size > uint64(len(msg)-k) {
+				return nil, errors.New(tr("mensaje protobuf inválido"))
+			}
+			f.value, msg = msg[k:k+int(size)], msg[k+int(size):]
+		default:
+			return nil, fmt.Errorf(tr("tipo de campo protobuf no admitido %d"), tag&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// protoBuilder Codifica un mensaje de protocol buffers. Los valores por
+// defecto (cero, vacío) no se escriben, como en proto3.
+type protoBuilder struct {
+	buf []byte
+}
+
+func (b *protoBuilder) varint(num int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.buf = binary.AppendUvarint(b.buf, uint64(num)<<3)
+	b.buf = binary.AppendUvarint(b.buf, v)
+}
+
+func (b *protoBuilder) bytes(num int, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	b.buf = binary.AppendUvarint(b.buf, uint64(num)<<3|2)
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(v)))
+	b.buf = append(b.buf, v...)
+}
+
+func (b *protoBuilder) string(num int, v string) { b.bytes(num, []byte(v)) }
+
+func (b *protoBuilder) bool(num int, v bool) {
+	if v {
+		b.varint(num, 1)
+	}
+}
+
+// encodeJob Codifica un trabajo como el mensaje Job.
+func encodeJob(job apiJob) []byte {
+	var b protoBuilder
+	b.varint(1, uint64(job.ID))
+	b.string(2, job.Printer)
+	b.string(3, job.Status)
+	b.varint(4, uint64(job.Bytes))
+	b.string(5, job.Error)
+	b.varint(6, uint64(job.Received.Unix()))
+	return b.buf
+}
+
+// apiPrinterStatus Estado de la impresora que devuelven GetStatus y WatchPrinter.
+type apiPrinterStatus struct {
+	Online  bool
+	Error   string
+	LastJob *apiJob
+}
+
+// encodePrinterStatus Codifica el estado como el mensaje PrinterStatus.
+func encodePrinterStatus(name string, st apiPrinterStatus) []byte {
+	var b protoBuilder
+	b.string(1, name)
+	b.bool(2, st.Online)
+	b.string(3, st.Error)
+	if st.LastJob != nil {
+		b.bytes(4, encodeJob(*st.LastJob))
+	}
+	return b.buf
+}
+
+// currentStatus Comprueba la impresora y devuelve su estado con el último trabajo.
+func (s *apiServer) currentStatus() apiPrinterStatus {
+	dev := s.check()
+	st := apiPrinterStatus{Online: dev.Writable, Error: dev.Error}
+	s.mu.Lock()
+	if len(s.jobs) > 0 {
+		last := s.jobs[len(s.jobs)-1]
+		st.LastJob = &last
+	}
+	s.mu.Unlock()
+	return st
+}
+
+// readGRPCMessage Lee el único mensaje de una llamada. Los mensajes
+// comprimidos se rechazan: el servidor no anuncia ninguna compresión.
+func readGRPCMessage(r io.Reader) ([]protoField, error) {
+	var head [5]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, grpcError{grpcInvalidArgument, fmt.Errorf(tr("mensaje gRPC incompleto: %w"), err)}
+	}
+	if head[0] != 0 {
+		return nil, grpcError{grpcInvalidArgument, errors.New(tr("los mensajes gRPC comprimidos no están admitidos"))}
+	}
+	size := binary.BigEndian.Uint32(head[1:])
+	if size > maxWebSocketMessage {
+		return nil, grpcError{grpcInvalidArgument, fmt.Errorf(tr("el mensaje supera %d bytes"), maxWebSocketMessage)}
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, grpcError{grpcInvalidArgument, fmt.Errorf(tr("mensaje gRPC incompleto: %w"), err)}
+	}
+	fields, err := parseProto(msg)
+	if err != nil {
+		return nil, grpcError{grpcInvalidArgument, err}
+	}
+	return fields, nil
+}
+
+// writeGRPCMessage Envía un mensaje de la respuesta y lo despacha enseguida,
+// para que los mensajes de WatchPrinter lleguen según se producen.
+func writeGRPCMessage(w http.ResponseWriter, msg []byte) error {
+	head := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(msg)))
+	if _, err := w.Write(append(head, msg...)); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// serveGRPC Atiende las llamadas a escpos.v1.Printer. Todas las peticiones
+// llevan en el campo 1 el nombre de la impresora.
+func (s *apiServer) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		writeAPIError(w, http.StatusUnsupportedMediaType, errors.New(tr("las llamadas gRPC necesitan HTTP/2 y Content-Type application/grpc")))
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+	err := s.callGRPC(w, r)
+	status, message := grpcOK, ""
+	if err != nil {
+		status, message = grpcInternal, err.Error()
+		var gerr grpcError
+		if errors.As(err, &gerr) {
+			status = gerr.code
+		}
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(status))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", grpcPercentEncode(message))
+	}
+}
+
+// callGRPC Ejecuta el método pedido.
+func (s *apiServer) callGRPC(w http.ResponseWriter, r *http.Request) error {
+	fields, err := readGRPCMessage(r.Body)
+	if err != nil {
+		return err
+	}
+	var name string
+	var data []byte
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			name = string(f.value)
+		case 2:
+			data = f.value
+		}
+	}
+	if name != s.name {
+		return grpcError{grpcNotFound, fmt.Errorf(tr("impresora desconocida %q (esta API atiende %q)"), name, s.name)}
+	}
+
+	switch method := r.PathValue("method"); method {
+	case "SubmitJob":
+		// Un fallo de la impresora no es un error de la llamada: el trabajo
+		// se devuelve con el estado failed, como en la API HTTP.
+		return writeGRPCMessage(w, encodeJob(s.print(bytes.NewReader(data), r)))
+	case "GetStatus":
+		return writeGRPCMessage(w, encodePrinterStatus(s.name, s.currentStatus()))
+	case "WatchPrinter":
+		var last []byte
+		ticker := time.NewTicker(grpcWatchInterval)
+		defer ticker.Stop()
+		for {
+			if msg := encodePrinterStatus(s.name, s.currentStatus()); !bytes.Equal(msg, last) {
+				if err := writeGRPCMessage(w, msg); err != nil {
+					return grpcError{grpcUnavailable, err}
+				}
+				last = msg
+			}
+			select {
+			case <-r.Context().Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	default:
+		return grpcError{grpcUnimplemented, fmt.Errorf(tr("método gRPC desconocido %q"), method)}
+	}
+}
+
+// grpcPercentEncode Codifica grpc-message como pide gRPC: los bytes que no
+// son ASCII imprimible, y '%', van como %XX.
+func grpcPercentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c > 0x7E || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
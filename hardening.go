@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// commonHardening Directivas de aislamiento que admite el servicio de toda
+// impresora: el proceso solo necesita leer la conexión y escribir en la
+// impresora, en lp o en la red.
+var commonHardening = []string{
+	"NoNewPrivileges=yes",
+	"PrivateTmp=yes",
+	"ProtectSystem=strict",
+	"ProtectHome=yes",
+	"ProtectHostname=yes",
+	"ProtectClock=yes",
+	"ProtectKernelTunables=yes",
+	"ProtectKernelModules=yes",
+	"ProtectKernelLogs=yes",
+	"ProtectControlGroups=yes",
+	"RestrictNamespaces=yes",
+	"RestrictRealtime=yes",
+	"RestrictSUIDSGID=yes",
+	"LockPersonality=yes",
+	"MemoryDenyWriteExecute=yes",
+	"SystemCallArchitectures=native",
+}
+
+// hardeningDirectives Devuelve las directivas de aislamiento del servicio.
+// Con un dispositivo solo se permite el nodo de la impresora (DeviceAllow=
+// implica DevicePolicy=closed); con CUPS o una impresora de red no se
+// necesita ninguno. Las familias de sockets se limitan a las que usa cada
+// modo: AF_UNIX para el registro y, si hace falta, la red. El socket que
+// entrega systemd no cuenta, porque ya está creado. Con AppArmor activo se
+// añade además el perfil de la impresora. Solo se puede escribir en los
+// directorios del archivo y de la cola de trabajos, si se usan.
+func hardeningDirectives(opts installOptions) string {
+	// El gestor de un usuario no puede aplicar la mayoría de estas
+	// directivas: DeviceAllow= y los Protect* necesitan privilegios.
+	if opts.NoHardening || userMode {
+		return ""
+	}
+	lines := append([]string{}, commonHardening...)
+	switch {
+	case opts.CUPSQueue != "", opts.Printer.Kind == kindNetwork:
+		lines = append(lines, "PrivateDevices=yes", "RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6")
+	default:
+		// rw: stty también lee la configuración del puerto serie. Las
+		// métricas del daemon necesitan su propio socket TCP.
+		families := "AF_UNIX"
+		if opts.Metrics != "" {
+			families += " AF_INET AF_INET6"
+		}
+		lines = append(lines, fmt.Sprintf("DeviceAllow=%s rw", opts.devicePath()), "RestrictAddressFamilies="+families)
+		if opts.USBResetOnHang {
+			// El reinicio se hace sobre el nodo /dev/bus/usb del dispositivo.
+			lines = append(lines, "DeviceAllow=char-usb_device rw")
+		}
+	}
+	if dirs := opts.writableDirs(); len(dirs) > 0 {
+		// ProtectSystem=strict deja el resto del sistema en solo lectura.
+		lines = append(lines, "ReadWritePaths="+strings.Join(dirs, " "))
+	}
+	if opts.confinedByAppArmor() {
+		lines = append(lines, "AppArmorProfile="+apparmorProfileName(opts.unitName()))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// writableDirs Devuelve los directorios en los que escribe el servicio: el
+// archivo y la cola de trabajos, si se usan. planInstall los crea.
+func (opts installOptions) writableDirs() []string {
+	var dirs []string
+	if opts.Archive != nil {
+		dirs = append(dirs, opts.archiveDir())
+	}
+	if opts.Spool != nil {
+		dirs = append(dirs, opts.spoolDir())
+	}
+	return dirs
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// lpGetStatus Código ioctl LPGETSTATUS de linux/lp.h. usblp y el controlador
+// del puerto paralelo responden con las líneas de estado de la impresora.
+const lpGetStatus = 0x060b
+
+// Líneas de estado de LPGETSTATUS (LP_PERRORP, LP_PSELECD y LP_POUTPA).
+const (
+	lpStatusNoError  = 0x08 // Activa cuando la impresora no tiene ningún error
+	lpStatusSelected = 0x10 // En línea
+	lpStatusPaperOut = 0x20
+)
+
+// printerCondition Estado que informa la propia impresora.
+type printerCondition struct {
+	Busy      bool `json:"busy,omitempty"` // Imprimiendo: el nodo solo se puede abrir una vez
+	Online    bool `json:"online"`
+	PaperOut  bool `json:"paper_out"`
+	CoverOpen bool `json:"cover_open"` // Solo con DLE EOT; LPGETSTATUS la informa como Error
+	Error     bool `json:"error"`      // Atasco, error del cortador u otro error de la impresora
+}
+
+// ok Indica si la impresora puede imprimir. Sin estado (nil) se da por buena:
+// algunas impresoras no responden a DLE EOT y sus nodos no admiten
+// LPGETSTATUS.
+func (c *printerCondition) ok() bool {
+	return c == nil || c.Busy || (c.Online && !c.PaperOut && !c.CoverOpen && !c.Error)
+}
+
+// String Resume el estado para status: lo que impide imprimir o "lista".
+func (c *printerCondition) String() string {
+	if c.Busy {
+		return tr("imprimiendo")
+	}
+	var problems []string
+	if !c.Online {
+		problems = append(problems, tr("fuera de línea"))
+	}
+	if c.PaperOut {
+		problems = append(problems, tr("sin papel"))
+	}
+	if c.CoverOpen {
+		problems = append(problems, tr("tapa abierta"))
+	}
+	if c.Error {
+		problems = append(problems, tr("con un error"))
+	}
+	if len(problems) == 0 {
+		return tr("lista")
+	}
+	return strings.Join(problems, ", ")
+}
+
+// readPrinterCondition Pregunta su estado a la impresora con DLE EOT y, si
+// no responde, con LPGETSTATUS. Devuelve nil si no lo informa de ninguna de
+// las dos formas.
+func readPrinterCondition(path string) *printerCondition {
+	f, err := os.OpenFile(path, os.O_RDWR|syscall.O_NONBLOCK|syscall.O_NOCTTY, 0)
+	if err != nil && !errors.Is(err, syscall.EBUSY) {
+		// Sin permiso de lectura todavía se puede usar LPGETSTATUS.
+		f, err = os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK|syscall.O_NOCTTY, 0)
+	}
+	if errors.Is(err, syscall.EBUSY) {
+		// usblp y lp solo admiten una apertura: hay un trabajo en curso, así
+		// que la impresora está en línea.
+		return &printerCondition{Busy: true, Online: true}
+	}
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	if condition := queryDLEEOT(f); condition != nil {
+		return condition
+	}
+
+	var status int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), lpGetStatus, uintptr(unsafe.Pointer(&status)))
+	if errno != 0 {
+		return nil
+	}
+	return &printerCondition{
+		Online:   status&lpStatusSelected != 0,
+		PaperOut: status&lpStatusPaperOut != 0,
+		Error:    status&lpStatusNoError == 0,
+	}
+}
+
+// conditionReader Devuelve la función que pregunta su estado a la impresora
+// del nodo device o, si no hay nodo, a la impresora de red to.
+func conditionReader(device, to string) func() *printerCondition {
+	if to != "" {
+		return func() *printerCondition { return readRemoteCondition(to) }
+	}
+	return func() *printerCondition { return readPrinterCondition(device) }
+}
+
+// probeCondition Pregunta su estado a la impresora sin chocar con un
+// trabajo: mientras se consulta, el nodo está abierto (o la impresora de red
+// atiende la conexión de la consulta) y el trabajo que empezara fallaría al
+// abrirlo o esperaría. printing es el cerrojo que toman los trabajos.
+func probeCondition(printing *sync.Mutex, read func() *printerCondition) *printerCondition {
+	if !printing.TryLock() {
+		return &printerCondition{Busy: true, Online: true}
+	}
+	defer printing.Unlock()
+	return read()
+}
+
+// daemonCondition Pide al daemon el estado de la impresora por su /healthz,
+// en lugar de preguntarle directamente: solo el daemon sabe si está
+// imprimiendo. addr es la dirección de --metrics. Devuelve nil si el daemon
+// no responde o la impresora no informa su estado.
+func daemonCondition(addr string) *printerCondition {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+	client := http.Client{Timeout: relayDialTimeout}
+	resp, err := client.Get("http://" + net.JoinHostPort(loopbackHost(host), port) + "/healthz")
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	var report healthReport
+	if json.NewDecoder(resp.Body).Decode(&report) != nil {
+		return nil
+	}
+	return report.Printer
+}
+
+// healthReport Respuesta de /healthz: el socket que atiende el servicio, el
+// nodo o la impresora de red y, si lo informa, el estado de la impresora.
+type healthReport struct {
+	Healthy bool              `json:"healthy"`
+	Listen  string            `json:"listen"`
+	Device  deviceStatus      `json:"device"`
+	Printer *printerCondition `json:"printer,omitempty"`
+}
+
+// checkHealth Reúne el estado del servicio. condition puede ser nil si no se
+// pregunta el estado a la impresora.
+func checkHealth(listen string, check func() deviceStatus, condition func() *printerCondition) healthReport {
+	report := healthReport{Listen: listen, Device: check()}
+	if report.Device.Writable && condition != nil {
+		report.Printer = condition()
+	}
+	report.Healthy = report.Device.Writable && report.Printer.ok()
+	return report
+}
+
+// writeHealth Responde /healthz: 200 si se puede imprimir y 503 si no, para
+// que un balanceador o una comprobación de disponibilidad no necesite leer
+// el cuerpo.
+func writeHealth(w http.ResponseWriter, report healthReport) {
+	status := http.StatusOK
+	if !report.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, report)
+}
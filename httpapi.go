@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultHTTPPort Puerto de la API HTTP de la primera impresora.
+const defaultHTTPPort = 8100
+
+// frontendHTTP Valor de installOptions.Frontend para el socket de la API HTTP.
+const frontendHTTP = "http"
+
+// Límites de la API: los trabajos de texto se leen enteros para convertirlos,
+// y solo se recuerdan los últimos trabajos para consultar su estado.
+const (
+	maxTextJob     = 1 << 20
+	apiJobsHistory = 100
+)
+
+// Estados de un trabajo de la API.
+const (
+	jobPrinted = "printed"
+	jobFailed  = "failed"
+)
+
+// httpSettings API HTTP de una impresora, para los sistemas de punto de venta
+// web que no pueden abrir un socket TCP pero sí hacer peticiones HTTP.
+type httpSettings struct {
+	Port     int    `yaml:"port"`      // Puerto TCP, 0 para defaultHTTPPort
+	KeysFile string `yaml:"keys_file"` // Claves de los clientes (apikeys.go), vacío sin autenticación
+}
+
+// validate Comprueba el puerto y la ruta del archivo de claves.
+func (s *httpSettings) validate() error {
+	if s.Port == 0 {
+		s.Port = defaultHTTPPort
+	}
+	if s.Port < 1 || s.Port > 65535 {
+		return fmt.Errorf(tr("puerto inválido %d"), s.Port)
+	}
+	if s.KeysFile != "" && !filepath.IsAbs(s.KeysFile) {
+		return fmt.Errorf(tr("la ruta del archivo de claves debe ser absoluta: %q"), s.KeysFile)
+	}
+	return nil
+}
+
+// httpOptions Devuelve las opciones del par de unidades de la API HTTP de la
+// impresora. Un solo proceso atiende todas las conexiones (Accept=no) para
+// recordar el estado de los trabajos e imprimirlos de uno en uno.
+func (opts installOptions) httpOptions() installOptions {
+	api := opts
+	api.Frontend = frontendHTTP
+	api.Port = opts.HTTP.Port
+	api.Unix = nil
+	api.TLS = nil
+	api.Daemon = true
+	return api
+}
+
+// httpExecStart Devuelve el comando del servicio de la API HTTP.
+func httpExecStart(opts installOptions) string {
+	target := " --device " + opts.devicePath()
+	if opts.Printer.Kind == kindNetwork {
+		target = " --to " + opts.Printer.Path
+	}
+	keys := ""
+	if opts.HTTP.KeysFile != "" && userMode {
+		keys = " --keys-file " + opts.HTTP.KeysFile
+	}
+	return installedBinaryPath + " http" + target + " --name " + opts.unitName() + keys + timeoutFlags(opts) + connectionFlags(opts) + rateFlags(opts) + archiveFlags(opts) + usbResetFlags(opts)
+}
+
+// connectionFlags Devuelve las opciones de conexiones simultáneas de http,
+// que atiende todas las conexiones en un proceso y las limita él mismo.
+func connectionFlags(opts installOptions) string {
+	var flags string
+	if opts.MaxConnections > 0 {
+		flags += " --max-connections " + strconv.Itoa(opts.MaxConnections)
+	}
+	if opts.MaxConnectionsPerSource > 0 {
+		flags += " --max-connections-per-source " + strconv.Itoa(opts.MaxConnectionsPerSource)
+	}
+	return flags
+}
+
+// httpCredentials Devuelve la línea LoadCredential= del archivo de claves,
+// que así puede ser legible solo por root.
+func httpCredentials(opts installOptions) string {
+	if opts.HTTP.KeysFile == "" || userMode {
+		return ""
+	}
+	return "LoadCredential=" + httpKeysCredential + ":" + opts.HTTP.KeysFile + "\n"
+}
+
+// apiJob Trabajo recibido por la API, tal como se devuelve en JSON.
+type apiJob struct {
+	ID       int64     `json:"id"`
+	Printer  string    `json:"printer"`
+	Status   string    `json:"status"` // jobPrinted o jobFailed
+	Bytes    int64     `json:"bytes"`
+	Error    string    `json:"error,omitempty"`
+	Received time.Time `json:"received"`
+}
+
+// apiServer API HTTP de una impresora. Los trabajos se imprimen al recibirlos,
+// de uno en uno; la respuesta llega cuando la impresora los aceptó.
+type apiServer struct {
+	name      string
+	deliver   func(in io.Reader, client, source string) (int64, error)
+	listen    string                   // Socket que atiende la API, para /healthz
+	check     func() deviceStatus      // Comprueba si la impresora está disponible
+	condition func() *printerCondition // Estado que informa la impresora, nil si no lo informa
+	keys      []apiKey                 // Claves de los clientes; sin claves la API es abierta
+
+	idleTimeout time.Duration // Espera máxima de cada trama WebSocket, 0 sin límite
+
+	printing sync.Mutex
+
+	mu     sync.Mutex
+	lastID int64
+	jobs   []apiJob // Los últimos apiJobsHistory trabajos, del más antiguo al más reciente
+}
+
+// handler Devuelve las rutas de la API.
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /printers/{name}/jobs", s.submitJob)
+	mux.HandleFunc("GET /printers/{name}/jobs", s.listJobs)
+	mux.HandleFunc("GET /printers/{name}/jobs/{id}", s.getJob)
+	mux.HandleFunc("GET /printers/{name}/ws", s.serveWebSocket)
+	// El servicio gRPC escpos.v1.Printer (escpos.proto) comparte el puerto,
+	// por HTTP/2 sin cifrar. No usa la biblioteca de gRPC: los mensajes son
+	// pocos y pequeños y se codifican a mano en grpc.go.
+	mux.HandleFunc("POST /escpos.v1.Printer/{method}", s.serveGRPC)
+	// Servicio ePOS-Print de las impresoras Epson inteligentes (epos.go).
+	mux.HandleFunc("POST /cgi-bin/epos/service.cgi", s.serveEPOS)
+	mux.HandleFunc("OPTIONS /cgi-bin/epos/service.cgi", s.serveEPOS)
+	mux.HandleFunc("GET /healthz", s.serveHealth)
+	return s.authorize(mux)
+}
+
+// serveHealth Responde /healthz con el estado de la API y de la impresora.
+func (s *apiServer) serveHealth(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, checkHealth(s.listen, s.check, s.condition))
+}
+
+// writeJSON Responde con v en JSON.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError Responde con un error en JSON.
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// checkPrinter Comprueba que la ruta pide esta impresora y responde 404 si no.
+func (s *apiServer) checkPrinter(w http.ResponseWriter, r *http.Request) bool {
+	if name := r.PathValue("name"); name != s.name {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf(tr("impresora desconocida %q (esta API atiende %q)"), name, s.name))
+		return false
+	}
+	return true
+}
+
+// submitJob Imprime el cuerpo de la petición. Con Content-Type text/plain el
+// texto se convierte a PC850 y se termina con un corte; con cualquier otro
+// tipo los bytes se envían tal cual, porque ya son ESC/POS.
+func (s *apiServer) submitJob(w http.ResponseWriter, r *http.Request) {
+	if !s.checkPrinter(w, r) {
+		return
+	}
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/plain") {
+		text, err := io.ReadAll(io.LimitReader(r.Body, maxTextJob+1))
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		if len(text) > maxTextJob {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Errorf(tr("el texto supera %d bytes"), maxTextJob))
+			return
+		}
+		body = bytes.NewReader(newReceipt().text(string(text)).feed(4).cut().Bytes())
+	}
+
+	job := s.print(body, r)
+	if job.Status == jobFailed {
+		writeJSON(w, http.StatusBadGateway, job)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/printers/%s/jobs/%d", s.name, job.ID))
+	writeJSON(w, http.StatusCreated, job)
+}
+
+// print Imprime un trabajo de la petición r, esperando a que termine el
+// anterior, y lo anota en el historial y en el registro.
+func (s *apiServer) print(body io.Reader, r *http.Request) apiJob {
+	client := apiClient(r)
+	job := apiJob{Printer: s.name, Received: time.Now()}
+	s.printing.Lock()
+	n, err := s.deliver(body, client, apiSource(r))
+	s.printing.Unlock()
+	job.Bytes, job.Status = n, jobPrinted
+	if err != nil {
+		job.Status, job.Error = jobFailed, err.Error()
+	}
+	job = s.record(job)
+
+	if err != nil {
+		logger.Error(fmt.Sprintf(tr("Error en el trabajo %d de %s: %v"), job.ID, client, err), "job", job.ID, "client", client)
+	} else {
+		logger.Info(fmt.Sprintf(tr("Trabajo %d de %d bytes de %s impreso"), job.ID, n, client), "job", job.ID, "client", client, "bytes", n)
+	}
+	return job
+}
+
+// record Asigna el número al trabajo y lo guarda en el historial.
+func (s *apiServer) record(job apiJob) apiJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	job.ID = s.lastID
+	s.jobs = append(s.jobs, job)
+	if len(s.jobs) > apiJobsHistory {
+		s.jobs = s.jobs[len(s.jobs)-apiJobsHistory:]
+	}
+	return job
+}
+
+// listJobs Devuelve los últimos trabajos.
+func (s *apiServer) listJobs(w http.ResponseWriter, r *http.Request) {
+	if !s.checkPrinter(w, r) {
+		return
+	}
+	s.mu.Lock()
+	jobs := append([]apiJob{}, s.jobs...)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// getJob Devuelve el estado de un trabajo.
+func (s *apiServer) getJob(w http.ResponseWriter, r *http.Request) {
+	if !s.checkPrinter(w, r) {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf(tr("número de trabajo inválido %q"), r.PathValue("id")))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.ID == id {
+			writeJSON(w, http.StatusOK, job)
+			return
+		}
+	}
+	writeAPIError(w, http.StatusNotFound, fmt.Errorf(tr("no hay ningún trabajo %d"), id))
+}
+
+// runHTTP Implementa el subcomando "http", el servicio de la API HTTP de cada
+// impresora: recibe de systemd el socket que escucha (Accept=no) y entrega
+// los trabajos al dispositivo o a la impresora de red.
+func runHTTP(args []string) {
+	fs := flag.NewFlagSet("http", flag.ExitOnError)
+	device := fs.String("device", "", tr("nodo de la impresora, por ejemplo /dev/usb/lp0"))
+	to := fs.String("to", "", tr("dirección HOST:PUERTO de la impresora"))
+	name := fs.String("name", defaultUnitName, tr("nombre de la impresora en las rutas de la API"))
+	timeout := fs.Duration("timeout", defaultWriteTimeout, tr("tiempo máximo de espera a que la impresora acepte datos"))
+	idle := fs.Duration("idle-timeout", defaultIdleTimeout, tr("tiempo máximo sin recibir datos del cliente (0 sin límite)"))
+	total := fs.Duration("job-timeout", defaultJobTimeout, tr("duración máxima de un trabajo (0 sin límite)"))
+	keysFile := fs.String("keys-file", "", tr("archivo con las claves de los clientes, una línea \"CLIENTE CLAVE\" por terminal"))
+	newLimiter := rateServerFlags(fs)
+	limitConns := connectionServerFlags(fs)
+	newDelivery := deliveryServerFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s http --device NODO | --to HOST:PUERTO\n"), filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if (*device == "") == (*to == "") {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	// Las claves llegan como credencial de systemd o en un archivo.
+	if *keysFile == "" && os.Getenv("CREDENTIALS_DIRECTORY") != "" {
+		*keysFile = filepath.Join(os.Getenv("CREDENTIALS_DIRECTORY"), httpKeysCredential)
+	}
+	var keys []apiKey
+	if *keysFile != "" {
+		var err error
+		if keys, err = loadAPIKeys(*keysFile); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+	ln, err := systemdListener()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	limiter := newLimiter("")
+	delivery := newDelivery(*device, *to, *timeout, *total)
+	api := &apiServer{
+		keys:   keys,
+		name:   *name,
+		listen: ln.Addr().String(),
+		deliver: func(r io.Reader, client, source string) (int64, error) {
+			if limiter != nil {
+				r = limiter.limit(r, source)
+			}
+			n, err := delivery.deliver(r, client)
+			if limiter != nil {
+				limiter.record(source, n)
+			}
+			return n, err
+		},
+		check: func() deviceStatus {
+			if *to != "" {
+				return checkRemote(*to)
+			}
+			return checkDevice(*device)
+		},
+		idleTimeout: *idle,
+	}
+	read := conditionReader(*device, *to)
+	api.condition = func() *printerCondition { return probeCondition(&api.printing, read) }
+	logger.Info(fmt.Sprintf(tr("API HTTP en %s para %s"), ln.Addr(), *name), "listen", ln.Addr().String(), "printer", *name)
+	srv := &http.Server{
+		Handler:     api.handler(),
+		ReadTimeout: *total,
+		IdleTimeout: *idle,
+		ErrorLog:    log.New(io.Discard, "", 0),
+		Protocols:   new(http.Protocols),
+	}
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetUnencryptedHTTP2(true) // Para gRPC
+	if err := srv.Serve(limitConns(ln, limiter)); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Error: %v", err)
+	}
+}
@@ -0,0 +1,734 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// language Idioma de los mensajes: "es" (por defecto) o "en".
+var language = "es"
+
+// tr Traduce un mensaje al idioma seleccionado. Los mensajes se escriben en
+// español en el código y sirven de clave del catálogo; si no hay traducción
+// se devuelve el original, de modo que un mensaje olvidado sale en español
+// en lugar de vacío.
+func tr(msg string) string {
+	if language == "en" {
+		if s, ok := english[msg]; ok {
+			return s
+		}
+	}
+	return msg
+}
+
+// detectLanguage Devuelve el idioma pedido con --lang o, si no se indicó,
+// el de las variables de entorno de locale. Todo lo que no sea inglés
+// se muestra en español.
+func detectLanguage(flagValue string) string {
+	value := flagValue
+	if value == "" {
+		for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+			if value = os.Getenv(env); value != "" {
+				break
+			}
+		}
+	}
+	if strings.HasPrefix(strings.ToLower(value), "en") {
+		return "en"
+	}
+	return "es"
+}
+
+// english Catálogo de traducciones al inglés, indexado por el mensaje en español.
+var english = map[string]string{
+	// main.go
+	"no se encontraron impresoras USB en /dev/usb/lpX":                                               "no USB printers found in /dev/usb/lpX",
+	"\n🎉 ¡Configuración completa! El socket de la impresora ESC/POS está activo y habilitado.":       "\n🎉 Setup complete! The ESC/POS printer socket is active and enabled.",
+	"La PC está lista para aceptar trabajos de impresión en %s.\n":                                   "The PC is ready to accept print jobs on %s.\n",
+	"✓ Impresora seleccionada: %s\n":                                                                 "✓ Selected printer: %s\n",
+	"error al buscar impresoras: %w":                                                                 "error looking for printers: %w",
+	"\nSe encontraron las siguientes impresoras USB:":                                                "\nThe following USB printers were found:",
+	"Por favor, selecciona el número de la impresora que deseas usar (varias separadas por comas): ": "Please select the number of the printer you want to use (several separated by commas): ",
+	"no se seleccionó ninguna impresora: %w":                                                         "no printer was selected: %w",
+	"Entrada inválida. Por favor, ingresa números de la lista.":                                      "Invalid input. Please enter numbers from the list.",
+	"Respuesta inválida. Por favor, responde s o n.":                                                 "Invalid answer. Please answer y or n.",
+	"Etiqueta para la impresora del puerto USB %s (por ejemplo \"caja izquierda\")":                  "Label for the printer on USB port %s (for example \"left till\")",
+	", Enter para conservar «%s»: ":                                                                  ", Enter to keep «%s»: ",
+	", Enter para omitir: ":                                                                          ", Enter to skip: ",
+	"Este programa debe ejecutarse como root o con sudo.":                                            "This program must be run as root or with sudo.",
+	"instalar sin preguntas si hay exactamente una impresora conectada":                              "install without prompts if exactly one printer is connected",
+	"impresoras a usar separadas por comas (/dev/usb/lp0, lp0, puerto USB, etiqueta, usb:VID:PID para una que aún no está conectada o tcp://IP para una de red)": "comma-separated printers to use (/dev/usb/lp0, lp0, USB port, label, usb:VID:PID for one not yet connected or tcp://IP for a network one)",
+	"puerto TCP de la primera impresora; las siguientes usan los puertos consecutivos":                                                                           "TCP port of the first printer; the following ones use consecutive ports",
+	"direcciones IP en las que escucha el socket, separadas por comas (por ejemplo 127.0.0.1, la IP de la LAN o :: para IPv6)":                                   "IP addresses the socket listens on, separated by commas (for example 127.0.0.1, the LAN IP or :: for IPv6)",
+	"etiqueta para la impresora seleccionada (solo con una impresora)":                                                                                           "label for the selected printer (only with one printer)",
+	"imprimir la IP de la máquina en cada arranque":                                                                                                              "print the machine's IP on every boot",
+	"no hacer preguntas; requiere --printer":                                                                                                                     "do not ask questions; requires --printer",
+	"archivo YAML con las impresoras y opciones a instalar":                                                                                                      "YAML file with the printers and options to install",
+	"mostrar las unidades y los comandos sin escribir ni ejecutar nada":                                                                                          "show the units and commands without writing or running anything",
+	"formato de la salida: text o json":                                                                                                                          "output format: text or json",
+	"Uso: %s [--lang es|en] [--verbose | --quiet] [--log-format text|json] [--user] [--auto | --printer IMPRESORA[,IMPRESORA...] --yes | --config ARCHIVO] [opciones]\n":            "Usage: %s [--lang es|en] [--verbose | --quiet] [--log-format text|json] [--user] [--auto | --printer PRINTER[,PRINTER...] --yes | --config FILE] [options]\n",
+	"Subcomandos: status, doctor, test-print, reprint, uninstall, usb-reset, print-pairing, print-netinfo, print-announce, setup-web, relay, serve, lpd, ipp, http, mqtt, tls-cert": "Subcommands: status, doctor, test-print, reprint, uninstall, usb-reset, print-pairing, print-netinfo, print-announce, setup-web, relay, serve, lpd, ipp, http, mqtt, tls-cert",
+	"Error: puerto inválido %d\n":                                     "Error: invalid port %d\n",
+	"Error: --yes requiere --printer":                                 "Error: --yes requires --printer",
+	"Error: --config no se puede combinar con --auto ni --printer":    "Error: --config cannot be combined with --auto or --printer",
+	"Error: --label solo se puede usar con una impresora":             "Error: --label can only be used with one printer",
+	"Error: formato de salida inválido %q (text o json)\n":            "Error: invalid output format %q (text or json)\n",
+	"Iniciando la configuración del servicio de impresora ESC/POS...": "Starting the ESC/POS printer service setup...",
+	"✓ Permisos de root confirmados.":                                 "✓ Root permissions confirmed.",
+	"  Capacidades: %s\n":                                             "  Capabilities: %s\n",
+	"La PC está lista para aceptar trabajos de impresión en:":         "The PC is ready to accept print jobs on:",
+	"la dirección %s está asignada a más de una impresora":            "address %s is assigned to more than one printer",
+	"✓ Programa instalado en %s\n":                                    "✓ Program installed at %s\n",
+	"error al escribir el archivo de %s: %w":                          "error writing the %s file: %w",
+	"✓ Archivo de %s creado exitosamente: %s\n":                       "✓ %s file created successfully: %s\n",
+	"\n# Se copiaría este programa a %s\n":                            "\n# This program would be copied to %s\n",
+	"\n# Comandos que se ejecutarían:":                                "\n# Commands that would run:",
+	"Ejecutando: %s...\n":                                             "Running: %s...\n",
+	"error al ejecutar el comando '%s': %w\nSalida: %s":               "error running command '%s': %w\nOutput: %s",
+	"✓ Comando exitoso.\n":                                            "✓ Command succeeded.\n",
+
+	// auto.go
+	"error al conectar con %s: %w":   "error connecting to %s: %w",
+	"error al enviar datos a %s: %w": "error sending data to %s: %w",
+	"hay %d impresoras conectadas; --auto requiere exactamente una. Usa --printer o la instalación interactiva": "%d printers are connected; --auto requires exactly one. Use --printer or the interactive installation",
+	"✓ Impresora detectada: %s\n": "✓ Printer detected: %s\n",
+	"  Perfil: %s\n":              "  Profile: %s\n",
+	"  Modelo no reconocido en la base de capacidades; se usan los valores por defecto.": "  Model not found in the capabilities database; using default values.",
+	"Enviando el ticket de confirmación por %s...\n":                                     "Sending the confirmation ticket through %s...\n",
+	"la verificación falló: %w":                                                          "verification failed: %w",
+	"✓ Ticket de confirmación enviado.":                                                  "✓ Confirmation ticket sent.",
+
+	// config.go
+	"error en el formato de %s: %w":          "invalid format in %s: %w",
+	"error al leer la configuración: %w":     "error reading the configuration: %w",
+	"%s no declara ninguna impresora":        "%s does not declare any printer",
+	"la impresora %d de %s no indica device": "printer %d in %s has no device",
+	"puerto inválido %d para %s":             "invalid port %d for %s",
+
+	// uninstall.go
+	"Uso: %s uninstall\n":                                     "Usage: %s uninstall\n",
+	"Desinstalando el servicio de impresora ESC/POS...":       "Uninstalling the ESC/POS printer service...",
+	"Error al borrar %s: %v":                                  "Error removing %s: %v",
+	"\nNo se encontraron archivos de una instalación previa.": "\nNo files from a previous installation were found.",
+	"\nArchivos eliminados:":                                  "\nRemoved files:",
+	"Se conservan las etiquetas de impresoras en %s.\n":       "Printer labels are kept in %s.\n",
+	"\n✓ Desinstalación completa.":                            "\n✓ Uninstall complete.",
+
+	// status.go
+	"mostrar el estado en formato JSON":           "show the status as JSON",
+	"Uso: %s status [--json]\n":                   "Usage: %s status [--json]\n",
+	"No se encontró ninguna instalación en %s.\n": "No installation found in %s.\n",
+	"  Conexiones activas: %d, aceptadas: %s\n":   "  Active connections: %d, accepted: %s\n",
+	"  Impresora: %s (%s)\n":                      "  Printer: %s (%s)\n",
+
+	// testprint.go
+	"escribir directamente en el dispositivo en lugar de usar el socket": "write directly to the device instead of using the socket",
+	"Uso: %s test-print [--direct] [impresora]\n":                        "Usage: %s test-print [--direct] [printer]\n",
+	"✓ Página de prueba impresa en %s\n":                                 "✓ Test page printed on %s\n",
+	"Enviando la página de prueba por %s...\n":                           "Sending the test page through %s...\n",
+	"✓ Página de prueba enviada a %s\n":                                  "✓ Test page sent to %s\n",
+
+	// installed.go
+	"no se encontró una instalación (%s): %w":        "no installation found (%s): %w",
+	"error al buscar las unidades instaladas: %w":    "error looking for installed units: %w",
+	"no se encontró ninguna instalación en %s":       "no installation found in %s",
+	"hay %d impresoras instaladas; indica cuál usar": "%d printers are installed; specify which one to use",
+	"no hay ninguna instalación para %s":             "there is no installation for %s",
+	"no se pudo interpretar ListenStream=%s":         "could not parse ListenStream=%s",
+
+	// labels.go
+	"error al leer las etiquetas: %w":               "error reading labels: %w",
+	"error al crear el directorio de etiquetas: %w": "error creating the labels directory: %w",
+	"error al guardar las etiquetas: %w":            "error saving labels: %w",
+
+	// capabilities.go
+	"error al leer %s: %w": "error reading %s: %w",
+
+	// escpos.go
+	"error al abrir la impresora %s: %w":       "error opening printer %s: %w",
+	"error al escribir en la impresora %s: %w": "error writing to printer %s: %w",
+	"error al cerrar la impresora %s: %w":      "error closing printer %s: %w",
+
+	// announce.go
+	"no se pudo determinar la ruta del programa: %w":  "could not determine the program path: %w",
+	"error al crear %s: %w":                           "error creating %s: %w",
+	"error al copiar el programa a %s: %w":            "error copying the program to %s: %w",
+	"Uso: %s print-announce\n":                        "Usage: %s print-announce\n",
+	"Error: no se encontró ninguna instalación en %s": "Error: no installation found in %s",
+	"Error: la impresora %s no está disponible":       "Error: printer %s is not available",
+	"✓ Anuncio impreso en %s\n":                       "✓ Announcement printed on %s\n",
+
+	// pairing.go
+	"error al listar las interfaces de red: %w":                "error listing network interfaces: %w",
+	"el servicio %s no indica una impresora":                   "service %s does not specify a printer",
+	"token de API que se incluye en el código QR":              "API token included in the QR code",
+	"Uso: %s print-pairing [--token TOKEN] [impresora]\n":      "Usage: %s print-pairing [--token TOKEN] [printer]\n",
+	"Error: la máquina no tiene ninguna dirección IPv4 activa": "Error: the machine has no active IPv4 address",
+	"✓ Recibo de emparejamiento impreso en %s (%s:%d)\n":       "✓ Pairing receipt printed on %s (%s:%d)\n",
+
+	// netinfo.go
+	"error al leer la tabla de rutas: %w":  "error reading the routing table: %w",
+	"Uso: %s print-netinfo [impresora]\n":  "Usage: %s print-netinfo [printer]\n",
+	"✓ Diagnóstico de red impreso en %s\n": "✓ Network diagnostics printed on %s\n",
+
+	// usbreset.go
+	"no se pudo encontrar %s en sysfs: %w":                   "could not find %s in sysfs: %w",
+	"no se pudo leer el bus USB de %s: %w":                   "could not read the USB bus of %s: %w",
+	"no se pudo leer el número de dispositivo USB de %s: %w": "could not read the USB device number of %s: %w",
+	"error al abrir %s: %w":                                  "error opening %s: %w",
+	"error al reiniciar el puerto USB %s: %w":                "error resetting USB port %s: %w",
+	"la impresora no volvió a aparecer":                      "the printer did not come back",
+	"Uso: %s usb-reset <impresora>\n":                        "Usage: %s usb-reset <printer>\n",
+	"La impresora puede indicarse por ruta (/dev/usb/lp0), nombre (lp0), puerto USB (1-1.3) o etiqueta.": "The printer can be given by path (/dev/usb/lp0), name (lp0), USB port (1-1.3) or label.",
+	"Error: no se pudo determinar el puerto USB de %s":                                                   "Error: could not determine the USB port of %s",
+	"Reiniciando el puerto USB de %s...\n":                                                               "Resetting the USB port of %s...\n",
+	"✓ Puerto USB reiniciado.":                                                                           "✓ USB port reset.",
+	"Esperando a que la impresora vuelva a estar disponible...":                                          "Waiting for the printer to become available again...",
+	"Error: la impresora no respondió después del reinicio: %v":                                          "Error: the printer did not respond after the reset: %v",
+	"✓ Impresora disponible: %s\n":                                                                       "✓ Printer available: %s\n",
+
+	// webwizard.go
+	"Error al generar la página del asistente: %v":                                               "Error rendering the wizard page: %v",
+	"selecciona una impresora de la lista":                                                       "select a printer from the list",
+	"puerto inválido %q":                                                                         "invalid port %q",
+	"dirección inválida %q":                                                                      "invalid address %q",
+	"dirección en la que escucha el asistente":                                                   "address the wizard listens on",
+	"servir el asistente aunque la máquina ya esté configurada":                                  "serve the wizard even if the machine is already configured",
+	"Uso: %s setup-web [--listen DIRECCIÓN] [--force]\n":                                         "Usage: %s setup-web [--listen ADDRESS] [--force]\n",
+	"Error: la máquina ya está configurada (%s existe). Usa --force para volver a configurarla.": "Error: the machine is already configured (%s exists). Use --force to configure it again.",
+	"Asistente de configuración disponible en:":                                                  "Setup wizard available at:",
+	"Error: dirección inválida %q: %v":                                                           "Error: invalid address %q: %v",
+	"\n🎉 ¡Configuración completa desde el asistente web!":                                        "\n🎉 Setup complete from the web wizard!",
+	// upgrade.go y plan de instalación
+	"error al guardar la copia de seguridad de %s: %w": "error saving the backup of %s: %w",
+	"(nuevo)": "(new)",
+	"  (no se pudieron mostrar las diferencias: %v)\n":     "  (could not show the differences: %v)\n",
+	"✓ Archivo de %s sin cambios: %s\n":                    "✓ %s file unchanged: %s\n",
+	"El archivo de %s cambia, copia de seguridad en %s:\n": "The %s file changes, backup saved to %s:\n",
+	"Omitido (sin cambios): %s\n":                          "Skipped (no changes): %s\n",
+	"\n# --- %s (%s) sin cambios ---\n":                    "\n# --- %s (%s) unchanged ---\n",
+	"\n# --- %s (%s) cambia ---\n":                         "\n# --- %s (%s) changes ---\n",
+
+	"✓ Archivo de %s actualizado: %s\n": "✓ %s file updated: %s\n",
+
+	// tui.go
+	"selección cancelada": "selection cancelled",
+	"  ↑/↓ mover, espacio marcar, Enter confirmar, q cancelar": "  ↑/↓ move, space mark, Enter confirm, q cancel",
+	"  ↑/↓ mover, Enter confirmar, q cancelar":                 "  ↑/↓ move, Enter confirm, q cancel",
+	"Dispositivo: %s": "Device: %s",
+	"Puerto USB: %s":  "USB port: %s",
+	"Serie: %s":       "Serial: %s",
+	"Etiqueta: %s":    "Label: %s",
+	"Capacidades: %s": "Capabilities: %s",
+
+	// main.go, preguntas de la instalación interactiva
+	"¿Imprimir la IP de la máquina en cada arranque?":                "Print the machine's IP on every boot?",
+	"Puerto TCP de la primera impresora [%d]: ":                      "TCP port of the first printer [%d]: ",
+	"Puerto inválido. Por favor, ingresa un número entre 1 y 65535.": "Invalid port. Please enter a number between 1 and 65535.",
+	"\nResumen de la instalación:":                                   "\nInstallation summary:",
+	"  Anuncio de la IP en cada arranque":                            "  IP announcement on every boot",
+	"¿Aplicar esta configuración?":                                   "Apply this configuration?",
+	"instalación cancelada":                                          "installation cancelled",
+
+	// doctor.go
+	"la máquina no arrancó con systemd":                     "the machine was not booted with systemd",
+	"el instalador necesita systemd para activar el socket": "the installer needs systemd for socket activation",
+	"no se encontró systemctl":                              "systemctl not found",
+	"systemd disponible":                                    "systemd available",
+	"módulo usblp cargado":                                  "usblp module loaded",
+	"el módulo usblp no está cargado":                       "the usblp module is not loaded",
+	"ejecuta \"modprobe usblp\" y revisa que no esté en una lista negra de /etc/modprobe.d": "run \"modprobe usblp\" and check it is not blacklisted in /etc/modprobe.d",
+	"impresoras": "printers",
+	"revisa el cable y la alimentación, confirma con lsusb que el equipo ve la impresora y que CUPS (ippusbxd/ipp-usb) no la tiene tomada": "check the cable and power, confirm with lsusb that the machine sees the printer and that CUPS (ippusbxd/ipp-usb) has not claimed it",
+	"ejecuta como root": "run as root",
+	" o agrega el usuario al grupo %s (usermod -aG %s USUARIO)": " or add the user to the %s group (usermod -aG %s USER)",
+	"puerto %d":            "port %d",
+	"en uso por %s.socket": "in use by %s.socket",
+	"%s.socket está instalado pero nadie escucha en el puerto":       "%s.socket is installed but nothing listens on the port",
+	"otro programa ya escucha en el puerto":                          "another program already listens on the port",
+	"identifícalo con \"ss -ltnp sport = :%d\" o instala con --port": "identify it with \"ss -ltnp sport = :%d\" or install with --port",
+	"libre":                      "free",
+	"no se pudo consultar ufw: ": "could not query ufw: ",
+	"ufw inactivo":               "ufw inactive",
+	"ufw permite el puerto":      "ufw allows the port",
+	"ufw está activo y no permite el puerto":       "ufw is active and does not allow the port",
+	"firewalld inactivo":                           "firewalld inactive",
+	"firewalld permite el puerto":                  "firewalld allows the port",
+	"firewalld está activo y no permite el puerto": "firewalld is active and does not allow the port",
+	"no se detectó ufw ni firewalld":               "neither ufw nor firewalld detected",
+	"mostrar los resultados en formato JSON":       "show the results as JSON",
+	"Uso: %s doctor [--json]\n":                    "Usage: %s doctor [--json]\n",
+
+	// log.go y opciones globales
+	"formato de registro inválido %q (text o json)": "invalid log format %q (text or json)",
+	"Impresora encontrada: %s":                      "Printer found: %s",
+
+	// serial.go
+	"velocidad inválida %d":                                            "invalid baud rate %d",
+	"paridad inválida %q (none, even u odd)":                           "invalid parity %q (none, even or odd)",
+	"control de flujo inválido %q (none, rtscts o xonxoff)":            "invalid flow control %q (none, rtscts or xonxoff)",
+	"La impresora %s es serie; indica la configuración de la línea.\n": "Printer %s is serial; enter the line settings.\n",
+	"Velocidad [%d]: ":                                                 "Baud rate [%d]: ",
+	"Paridad (none, even, odd) [%s]: ":                                 "Parity (none, even, odd) [%s]: ",
+	"Control de flujo (none, rtscts, xonxoff) [%s]: ":                  "Flow control (none, rtscts, xonxoff) [%s]: ",
+	"velocidad de las impresoras serie":                                "baud rate of serial printers",
+	"paridad de las impresoras serie: none, even u odd":                "parity of serial printers: none, even or odd",
+	"control de flujo de las impresoras serie: none, rtscts o xonxoff": "flow control of serial printers: none, rtscts or xonxoff",
+
+	// cups.go
+	"la cola de CUPS no acepta trabajos":                                  "the CUPS queue is not accepting jobs",
+	"    a través de la cola de CUPS %s\n":                                "    through CUPS queue %s\n",
+	"enviar los trabajos a la cola de CUPS de la impresora, si tiene una": "send jobs to the printer's CUPS queue, if it has one",
+	"La impresora está configurada en CUPS como la cola %s. ¿Enviar los trabajos a través de CUPS en lugar de al dispositivo?": "The printer is configured in CUPS as queue %s. Send jobs through CUPS instead of to the device?",
+	"  Cola de CUPS: %s (%s)\n": "  CUPS queue: %s (%s)\n",
+
+	// network.go
+	"puerto inválido en %s":                              "invalid port in %s",
+	"dirección de impresora de red inválida %q":          "invalid network printer address %q",
+	"No se pudo conectar con %s (intento %d de %d): %v":  "Could not connect to %s (attempt %d of %d): %v",
+	"error al conectar con la impresora %s: %w":          "error connecting to printer %s: %w",
+	"error al enviar el trabajo a %s: %w":                "error sending the job to %s: %w",
+	"La impresora %s cerró la conexión con un error: %v": "Printer %s closed the connection with an error: %v",
+	"dirección HOST:PUERTO de la impresora":              "HOST:PORT address of the printer",
+	"Trabajo de %d bytes enviado a %s":                   "Sent a %d-byte job to %s",
+	"  Impresora de red: %s (%s)\n":                      "  Network printer: %s (%s)\n",
+
+	// udev.go
+	"modelo USB inválido %q (usb:VID:PID o usb:VID:PID:SERIE)": "invalid USB model %q (usb:VID:PID or usb:VID:PID:SERIAL)",
+
+	// preflight.go
+	"la impresora %s está ocupada por otro programa": "printer %s is in use by another program",
+	"; suele ser un programa de punto de venta que usa libusb o CUPS con ipp-usb. Ciérralo o usa --cups si la impresora está en CUPS": "; this is usually point-of-sale software using libusb, or CUPS with ipp-usb. Close it, or use --cups if the printer is set up in CUPS",
+	"no se puede escribir en %s: %w":                                        "cannot write to %s: %w",
+	"la impresora %s no responde; revisa el cable y que esté encendida: %w": "printer %s is not responding; check the cable and that it is powered on: %w",
+
+	// portcheck.go
+	"un programa desconocido":                            "an unknown program",
+	"\nEl puerto %d ya está en uso por %s.\n":            "\nPort %d is already in use by %s.\n",
+	"¿Detener y deshabilitar %s para usar el puerto %d?": "Stop and disable %s to use port %d?",
+	"Se usará el puerto %d.\n":                           "Port %d will be used.\n",
+	"el puerto %d está en uso por %s, que no es una unidad de systemd; detenlo a mano o elige otro puerto": "port %d is in use by %s, which is not a systemd unit; stop it manually or choose another port",
+	"el puerto %d ya está en uso por %s; elige otro con --port %d o usa --take-over para deshabilitarlo":   "port %d is already in use by %s; choose another with --port %d or use --take-over to disable it",
+	"deshabilitar el servicio que ya escuche en el puerto (por ejemplo p910nd)":                            "disable the service already listening on the port (for example p910nd)",
+
+	// relay.go
+	"la impresora %s no aceptó datos en %s; revisa el papel y la tapa": "printer %s did not accept data within %s; check the paper and the cover",
+	"error al leer el trabajo: %w":                                     "error reading the job: %w",
+	"nodo de la impresora, por ejemplo /dev/usb/lp0":                   "printer node, for example /dev/usb/lp0",
+	"tiempo máximo de espera a que la impresora acepte datos":          "maximum time to wait for the printer to accept data",
+	"Uso: %s relay --device NODO | --to HOST:PUERTO\n":                 "Usage: %s relay --device NODE | --to HOST:PORT\n",
+
+	// daemon.go
+	"no se recibió ningún socket de systemd (LISTEN_PID); serve solo se ejecuta desde la unidad": "no socket received from systemd (LISTEN_PID); serve only runs from the unit",
+	"se esperaba un socket de systemd y se recibieron %q":                                        "expected one socket from systemd and got %q",
+	"error al usar el socket de systemd: %w":                                                     "error using the systemd socket: %w",
+	"Uso: %s serve --device NODO | --to HOST:PUERTO\n":                                           "Usage: %s serve --device NODE | --to HOST:PORT\n",
+	"Atendiendo %s para %s":                                                                      "Serving %s for %s",
+	"Error en el trabajo de %s: %v":                                                              "Error in the job from %s: %v",
+	"Trabajo de %d bytes de %s enviado a %s":                                                     "Sent a %d-byte job from %s to %s",
+	"%s: el modo daemon no admite colas de CUPS":                                                 "%s: daemon mode does not support CUPS queues",
+	"atender todas las conexiones con un solo proceso que imprime los trabajos de uno en uno":    "serve all connections from a single process that prints jobs one at a time",
+
+	// main.go y config.go, límites de conexiones
+	"conexiones simultáneas admitidas por el socket (0 para el valor de systemd)": "simultaneous connections accepted by the socket (0 for the systemd default)",
+	"conexiones simultáneas admitidas desde una misma IP (0 sin límite)":          "simultaneous connections accepted from a single IP (0 for no limit)",
+	"Error: los límites de conexiones no pueden ser negativos":                    "Error: connection limits cannot be negative",
+	"límite de conexiones negativo para %s":                                       "negative connection limit for %s",
+
+	// main.go y config.go, redes permitidas y aislamiento
+	"redes que pueden imprimir, separadas por comas (por ejemplo 192.168.1.0/24); el resto se rechaza": "networks allowed to print, comma-separated (for example 192.168.1.0/24); everything else is rejected",
+	"red inválida %q (usa una IP o una red como 192.168.1.0/24)":                                       "invalid network %q (use an IP or a network like 192.168.1.0/24)",
+	"no aislar el servicio de la impresora (para diagnosticar problemas)":                              "do not sandbox the printer service (for troubleshooting)",
+
+	// relay.go y main.go, plazos de las conexiones
+	"el trabajo superó el tiempo máximo de %s":                                    "the job exceeded the maximum time of %s",
+	"El cliente no envió datos en %s; se da por terminado el trabajo":             "The client sent no data for %s; ending the job",
+	"tiempo máximo sin recibir datos del cliente (0 sin límite)":                  "maximum time without data from the client (0 for no limit)",
+	"duración máxima de un trabajo (0 sin límite)":                                "maximum duration of a job (0 for no limit)",
+	"cierra la conexión si el cliente no envía datos en este tiempo (0 para 90s)": "close the connection if the client sends no data for this long (0 for 90s)",
+	"duración máxima de un trabajo (0 para 10m)":                                  "maximum duration of a job (0 for 10m)",
+	"Error: los plazos no pueden ser negativos":                                   "Error: timeouts cannot be negative",
+	"plazo negativo para %s":                                                      "negative timeout for %s",
+
+	// verify.go
+	"systemd-analyze no está disponible; no se verifican las unidades": "systemd-analyze is not available; the units are not verified",
+	"error al crear el directorio temporal: %w":                        "failed to create the temporary directory: %w",
+	"error al ejecutar systemd-analyze: %w":                            "failed to run systemd-analyze: %w",
+	"las unidades generadas no son válidas:\n%s":                       "the generated units are not valid:\n%s",
+	"✓ Unidades verificadas con systemd-analyze.\n":                    "✓ Units verified with systemd-analyze.\n",
+
+	// upgrade.go, deshacer la instalación
+	"La instalación falló; se deshacen los cambios.": "The installation failed; undoing the changes.",
+	"Restaurado %s\n": "Restored %s\n",
+	"Borrado %s\n":    "Removed %s\n",
+	"No se pudo deshacer el cambio en %s: %v": "Could not undo the change to %s: %v",
+	"No se pudo deshacer %s: %v %s":           "Could not undo %s: %v %s",
+	"No se pudo recargar systemd: %v":         "Could not reload systemd: %v",
+
+	// user.go
+	"error al buscar el directorio personal: %w":                                                                                               "failed to find the home directory: %w",
+	"con --user el puerto debe ser 1024 o mayor (se pidió %d)":                                                                                 "with --user the port must be 1024 or higher (%d was requested)",
+	"--allow no está disponible con --user: systemd solo filtra direcciones en los servicios del sistema":                                      "--allow is not available with --user: systemd only filters addresses for system services",
+	"%s: con --user solo se pueden instalar impresoras conectadas, porque la regla udev necesita root":                                         "%s: with --user only connected printers can be installed, because the udev rule needs root",
+	"--take-over necesita root para deshabilitar servicios del sistema":                                                                        "--take-over needs root to disable system services",
+	"⚠ Los sockets solo funcionarán mientras %s tenga una sesión abierta; para que arranquen con el equipo ejecuta: loginctl enable-linger %s": "⚠ The sockets will only work while %s has an open session; to start them at boot run: loginctl enable-linger %s",
+	"no se puede escribir en %s; agrega el usuario al grupo %s (usermod -aG %s USUARIO) y vuelve a iniciar sesión: %w":                         "cannot write to %s; add the user to the %s group (usermod -aG %s USER) and log in again: %w",
+
+	// main.go, IPv6 y varias direcciones
+	"si el socket en :: acepta también IPv4: both o ipv6-only (BindIPv6Only= de systemd)": "whether the socket on :: also accepts IPv4: both or ipv6-only (systemd's BindIPv6Only=)",
+	"valor inválido %q para BindIPv6Only (default, both o ipv6-only)":                     "invalid value %q for BindIPv6Only (default, both or ipv6-only)",
+
+	// unixsocket.go y main.go, socket Unix
+	"la ruta del socket Unix debe ser absoluta: %q":                                                                 "the Unix socket path must be absolute: %q",
+	"permisos inválidos %q para el socket Unix (en octal, por ejemplo 0660)":                                        "invalid permissions %q for the Unix socket (in octal, for example 0660)",
+	"socket Unix en el que escucha también la impresora, por ejemplo /run/escpos/lp0.sock (solo con una impresora)": "Unix socket the printer also listens on, for example /run/escpos/lp0.sock (only with one printer)",
+	"escuchar solo en el socket Unix, sin TCP":                                                                      "listen only on the Unix socket, without TCP",
+	"permisos del socket Unix en octal, por ejemplo 0660":                                                           "Unix socket permissions in octal, for example 0660",
+	"dueño del socket Unix":                                                                                         "owner of the Unix socket",
+	"grupo del socket Unix, por ejemplo lp":                                                                         "group of the Unix socket, for example lp",
+	"Error: las opciones --unix-* requieren --unix":                                                                 "Error: the --unix-* options require --unix",
+	"Error: --unix solo se puede usar con una impresora":                                                            "Error: --unix can only be used with one printer",
+	"con --user el socket Unix pertenece al usuario; no se pueden usar --unix-user ni --unix-group":                 "with --user the Unix socket belongs to the user; --unix-user and --unix-group cannot be used",
+
+	// lpd.go y main.go, servidor LPD
+	"nombre de cola LPD inválido %q (usa letras, números, '.', '_' o '-')": "invalid LPD queue name %q (use letters, digits, '.', '_' or '-')",
+	"puerto inválido %d":                                                                    "invalid port %d",
+	"orden LPD vacía":                                                                       "empty LPD command",
+	"error al leer la orden LPD: %w":                                                        "failed to read the LPD command: %w",
+	"cola LPD desconocida %q (esta impresora atiende %q)":                                   "unknown LPD queue %q (this printer serves %q)",
+	"%s: cola desconocida\n":                                                                "%s: unknown queue\n",
+	"%s: lista, sin trabajos en espera\n":                                                   "%s: ready, no jobs waiting\n",
+	"orden LPD desconocida %#x":                                                             "unknown LPD command %#x",
+	"El cliente LPD canceló el trabajo":                                                     "The LPD client cancelled the job",
+	"tamaño inválido %q en la orden LPD":                                                    "invalid size %q in the LPD command",
+	"error al leer el archivo de control %s: %w":                                            "failed to read the control file %s: %w",
+	"Archivo LPD %s de %d bytes impreso":                                                    "LPD file %s of %d bytes printed",
+	"el archivo %s terminó antes de tiempo (%d de %d bytes)":                                "the file %s ended early (%d of %d bytes)",
+	"falta el byte final del archivo %s":                                                    "the final byte of the file %s is missing",
+	"Trabajo LPD %q de %s@%s":                                                               "LPD job %q from %s@%s",
+	"nombre de la cola LPD que se atiende":                                                  "name of the LPD queue served",
+	"Uso: %s lpd --queue COLA --device NODO | --to HOST:PUERTO\n":                           "Usage: %s lpd --queue QUEUE --device NODE | --to HOST:PORT\n",
+	"%s: LPD no admite colas de CUPS; CUPS ya puede atender LPD con cups-lpd":               "%s: LPD does not support CUPS queues; CUPS can already serve LPD with cups-lpd",
+	"atender también LPD (LPR) para las aplicaciones que no saben imprimir en RAW":          "also serve LPD (LPR) for applications that cannot print RAW",
+	"nombre de la cola LPD (solo con una impresora; por defecto el nombre de las unidades)": "LPD queue name (only with one printer; defaults to the unit name)",
+	"puerto LPD de la primera impresora; las siguientes usan los puertos consecutivos":      "LPD port of the first printer; the following ones use consecutive ports",
+	"Error: --lpd-queue requiere --lpd":                                                     "Error: --lpd-queue requires --lpd",
+	"Error: --lpd-queue solo se puede usar con una impresora":                               "Error: --lpd-queue can only be used with one printer",
+
+	// ipp.go y main.go, servidor IPP
+	"%s: impresora IPP ESC/POS\n":                                                       "%s: ESC/POS IPP printer\n",
+	"Error en el trabajo IPP %q de %s: %v":                                              "Error in IPP job %q from %s: %v",
+	"Error: la entrada no es un socket: %v":                                             "Error: standard input is not a socket: %v",
+	"Trabajo IPP %q de %s, %d bytes impresos":                                           "IPP job %q from %s, %d bytes printed",
+	"error al abrir el contador de trabajos IPP: %w":                                    "error opening the IPP job counter: %w",
+	"error al bloquear el contador de trabajos IPP: %w":                                 "error locking the IPP job counter: %w",
+	"error al leer el contador de trabajos IPP: %w":                                     "error reading the IPP job counter: %w",
+	"error al guardar el contador de trabajos IPP: %w":                                  "error saving the IPP job counter: %w",
+	"Uso: %s ipp --device NODO | --to HOST:PUERTO\n":                                    "Usage: %s ipp --device NODE | --to HOST:PORT\n",
+	"nombre con el que se anuncia la impresora":                                         "name the printer is announced with",
+	"petición IPP incompleta: %w":                                                       "incomplete IPP request: %w",
+	"%s: IPP no admite colas de CUPS; CUPS ya comparte sus colas por IPP":               "%s: IPP does not support CUPS queues; CUPS already shares its queues over IPP",
+	"atender también IPP para imprimir desde CUPS o Windows sin instalar controladores": "also serve IPP so CUPS or Windows can print without installing drivers",
+	"puerto IPP de la primera impresora; las siguientes usan los puertos consecutivos":  "IPP port of the first printer; the next ones use consecutive ports",
+
+	// cups.go y main.go, cola en crudo de CUPS
+	"crear en CUPS una cola en crudo que imprime en el socket, para las aplicaciones que solo saben imprimir con CUPS": "create a raw CUPS queue that prints to the socket, for applications that can only print through CUPS",
+	"    con la cola de CUPS %s en crudo\n":                                               "    with the raw CUPS queue %s\n",
+	"%s: la impresora ya imprime a través de la cola de CUPS %s; no hace falta otra cola": "%s: the printer already prints through the CUPS queue %s; another queue is not needed",
+	"la cola de CUPS necesita que el socket escuche en TCP; quita --unix-only":            "the CUPS queue needs the socket to listen on TCP; remove --unix-only",
+	"no se encontró lpadmin; instala CUPS para crear la cola":                             "lpadmin not found; install CUPS to create the queue",
+
+	// avahi.go y main.go, anuncio mDNS
+	"anunciar las impresoras por mDNS (Bonjour) con Avahi para que las encuentren las tabletas y las aplicaciones de punto de venta": "advertise the printers over mDNS (Bonjour) with Avahi so tablets and point-of-sale apps can find them",
+	"    anunciada por mDNS": "    advertised over mDNS",
+	"--mdns no está disponible con --user: los servicios de Avahi se instalan en /etc":    "--mdns is not available with --user: Avahi services are installed in /etc",
+	"el anuncio mDNS necesita que el socket escuche en TCP; quita --unix-only":            "mDNS advertisement needs the socket to listen on TCP; remove --unix-only",
+	"⚠ No se encontró %s; el anuncio mDNS solo funcionará cuando se instale avahi-daemon": "⚠ %s not found; mDNS advertisement will only work once avahi-daemon is installed",
+
+	// httpapi.go y main.go, API HTTP
+	"atender también una API HTTP (POST /printers/NOMBRE/jobs, WebSocket en /printers/NOMBRE/ws, gRPC y ePOS-Print en /cgi-bin/epos/service.cgi) para los sistemas de punto de venta y de gestión": "also serve an HTTP API (POST /printers/NAME/jobs, a WebSocket at /printers/NAME/ws, gRPC and ePOS-Print at /cgi-bin/epos/service.cgi) for point-of-sale and back-office systems",
+	"puerto de la API HTTP de la primera impresora; las siguientes usan los puertos consecutivos":                                                                                                  "HTTP API port of the first printer; the next ones use consecutive ports",
+	"%s: la API HTTP no admite colas de CUPS":         "%s: the HTTP API does not support CUPS queues",
+	"impresora desconocida %q (esta API atiende %q)":  "unknown printer %q (this API serves %q)",
+	"el texto supera %d bytes":                        "the text exceeds %d bytes",
+	"Error en el trabajo %d de %s: %v":                "Error in job %d from %s: %v",
+	"Trabajo %d de %d bytes de %s impreso":            "Job %d of %d bytes from %s printed",
+	"número de trabajo inválido %q":                   "invalid job number %q",
+	"no hay ningún trabajo %d":                        "there is no job %d",
+	"nombre de la impresora en las rutas de la API":   "printer name in the API paths",
+	"Uso: %s http --device NODO | --to HOST:PUERTO\n": "Usage: %s http --device NODE | --to HOST:PORT\n",
+	"API HTTP en %s para %s":                          "HTTP API on %s for %s",
+
+	// websocket.go, impresión por WebSocket
+	"la petición no es un saludo de WebSocket":              "the request is not a WebSocket handshake",
+	"no se pudo completar el saludo de WebSocket: %v":       "could not complete the WebSocket handshake: %v",
+	"versión de WebSocket no admitida %q":                   "unsupported WebSocket version %q",
+	"el servidor no permite tomar la conexión":              "the server does not allow taking over the connection",
+	"la trama del cliente no tiene máscara":                 "the client frame is not masked",
+	"el mensaje supera %d bytes":                            "the message exceeds %d bytes",
+	"mensaje WebSocket nuevo antes de terminar el anterior": "new WebSocket message before the previous one ended",
+	"fragmento WebSocket sin mensaje":                       "WebSocket fragment without a message",
+	"trama WebSocket con bits reservados %#x":               "WebSocket frame with reserved bits %#x",
+	"trama de control WebSocket fragmentada":                "fragmented WebSocket control frame",
+	"la trama de control WebSocket supera %d bytes":         "the WebSocket control frame exceeds %d bytes",
+	"el mensaje de texto WebSocket no es UTF-8 válido":      "the WebSocket text message is not valid UTF-8",
+	"trama WebSocket desconocida %#x":                       "unknown WebSocket frame %#x",
+	"Conexión WebSocket de %s":                              "WebSocket connection from %s",
+	"Error en la conexión WebSocket de %s: %v":              "Error in the WebSocket connection from %s: %v",
+
+	// grpc.go, servicio gRPC
+	"mensaje protobuf inválido":                                          "invalid protobuf message",
+	"tipo de campo protobuf no admitido %d":                              "unsupported protobuf field type %d",
+	"mensaje gRPC incompleto: %w":                                        "incomplete gRPC message: %w",
+	"los mensajes gRPC comprimidos no están admitidos":                   "compressed gRPC messages are not supported",
+	"las llamadas gRPC necesitan HTTP/2 y Content-Type application/grpc": "gRPC calls need HTTP/2 and Content-Type application/grpc",
+	"método gRPC desconocido %q":                                         "unknown gRPC method %q",
+
+	// mqtt.go y main.go, puente MQTT
+	"    imprime los mensajes MQTT de %s\n":                                                              "    prints the MQTT messages of %s\n",
+	"Error: el puente MQTT solo se puede configurar con una impresora; usa --config para varias":         "Error: the MQTT bridge can only be set up with one printer; use --config for several",
+	"archivo con la contraseña del broker MQTT":                                                          "file with the MQTT broker password",
+	"broker MQTT del que imprimir mensajes, por ejemplo tcp://192.168.1.5:1883 (solo con una impresora)": "MQTT broker to print messages from, for example tcp://192.168.1.5:1883 (one printer only)",
+	"calidad de servicio de la suscripción MQTT: 0, 1 o 2":                                               "MQTT subscription quality of service: 0, 1 or 2",
+	"temas MQTT que se imprimen, separados por comas, por ejemplo store/42/receipt":                      "MQTT topics to print, comma-separated, for example store/42/receipt",
+	"usuario del broker MQTT":                                                                            "MQTT broker user",
+	"Conectado al broker %s como %s":                                                                     "Connected to broker %s as %s",
+	"Error al imprimir el mensaje de %s: %v":                                                             "Error printing the message from %s: %v",
+	"Error al leer la contraseña del broker: %v":                                                         "Error reading the broker password: %v",
+	"Mensaje de %s de %d bytes impreso":                                                                  "Message from %s of %d bytes printed",
+	"Mensaje retenido de %s ignorado":                                                                    "Retained message from %s ignored",
+	"QoS de MQTT inválida %d (0, 1 o 2)":                                                                 "invalid MQTT QoS %d (0, 1 or 2)",
+	"Suscrito a %s":                                                                                      "Subscribed to %s",
+	"Uso: %s mqtt --broker URL --topic TEMA[,TEMA...] --to HOST:PUERTO\n":                                "Usage: %s mqtt --broker URL --topic TOPIC[,TOPIC...] --to HOST:PORT\n",
+	"archivo con la contraseña del broker":                                                               "file with the broker password",
+	"broker MQTT inválido %q (usa tcp://HOST:PUERTO o mqtts://HOST:PUERTO)":                              "invalid MQTT broker %q (use tcp://HOST:PORT or mqtts://HOST:PORT)",
+	"broker MQTT, por ejemplo tcp://192.168.1.5:1883 o mqtts://broker:8883":                              "MQTT broker, for example tcp://192.168.1.5:1883 or mqtts://broker:8883",
+	"calidad de servicio de la suscripción: 0, 1 o 2":                                                    "subscription quality of service: 0, 1 or 2",
+	"conexión con el broker perdida: %w":                                                                 "connection to the broker lost: %w",
+	"el broker %s rechazó la conexión: %s":                                                               "broker %s refused the connection: %s",
+	"el broker rechazó la suscripción a %s":                                                              "the broker refused the subscription to %s",
+	"el puente MQTT necesita al menos un tema":                                                           "the MQTT bridge needs at least one topic",
+	"error al conectar con el broker %s: %w":                                                             "error connecting to broker %s: %w",
+	"error al imprimir el mensaje de %s: %w":                                                             "error printing the message from %s: %w",
+	"identificador de cliente MQTT (por defecto escpos- y un resumen del equipo y el nombre)":            "MQTT client identifier (default escpos- and a hash of the host and name)",
+	"la ruta del archivo de contraseña debe ser absoluta: %q":                                            "the password file path must be absolute: %q",
+	"nombre de la impresora, para el identificador de cliente":                                           "printer name, for the client identifier",
+	"paquete MQTT inválido":                                                                              "invalid MQTT packet",
+	"respuesta inesperada del broker %s":                                                                 "unexpected response from broker %s",
+	"socket de la impresora: HOST:PUERTO o ruta del socket Unix":                                         "printer socket: HOST:PORT or Unix socket path",
+	"tema MQTT inválido %q":                                                                              "invalid MQTT topic %q",
+	"temas a los que suscribirse, separados por comas":                                                   "topics to subscribe to, comma-separated",
+	"usuario del broker":                                                                                 "broker user",
+	"⚠ %v; se reintenta en %s":                                                                           "⚠ %v; retrying in %s",
+	"versión del protocolo no admitida":                                                                  "unsupported protocol version",
+	"identificador de cliente rechazado":                                                                 "client identifier rejected",
+	"servicio no disponible":                                                                             "service unavailable",
+	"usuario o contraseña incorrectos":                                                                   "wrong user name or password",
+	"no autorizado":                                                                                      "not authorized",
+
+	// epos.go, servicio ePOS-Print
+	"valor inválido %q en el atributo %s de <%s>":                         "invalid value %q in attribute %s of <%s>",
+	"<feed pos> no está admitido":                                         "<feed pos> is not supported",
+	"<command> no es hexadecimal: %w":                                     "<command> is not hexadecimal: %w",
+	"la orden <%s> no está admitida":                                      "the <%s> command is not supported",
+	"tipo de código de barras no admitido %q":                             "unsupported barcode type %q",
+	"los datos del código de barras deben tener entre 1 y 255 caracteres": "barcode data must be between 1 and 255 characters",
+	"tipo de símbolo no admitido %q":                                      "unsupported symbol type %q",
+	"los datos del código QR deben tener entre 1 y 7089 caracteres":       "QR code data must be between 1 and 7089 characters",
+	"modo de imagen no admitido %q":                                       "unsupported image mode %q",
+	"la imagen no está en base64: %w":                                     "the image is not base64: %w",
+	"la imagen tiene %d bytes y deberían ser %d":                          "the image has %d bytes and should have %d",
+	"el documento no contiene <epos-print>":                               "the document has no <epos-print>",
+	"documento ePOS-Print inválido: %w":                                   "invalid ePOS-Print document: %w",
+	"Trabajo ePOS-Print de %s para la impresora desconocida %q":           "ePOS-Print job from %s for unknown printer %q",
+	"Trabajo ePOS-Print de %s rechazado: %v":                              "ePOS-Print job from %s rejected: %v",
+
+	// tls.go y main.go, socket TLS
+	"    cifrado con TLS":                                                                            "    encrypted with TLS",
+	"%s: TLS no admite colas de CUPS":                                                                "%s: TLS does not support CUPS queues",
+	"%s: TLS no admite sockets Unix":                                                                 "%s: TLS does not support Unix sockets",
+	"%s: el puente MQTT no sabe imprimir en un socket TLS":                                           "%s: the MQTT bridge cannot print to a TLS socket",
+	"%s: la cola en crudo de CUPS no sabe imprimir en un socket TLS":                                 "%s: the raw CUPS queue cannot print to a TLS socket",
+	"%s: mDNS anunciaría el socket TLS como RAW sin cifrar":                                          "%s: mDNS would advertise the TLS socket as unencrypted RAW",
+	"--tls necesita las credenciales de systemd (CREDENTIALS_DIRECTORY); usa --tls-cert y --tls-key": "--tls needs the systemd credentials (CREDENTIALS_DIRECTORY); use --tls-cert and --tls-key",
+	"Error al crear %s: %v":                                                                          "Error creating %s: %v",
+	"Error al crear el certificado TLS: %v":                                                          "Error creating the TLS certificate: %v",
+	"Error al escribir %s: %v":                                                                       "Error writing %s: %v",
+	"Error: --tls-cert solo se puede usar con una impresora; usa --config para varias":               "Error: --tls-cert can only be used with one printer; use --config for several",
+	"Error: --tls-cert y --tls-key requieren --tls":                                                  "Error: --tls-cert and --tls-key require --tls",
+	"Error: TLS necesita que la entrada estándar sea un socket":                                      "Error: TLS needs standard input to be a socket",
+	"Uso: %s tls-cert --cert ARCHIVO --key ARCHIVO --hosts NOMBRE[,NOMBRE...]\n":                     "Usage: %s tls-cert --cert FILE --key FILE --hosts NAME[,NAME...]\n",
+	"certificado PEM con el que cifrar las conexiones con TLS":                                       "PEM certificate to encrypt connections with TLS",
+	"certificado PEM del socket TLS (solo con una impresora)":                                        "PEM certificate of the TLS socket (one printer only)",
+	"cifrar el socket RAW con TLS; sin --tls-cert se genera un certificado autofirmado":              "encrypt the RAW socket with TLS; without --tls-cert a self-signed certificate is generated",
+	"cifrar las conexiones con TLS con las credenciales tls-cert y tls-key de systemd":               "encrypt connections with TLS using the tls-cert and tls-key systemd credentials",
+	"clave privada PEM del certificado del socket TLS":                                               "PEM private key of the TLS socket certificate",
+	"clave privada PEM del certificado":                                                              "PEM private key of the certificate",
+	"el certificado y la clave TLS se indican juntos":                                                "the TLS certificate and key must be given together",
+	"error al cargar el certificado TLS: %w":                                                         "error loading the TLS certificate: %w",
+	"error en el saludo TLS con %s: %w":                                                              "TLS handshake with %s failed: %w",
+	"la ruta del certificado o la clave TLS debe ser absoluta: %q":                                   "the TLS certificate or key path must be absolute: %q",
+	"nombres y direcciones IP del certificado, separados por comas":                                  "certificate names and IP addresses, comma-separated",
+	"ruta de la clave privada":                                                                       "private key path",
+	"ruta del certificado":                                                                           "certificate path",
+	"✓ Certificado TLS autofirmado creado en %s (huella SHA-256 %s)\n":                               "✓ Self-signed TLS certificate created at %s (SHA-256 fingerprint %s)\n",
+	"✓ Se conserva el certificado TLS %s (huella SHA-256 %s)\n":                                      "✓ Keeping the TLS certificate %s (SHA-256 fingerprint %s)\n",
+
+	// apikeys.go, httpapi.go y main.go, claves de la API HTTP
+	"%s no contiene ninguna clave":                                                     "%s contains no keys",
+	"%s:%d: la clave de %s está repetida":                                              "%s:%d: the key of %s is repeated",
+	"%s:%d: la clave de %s tiene menos de %d caracteres":                               "%s:%d: the key of %s is shorter than %d characters",
+	"%s:%d: se esperaba \"CLIENTE CLAVE\"":                                             "%s:%d: expected \"CLIENT KEY\"",
+	"Error: --http-api-keys requiere --http-api":                                       "Error: --http-api-keys requires --http-api",
+	"Petición de %s rechazada: %v":                                                     "Request from %s rejected: %v",
+	"archivo con las claves de los clientes, una línea \"CLIENTE CLAVE\" por terminal": "file with the client keys, one \"CLIENT KEY\" line per terminal",
+	"archivo con las claves de los terminales que pueden usar la API HTTP, una línea \"CLIENTE CLAVE\" por terminal": "file with the keys of the terminals allowed to use the HTTP API, one \"CLIENT KEY\" line per terminal",
+	"error al leer las claves de la API: %w":                  "error reading the API keys: %w",
+	"la API necesita una clave (Authorization: Bearer CLAVE)": "the API needs a key (Authorization: Bearer KEY)",
+	"la clave de la API no es válida":                         "the API key is not valid",
+	"la ruta del archivo de claves debe ser absoluta: %q":     "the keys file path must be absolute: %q",
+
+	// firewall.go y main.go, reglas de firewall
+	"    con el puerto abierto en el firewall":                                           "    with the port open in the firewall",
+	"%s está activo y bloquearía las conexiones. ¿Abrir los puertos de las impresoras?":  "%s is active and would block connections. Open the printer ports?",
+	"--open-firewall necesita root para cambiar las reglas del firewall":                 "--open-firewall needs root to change the firewall rules",
+	"abrir los puertos en ufw o firewalld, solo para las redes de --allow si se indican": "open the ports in ufw or firewalld, only for the --allow networks if given",
+	"⚠ No se detectó ufw ni firewalld activos; no se abre ningún puerto":                 "⚠ No active ufw or firewalld found; no port is opened",
+
+	// Límites por minuto de cada cliente
+	"%s superó el límite de %d conexiones por minuto":                                               "%s exceeded the limit of %d connections per minute",
+	"%s superó el límite de %d bytes por minuto":                                                    "%s exceeded the limit of %d bytes per minute",
+	"%s superó el límite de %d bytes por minuto; se corta el trabajo":                               "%s exceeded the limit of %d bytes per minute; cutting the job short",
+	"%s: los límites por minuto no admiten colas de CUPS":                                           "%s: per-minute limits do not support CUPS queues",
+	"%s: los límites de conexiones simultáneas no se aplican en el modo daemon":                     "%s: simultaneous connection limits do not apply in daemon mode",
+	"Conexión rechazada: %v":                                                                        "Connection refused: %v",
+	"conexiones por minuto admitidas desde una misma IP (0 sin límite)":                             "connections per minute accepted from a single IP (0 for no limit)",
+	"bytes por minuto admitidos desde una misma IP; corta el trabajo que los supera (0 sin límite)": "bytes per minute accepted from a single IP; the job that exceeds them is cut short (0 for no limit)",
+	"error al abrir las cuentas de %s: %w":                                                          "error opening the accounting of %s: %w",
+	"error al bloquear las cuentas de %s: %w":                                                       "error locking the accounting of %s: %w",
+	"error al guardar las cuentas de %s: %w":                                                        "error saving the accounting of %s: %w",
+
+	// Módulo de SELinux
+	"⚠ SELinux está en modo enforcing pero no se encontró %s (policycoreutils); es probable que bloquee la impresión": "⚠ SELinux is enforcing but %s (policycoreutils) was not found; it will probably block printing",
+
+	// Perfil de AppArmor
+	"no confinar el servicio con un perfil de AppArmor aunque AppArmor esté activo": "do not confine the service with an AppArmor profile even if AppArmor is active",
+
+	// Métricas de Prometheus
+	"dirección de métricas inválida %q (HOST:PUERTO)": "invalid metrics address %q (HOST:PORT)",
+	"Métricas en http://%s/metrics":                   "Metrics at http://%s/metrics",
+	"Error al publicar las métricas: %v":              "Error serving the metrics: %v",
+	"dirección HOST:PUERTO en la que publicar las métricas de Prometheus (/metrics) y el estado (/healthz)":                      "HOST:PORT address on which to serve the Prometheus metrics (/metrics) and the health check (/healthz)",
+	"publicar métricas de Prometheus en http://HOST:PUERTO/metrics, y el estado en /healthz (solo con --daemon y una impresora)": "serve Prometheus metrics at http://HOST:PORT/metrics, and the health check at /healthz (only with --daemon and a single printer)",
+	"Error: --metrics requiere --daemon":                    "Error: --metrics requires --daemon",
+	"Error: --metrics solo se puede usar con una impresora": "Error: --metrics can only be used with a single printer",
+	"%s: metrics requiere daemon":                           "%s: metrics requires daemon",
+	"    métricas en http://%s/metrics\n":                   "    metrics at http://%s/metrics\n",
+
+	// Archivo de trabajos y reprint
+	"    guarda los trabajos en %s\n":                                                              "    archives jobs in %s\n",
+	"%s: el archivo de trabajos no admite colas de CUPS":                                           "%s: the job archive does not support CUPS queues",
+	"Error al leer el trabajo %s: %v":                                                              "Error reading job %s: %v",
+	"Error: ninguna impresora instalada guarda sus trabajos (--archive)":                           "Error: no installed printer archives its jobs (--archive)",
+	"Error: no se encontró el trabajo %s":                                                          "Error: job %s not found",
+	"Uso: %s reprint --list | TRABAJO\n":                                                           "Usage: %s reprint --list | JOB\n",
+	"antigüedad máxima de los trabajos del archivo (0 sin límite)":                                 "maximum age of archived jobs (0 for no limit)",
+	"borrar del archivo los trabajos más antiguos que esto, por ejemplo 720h (0 sin límite)":       "delete archived jobs older than this, for example 720h (0 for no limit)",
+	"el directorio del archivo de trabajos %q no es una ruta absoluta":                             "job archive directory %q is not an absolute path",
+	"error al leer el archivo de trabajos %s: %w":                                                  "error reading job archive %s: %w",
+	"guardar una copia de cada trabajo en este directorio para poder reimprimirlo":                 "keep a copy of every job in this directory so it can be reprinted",
+	"guardar una copia de cada trabajo recibido en este directorio, para reimprimirlo con reprint": "keep a copy of every received job in this directory, to reprint it with reprint",
+	"los límites del archivo de trabajos no pueden ser negativos":                                  "job archive limits cannot be negative",
+	"mostrar los trabajos guardados":                                                               "list the archived jobs",
+	"trabajos que se conservan en el archivo":                                                      "jobs kept in the archive",
+	"trabajos que se conservan por impresora en el archivo":                                        "jobs kept in the archive per printer",
+	"⚠ No se pudo guardar el trabajo %s: %v":                                                       "⚠ Could not archive job %s: %v",
+	"✓ Trabajo %s del %s reenviado a %s":                                                           "✓ Job %s from %s resent to %s",
+	"impreso":                                                                                      "printed",
+
+	// Cola de trabajos del modo daemon
+	"    con la cola de trabajos pendientes en %s\n":                          "    with the pending job spool in %s\n",
+	"%s: spool requiere daemon":                                               "%s: spool requires daemon",
+	"El trabajo de %s sigue en la cola (%d pendientes): %v":                   "The job from %s stays in the spool (%d pending): %v",
+	"Error: --spool requiere --daemon":                                        "Error: --spool requires --daemon",
+	"Se descarta el trabajo %s de la cola: %v":                                "Dropping job %s from the spool: %v",
+	"Se descarta el trabajo de %s: %v":                                        "Dropping the job from %s: %v",
+	"Trabajo de %d bytes de %s en la cola":                                    "Job of %d bytes from %s spooled",
+	"descartar los trabajos que llevan más de esto en la cola (0 sin límite)": "drop jobs that have been spooled longer than this (0 for no limit)",
+	"el directorio de la cola de trabajos %q no es una ruta absoluta":         "job spool directory %q is not an absolute path",
+	"error al guardar el trabajo en la cola: %w":                              "error spooling the job: %w",
+	"guardar en este directorio los trabajos que llegan con la impresora apagada o sin papel e imprimirlos en orden cuando vuelva (solo con --daemon)": "keep jobs that arrive while the printer is off or out of paper in this directory and print them in order when it comes back (only with --daemon)",
+	"guardar los trabajos en este directorio antes de imprimirlos y reintentarlos mientras la impresora no esté disponible":                            "store jobs in this directory before printing them and retry while the printer is unavailable",
+	"la cola de trabajos está llena (%d trabajos)":                                       "the job spool is full (%d jobs)",
+	"lleva en la cola más de %s":                                                         "spooled for longer than %s",
+	"los límites de la cola de trabajos no pueden ser negativos":                         "job spool limits cannot be negative",
+	"se descartan los trabajos que llevan más de esto en la cola (0 sin límite)":         "jobs spooled longer than this are dropped (0 for no limit)",
+	"trabajos pendientes admitidos en la cola; con la cola llena se rechazan los nuevos": "pending jobs allowed in the spool; new jobs are refused when it is full",
+	"trabajos que admite la cola; con la cola llena se rechazan los nuevos":              "jobs the spool accepts; new jobs are refused when it is full",
+
+	// Estado DLE EOT de la impresora
+	"  Estado de la impresora: %s\n": "  Printer state: %s\n",
+	"con un error":                   "with an error",
+	"fuera de línea":                 "offline",
+	"imprimiendo":                    "printing",
+	"lista":                          "ready",
+	"sin papel":                      "out of paper",
+	"tapa abierta":                   "cover open",
+
+	// Página del asistente web
+	"Configuración de impresora ESC/POS": "ESC/POS printer setup",
+	"✓ Configuración completa. La máquina está lista para aceptar trabajos de impresión en %s.": "✓ Setup complete. The machine is ready to accept print jobs on %s.",
+	"Impresora": "Printer",
+	"Nombre (por ejemplo \"caja izquierda\"):": "Name (for example \"left till\"):",
+	"Puerto TCP:":                                   "TCP port:",
+	"Escuchar en la dirección:":                     "Listen on address:",
+	"(0.0.0.0 para todas las interfaces)":           "(0.0.0.0 for all interfaces)",
+	"Imprimir la IP de la máquina en cada arranque": "Print the machine's IP on every boot",
+	"Seguridad": "Security",
+	"Redes que pueden imprimir, separadas por comas (vacío para todas):": "Networks allowed to print, comma-separated (empty for all):",
+	"Cifrar el socket con TLS (certificado autofirmado)":                 "Encrypt the socket with TLS (self-signed certificate)",
+	"Atender también la API HTTP":                                        "Also serve the HTTP API",
+	"Archivo con las claves de la API HTTP (vacío para no pedir clave):": "HTTP API keys file (empty to require no key):",
+	"Instalar": "Install",
+	"No se encontraron impresoras USB en /dev/usb/lpX. Conecta la impresora y recarga la página.":        "No USB printers found in /dev/usb/lpX. Connect the printer and reload the page.",
+	"Falta el token del asistente o no es válido: abre la dirección que se mostró al iniciar setup-web.": "The wizard token is missing or invalid: open the address shown when setup-web started.",
+	"el archivo de claves necesita la API HTTP":                                                          "the keys file requires the HTTP API",
+
+	// Descripción de las impresoras (usb.go)
+	"puerto paralelo":  "parallel port",
+	"puerto serie":     "serial port",
+	"impresora de red": "network printer",
+	"no conectada":     "not connected",
+	"puerto USB %s":    "USB port %s",
+	"serie %s":         "serial number %s",
+
+	// Reinicio automático del puerto USB
+	"reiniciar el puerto USB de la impresora cuando deja de aceptar datos y no responde, como usb-reset": "reset the printer's USB port when it stops accepting data and does not respond, like usb-reset",
+	"reiniciar el puerto USB de la impresora si deja de aceptar datos y no responde a DLE EOT":           "reset the printer's USB port if it stops accepting data and does not answer DLE EOT",
+	"%s: el reinicio automático del puerto USB solo funciona con impresoras USB":                         "%s: automatic USB port reset only works with USB printers",
+	"%s: el reinicio automático del puerto USB no admite colas de CUPS":                                  "%s: automatic USB port reset does not support CUPS queues",
+	"La impresora %s responde (%s); no se reinicia su puerto USB":                                        "Printer %s responds (%s); its USB port is not reset",
+	"La impresora %s no responde; se reinicia su puerto USB":                                             "Printer %s does not respond; resetting its USB port",
+	"No se pudo reiniciar el puerto USB de %s: %v":                                                       "Could not reset the USB port of %s: %v",
+
+	// Límites de conexiones de la API HTTP
+	"conexiones simultáneas admitidas (0 sin límite)":   "simultaneous connections accepted (0 for no limit)",
+	"se alcanzó el límite de %d conexiones simultáneas": "the limit of %d simultaneous connections was reached",
+	"%s superó el límite de %d conexiones simultáneas":  "%s exceeded the limit of %d simultaneous connections",
+
+	// Tipos de archivo de installPlan
+	"servicio":           "service",
+	"temporizador":       "timer",
+	"regla udev":         "udev rule",
+	"servicio de Avahi":  "Avahi service",
+	"reglas de firewall": "firewall rules",
+	"módulo de SELinux":  "SELinux module",
+
+	// Respuestas de askYesNo y estado de status
+	"[s/N]":                               "[y/N]",
+	"[S/n]":                               "[Y/n]",
+	"listo":                               "ready",
+	"el servicio no indica una impresora": "the service does not specify a printer",
+	"no es un dispositivo de caracteres":  "not a character device",
+	"sin permiso de escritura: ":          "no write permission: ",
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// installation Describe las unidades que el instalador dejó en el sistema.
+type installation struct {
+	Name    string // Nombre base de las unidades, por ejemplo escpos-printer-lp0
+	Listen  string // Valor de ListenStream=, por ejemplo 0.0.0.0:9100
+	Device  string // Nodo de la impresora usado por el servicio
+	Queue   string // Cola de CUPS usada por el servicio, vacía si escribe en el nodo
+	Remote  string // Dirección HOST:PUERTO de la impresora de red, vacía si no reenvía a la red
+	Daemon  bool   // Modo daemon: servicio sin plantilla con Accept=no
+	TLS     bool   // El socket cifra las conexiones con TLS
+	Archive string // Directorio en el que el servicio guarda los trabajos, vacío si no los guarda
+	Metrics string // Dirección HOST:PUERTO de /metrics y /healthz del daemon, vacía si no las publica
+
+	Frontend string // Protocolo que atiende el socket: vacío para RAW, frontendLPD, frontendIPP o frontendHTTP
+}
+
+// unitValues Devuelve todos los valores de una clave en el contenido de una unidad systemd.
+func unitValues(content, key string) []string {
+	var values []string
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		k, v, ok := strings.Cut(line, "=")
+		if ok && strings.TrimSpace(k) == key {
+			values = append(values, strings.TrimSpace(v))
+		}
+	}
+	return values
+}
+
+// unitValue Devuelve el primer valor de una clave, o una cadena vacía.
+func unitValue(content, key string) string {
+	if values := unitValues(content, key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// deviceFromExecStart Extrae el nodo de la impresora de la línea ExecStart=
+// del servicio, ignorando /dev/null.
+func deviceFromExecStart(execStart string) string {
+	for _, field := range strings.Fields(execStart) {
+		if strings.HasPrefix(field, "/dev/") && field != "/dev/null" {
+			return field
+		}
+	}
+	return ""
+}
+
+// readInstallation Lee el par de unidades con el nombre base indicado.
+func readInstallation(name string) (installation, error) {
+	socket, err := os.ReadFile(socketUnitPath(name))
+	if err != nil {
+		return installation{}, fmt.Errorf(tr("no se encontró una instalación (%s): %w"), socketUnitPath(name), err)
+	}
+	daemon := false
+	service, err := os.ReadFile(serviceUnitPath(name))
+	if os.IsNotExist(err) {
+		daemon = true
+		service, err = os.ReadFile(daemonServicePath(name))
+	}
+	if err != nil {
+		return installation{}, fmt.Errorf(tr("no se encontró una instalación (%s): %w"), serviceUnitPath(name), err)
+	}
+
+	return installation{
+		Daemon:  daemon,
+		Name:    name,
+		Listen:  unitValue(string(socket), "ListenStream"),
+		Device:  deviceFromExecStart(unitValue(string(service), "ExecStart")),
+		Queue:   queueFromExecStart(unitValue(string(service), "ExecStart")),
+		Remote:  remoteFromExecStart(unitValue(string(service), "ExecStart")),
+		TLS:     tlsFromExecStart(unitValue(string(service), "ExecStart")),
+		Archive: archiveFromExecStart(unitValue(string(service), "ExecStart")),
+		Metrics: metricsFromExecStart(unitValue(string(service), "ExecStart")),
+
+		Frontend: frontendFromExecStart(unitValue(string(service), "ExecStart")),
+	}, nil
+}
+
+// readInstallations Devuelve todas las instalaciones presentes en el sistema,
+// una por cada par escpos-printer*.socket / escpos-printer*@.service.
+func readInstallations() ([]installation, error) {
+	matches, err := filepath.Glob(filepath.Join(unitDir, defaultUnitName+"*.socket"))
+	if err != nil {
+		return nil, fmt.Errorf(tr("error al buscar las unidades instaladas: %w"), err)
+	}
+
+	var installs []installation
+	for _, match := range matches {
+		name := strings.TrimSuffix(filepath.Base(match), ".socket")
+		inst, err := readInstallation(name)
+		if err != nil {
+			continue // Un socket sin su servicio no es una instalación nuestra completa
+		}
+		installs = append(installs, inst)
+	}
+	return installs, nil
+}
+
+// findInstallation Devuelve la instalación que usa el dispositivo indicado o,
+// si no se indica ninguno, la única instalación existente.
+func findInstallation(device string) (installation, error) {
+	all, err := readInstallations()
+	if err != nil {
+		return installation{}, err
+	}
+	// Las unidades de los otros protocolos no cuentan como otra impresora.
+	var installs []installation
+	for _, inst := range all {
+		if inst.Frontend == "" {
+			installs = append(installs, inst)
+		}
+	}
+	if len(installs) == 0 {
+		return installation{}, fmt.Errorf(tr("no se encontró ninguna instalación en %s"), unitDir)
+	}
+	if device == "" {
+		if len(installs) > 1 {
+			return installation{}, fmt.Errorf(tr("hay %d impresoras instaladas; indica cuál usar"), len(installs))
+		}
+		return installs[0], nil
+	}
+	for _, inst := range installs {
+		if sameDevice(inst.Device, device) {
+			return inst, nil
+		}
+	}
+	return installation{}, fmt.Errorf(tr("no hay ninguna instalación para %s"), device)
+}
+
+// currentInstallation Devuelve la instalación existente que ya atiende a la
+// impresora: la que escribe en su nodo (directamente o por el enlace estable),
+// reenvía a su dirección o usa su cola de CUPS.
+func (opts installOptions) currentInstallation(installs []installation) (installation, bool) {
+	for _, inst := range installs {
+		switch {
+		case inst.Frontend != "":
+			// Las unidades de los otros protocolos acompañan al socket RAW, que es el que da el nombre.
+		case inst.Device != "" && opts.Printer.Kind != kindNetwork && sameDevice(inst.Device, opts.Printer.Path),
+			inst.Remote != "" && inst.Remote == opts.Printer.Path,
+			inst.Queue != "" && inst.Queue == opts.CUPSQueue:
+			return inst, true
+		}
+	}
+	return installation{}, false
+}
+
+// sameDevice Indica si dos rutas llevan al mismo nodo, resolviendo los
+// enlaces estables de udev.
+func sameDevice(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ra, errA := filepath.EvalSymlinks(a)
+	rb, errB := filepath.EvalSymlinks(b)
+	return errA == nil && errB == nil && ra == rb
+}
+
+// Port Devuelve el puerto TCP en el que escucha el socket instalado.
+func (inst installation) Port() (int, error) {
+	_, port, err := net.SplitHostPort(inst.Listen)
+	if err != nil {
+		// ListenStream= admite solo el puerto, por ejemplo "9100"
+		port = inst.Listen
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return 0, fmt.Errorf(tr("no se pudo interpretar ListenStream=%s"), inst.Listen)
+	}
+	return n, nil
+}
+
+// localAddr Devuelve la dirección por la que esta máquina puede imprimir en
+// el socket de la instalación. Una instalación solo Unix escucha en la ruta
+// del socket.
+func (inst installation) localAddr() (string, error) {
+	if filepath.IsAbs(inst.Listen) {
+		return inst.Listen, nil
+	}
+	port, err := inst.Port()
+	if err != nil {
+		return "", err
+	}
+	bind, _, _ := net.SplitHostPort(inst.Listen)
+	return net.JoinHostPort(loopbackHost(bind), strconv.Itoa(port)), nil
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultIPPPort Puerto estándar de IPP.
+const defaultIPPPort = 631
+
+// frontendIPP Valor de installOptions.Frontend para el socket IPP.
+const frontendIPP = "ipp"
+
+// Operaciones de IPP (RFC 8011) que atiende el servidor.
+const (
+	ippPrintJob             = 0x0002
+	ippValidateJob          = 0x0004
+	ippCancelJob            = 0x0008
+	ippGetJobAttributes     = 0x0009
+	ippGetJobs              = 0x000A
+	ippGetPrinterAttributes = 0x000B
+)
+
+// Códigos de estado de IPP.
+const (
+	ippOK                    = 0x0000
+	ippBadRequest            = 0x0400
+	ippNotPossible           = 0x0404
+	ippNotFound              = 0x0406
+	ippFormatNotSupported    = 0x040A
+	ippOperationNotSupported = 0x0501
+	ippVersionNotSupported   = 0x0503
+	ippDeviceError           = 0x0504
+)
+
+// Etiquetas de grupo y de valor de IPP.
+const (
+	ippTagOperation byte = 0x01
+	ippTagEnd       byte = 0x03
+	ippTagJob       byte = 0x02
+	ippTagPrinter   byte = 0x04
+	ippTagInteger   byte = 0x21
+	ippTagBoolean   byte = 0x22
+	ippTagEnum      byte = 0x23
+	ippTagText      byte = 0x41
+	ippTagName      byte = 0x42
+	ippTagKeyword   byte = 0x44
+	ippTagURI       byte = 0x45
+	ippTagCharset   byte = 0x47
+	ippTagLanguage  byte = 0x48
+	ippTagMimeMedia byte = 0x49
+)
+
+// Valores de job-state y printer-state.
+const (
+	ippJobCompleted = 9
+	ippPrinterIdle  = 3
+)
+
+// ippFormats Formatos de documento que se aceptan: todos llegan a la
+// impresora tal cual, así que solo tienen sentido los datos ya en ESC/POS.
+var ippFormats = []string{"application/octet-stream", "application/vnd.cups-raw", "text/plain"}
+
+// ippSettings Servidor IPP de una impresora, para imprimir desde CUPS o
+// Windows con el controlador genérico, sin instalar nada más en el cliente.
+type ippSettings struct {
+	Port int `yaml:"port"` // Puerto TCP, 0 para defaultIPPPort
+}
+
+// validate Comprueba el puerto.
+func (s *ippSettings) validate() error {
+	if s.Port == 0 {
+		s.Port = defaultIPPPort
+	}
+	if s.Port < 1 || s.Port > 65535 {
+		return fmt.Errorf(tr("puerto inválido %d"), s.Port)
+	}
+	return nil
+}
+
+// ippOptions Devuelve las opciones del par de unidades IPP de la impresora:
+// las mismas que las del socket RAW, en el puerto de IPP y sin socket Unix.
+func (opts installOptions) ippOptions() installOptions {
+	ipp := opts
+	ipp.Frontend = frontendIPP
+	ipp.Port = opts.IPP.Port
+	ipp.Unix = nil
+	ipp.TLS = nil
+	ipp.Daemon = false
+	return ipp
+}
+
+// ippExecStart Devuelve el comando del servicio IPP. El nombre de la
+// impresora que se anuncia es el de las unidades.
+func ippExecStart(opts installOptions) string {
+	target := " --device " + opts.devicePath()
+	if opts.Printer.Kind == kindNetwork {
+		target = " --to " + opts.Printer.Path
+	}
+	return installedBinaryPath + " ipp" + target + " --name " + opts.unitName() + timeoutFlags(opts) + rateFlags(opts) + archiveFlags(opts) + usbResetFlags(opts)
+}
+
+// ippAttr Atributo de IPP con sus valores ya codificados.
+type ippAttr struct {
+	tag    byte
+	name   string
+	values [][]byte
+}
+
+// ippStrings Crea un atributo de texto, palabra clave, URI...
+func ippStrings(tag byte, name string, values ...string) ippAttr {
+	a := ippAttr{tag: tag, name: name}
+	for _, v := range values {
+		a.values = append(a.values, []byte(v))
+	}
+	return a
+}
+
+// ippInts Crea un atributo entero o enumerado.
+func ippInts(tag byte, name string, values ...int32) ippAttr {
+	a := ippAttr{tag: tag, name: name}
+	for _, v := range values {
+		a.values = append(a.values, binary.BigEndian.AppendUint32(nil, uint32(v)))
+	}
+	return a
+}
+
+// ippGroup Grupo de atributos de una respuesta.
+type ippGroup struct {
+	tag   byte
+	attrs []ippAttr
+}
+
+// ippRequest Cabecera y atributos de operación de una petición IPP.
+type ippRequest struct {
+	Version   [2]byte
+	Operation uint16
+	RequestID uint32
+	Attrs     map[string][]byte // Primer valor de cada atributo de operación
+}
+
+// readIPPRequest Lee la cabecera y los atributos de una petición. Lo que
+// queda en br después es el documento.
+func readIPPRequest(br *bufio.Reader) (ippRequest, error) {
+	var req ippRequest
+	var header [8]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return req, fmt.Errorf(tr("petición IPP incompleta: %w"), err)
+	}
+	copy(req.Version[:], header[:2])
+	req.Operation = binary.BigEndian.Uint16(header[2:4])
+	req.RequestID = binary.BigEndian.Uint32(header[4:8])
+	req.Attrs = make(map[string][]byte)
+
+	group := byte(0)
+	for {
+		tag, err := br.ReadByte()
+		if err != nil {
+			return req, fmt.Errorf(tr("petición IPP incompleta: %w"), err)
+		}
+		if tag == ippTagEnd {
+			return req, nil
+		}
+		if tag < 0x10 {
+			group = tag
+			continue
+		}
+		name, err := readIPPField(br)
+		if err != nil {
+			return req, err
+		}
+		value, err := readIPPField(br)
+		if err != nil {
+			return req, err
+		}
+		// Un nombre vacío es otro valor del atributo anterior.
+		if group == ippTagOperation && len(name) > 0 {
+			req.Attrs[string(name)] = value
+		}
+	}
+}
+
+// readIPPField Lee un campo con su longitud de dos bytes delante.
+func readIPPField(br *bufio.Reader) ([]byte, error) {
+	var n uint16
+	if err := binary.Read(br, binary.BigEndian, &n); err != nil {
+		return nil, fmt.Errorf(tr("petición IPP incompleta: %w"), err)
+	}
+	field := make([]byte, n)
+	if _, err := io.ReadFull(br, field); err != nil {
+		return nil, fmt.Errorf(tr("petición IPP incompleta: %w"), err)
+	}
+	return field, nil
+}
+
+// ippResponse Codifica una respuesta con los atributos de operación
+// obligatorios seguidos de los grupos indicados.
+func ippResponse(req ippRequest, status uint16, groups ...ippGroup) []byte {
+	var b bytes.Buffer
+	b.Write(req.Version[:])
+	binary.Write(&b, binary.BigEndian, status)
+	binary.Write(&b, binary.BigEndian, req.RequestID)
+	groups = append([]ippGroup{{ippTagOperation, []ippAttr{
+		ippStrings(ippTagCharset, "attributes-charset", "utf-8"),
+		ippStrings(ippTagLanguage, "attributes-natural-language", "en"),
+	}}}, groups...)
+	for _, g := range groups {
+		b.WriteByte(g.tag)
+		for _, a := range g.attrs {
+			for i, v := range a.values {
+				name := a.name
+				if i > 0 {
+					name = ""
+				}
+				b.WriteByte(a.tag)
+				binary.Write(&b, binary.BigEndian, uint16(len(name)))
+				b.WriteString(name)
+				binary.Write(&b, binary.BigEndian, uint16(len(v)))
+				b.Write(v)
+			}
+		}
+	}
+	b.WriteByte(ippTagEnd)
+	return b.Bytes()
+}
+
+// ippPrinterAttributes Atributos de la impresora para Get-Printer-Attributes.
+// Se devuelven todos, sin mirar requested-attributes: son pocos.
+func ippPrinterAttributes(uri, name string, started time.Time) ippGroup {
+	boolTrue := ippAttr{tag: ippTagBoolean, name: "printer-is-accepting-jobs", values: [][]byte{{1}}}
+	return ippGroup{ippTagPrinter, []ippAttr{
+		ippStrings(ippTagURI, "printer-uri-supported", uri),
+		ippStrings(ippTagKeyword, "uri-security-supported", "none"),
+		ippStrings(ippTagKeyword, "uri-authentication-supported", "none"),
+		ippStrings(ippTagName, "printer-name", name),
+		ippStrings(ippTagText, "printer-make-and-model", "ESC/POS raw"),
+		ippInts(ippTagEnum, "printer-state", ippPrinterIdle),
+		ippStrings(ippTagKeyword, "printer-state-reasons", "none"),
+		ippStrings(ippTagKeyword, "ipp-versions-supported", "1.1", "2.0"),
+		ippInts(ippTagEnum, "operations-supported", ippPrintJob, ippValidateJob, ippCancelJob, ippGetJobAttributes, ippGetJobs, ippGetPrinterAttributes),
+		ippStrings(ippTagCharset, "charset-configured", "utf-8"),
+		ippStrings(ippTagCharset, "charset-supported", "utf-8"),
+		ippStrings(ippTagLanguage, "natural-language-configured", "en"),
+		ippStrings(ippTagLanguage, "generated-natural-language-supported", "en"),
+		ippStrings(ippTagMimeMedia, "document-format-default", ippFormats[0]),
+		ippStrings(ippTagMimeMedia, "document-format-supported", ippFormats...),
+		boolTrue,
+		ippInts(ippTagInteger, "queued-job-count", 0),
+		ippStrings(ippTagKeyword, "pdl-override-supported", "not-attempted"),
+		ippStrings(ippTagKeyword, "compression-supported", "none"),
+		ippInts(ippTagInteger, "printer-up-time", int32(time.Since(started).Seconds())+1),
+	}}
+}
+
+// ippJobAttributes Atributos de un trabajo: todos se imprimen al recibirlos,
+// así que siempre están terminados.
+func ippJobAttributes(uri string, id int32) ippGroup {
+	return ippGroup{ippTagJob, []ippAttr{
+		ippStrings(ippTagURI, "job-uri", fmt.Sprintf("%s/%d", uri, id)),
+		ippInts(ippTagInteger, "job-id", id),
+		ippInts(ippTagEnum, "job-state", ippJobCompleted),
+		ippStrings(ippTagKeyword, "job-state-reasons", "job-completed-successfully"),
+	}}
+}
+
+// ippJobCounter Numera los trabajos impresos por ipp. Cada conexión es un
+// proceso, así que el último número se guarda en un archivo del directorio
+// de ejecución, bloqueado con flock mientras se actualiza; sin directorio se
+// cuenta en memoria.
+type ippJobCounter struct {
+	path string
+	mu   sync.Mutex
+	last int32
+}
+
+// newIPPJobCounter Devuelve el contador de trabajos guardado en dir.
+func newIPPJobCounter(dir string) *ippJobCounter {
+	c := &ippJobCounter{}
+	if dir != "" {
+		c.path = filepath.Join(dir, "ipp-job-id")
+	}
+	return c
+}
+
+// update Aplica fn al último número y guarda el resultado. Si el archivo
+// falla sigue contando en memoria.
+func (c *ippJobCounter) update(fn func(last int32) int32) int32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path != "" {
+		last, err := c.updateFile(fn)
+		if err == nil {
+			c.last = last
+			return last
+		}
+		logger.Warn(fmt.Sprintf("⚠ %v", err))
+	}
+	c.last = fn(c.last)
+	return c.last
+}
+
+// updateFile Aplica fn al número guardado en el archivo y lo reemplaza.
+func (c *ippJobCounter) updateFile(fn func(last int32) int32) (int32, error) {
+	f, err := os.OpenFile(c.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return 0, fmt.Errorf(tr("error al abrir el contador de trabajos IPP: %w"), err)
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return 0, fmt.Errorf(tr("error al bloquear el contador de trabajos IPP: %w"), err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return 0, fmt.Errorf(tr("error al leer el contador de trabajos IPP: %w"), err)
+	}
+	saved, _ := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+	last := fn(int32(saved))
+	if err := f.Truncate(0); err != nil {
+		return 0, fmt.Errorf(tr("error al guardar el contador de trabajos IPP: %w"), err)
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(int(last))+"\n"), 0); err != nil {
+		return 0, fmt.Errorf(tr("error al guardar el contador de trabajos IPP: %w"), err)
+	}
+	return last, nil
+}
+
+// next Devuelve el número del trabajo siguiente; vuelve a 1 al agotar los
+// enteros de 32 bits que admite job-id.
+func (c *ippJobCounter) next() int32 {
+	return c.update(func(last int32) int32 {
+		if last < 1 || last == math.MaxInt32 {
+			return 1
+		}
+		return last + 1
+	})
+}
+
+// known Indica si id es el número de un trabajo ya impreso.
+func (c *ippJobCounter) known(id int32) bool {
+	last := c.update(func(last int32) int32 { return last })
+	return id >= 1 && id <= last
+}
+
+// ippHandler Atiende las peticiones HTTP de IPP. Los documentos de Print-Job
+// se pasan tal cual a deliver, que es el relay de la impresora, y jobs los
+// numera.
+func ippHandler(name string, jobs *ippJobCounter, deliver func(io.Reader) (int64, error)) http.HandlerFunc {
+	started := time.Now()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			fmt.Fprintf(w, tr("%s: impresora IPP ESC/POS\n"), name)
+			return
+		}
+		br := bufio.NewReader(r.Body)
+		req, err := readIPPRequest(br)
+		if err != nil {
+			logger.Warn(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		uri := "ipp://" + r.Host + "/ipp/print"
+		reply := func(status uint16, groups ...ippGroup) {
+			w.Header().Set("Content-Type", "application/ipp")
+			w.Write(ippResponse(req, status, groups...))
+		}
+		if req.Version[0] < 1 || req.Version[0] > 2 {
+			req.Version = [2]byte{1, 1}
+			reply(ippVersionNotSupported)
+			return
+		}
+
+		switch req.Operation {
+		case ippGetPrinterAttributes:
+			reply(ippOK, ippPrinterAttributes(uri, name, started))
+		case ippGetJobs:
+			reply(ippOK)
+		case ippGetJobAttributes:
+			v := req.Attrs["job-id"]
+			if len(v) != 4 || !jobs.known(int32(binary.BigEndian.Uint32(v))) {
+				reply(ippNotFound)
+				return
+			}
+			reply(ippOK, ippJobAttributes(uri, int32(binary.BigEndian.Uint32(v))))
+		case ippCancelJob:
+			reply(ippNotPossible)
+		case ippValidateJob, ippPrintJob:
+			if format := string(req.Attrs["document-format"]); format != "" && !slices.Contains(ippFormats, format) {
+				reply(ippFormatNotSupported)
+				return
+			}
+			if req.Operation == ippValidateJob {
+				reply(ippOK)
+				return
+			}
+			job, user := string(req.Attrs["job-name"]), string(req.Attrs["requesting-user-name"])
+			n, err := deliver(br)
+			if err != nil {
+				logger.Error(fmt.Sprintf(tr("Error en el trabajo IPP %q de %s: %v"), job, user, err), "job", job, "user", user)
+				reply(ippDeviceError)
+				return
+			}
+			logger.Info(fmt.Sprintf(tr("Trabajo IPP %q de %s, %d bytes impresos"), job, user, n), "job", job, "user", user, "bytes", n)
+			reply(ippOK, ippJobAttributes(uri, jobs.next()))
+		default:
+			reply(ippOperationNotSupported)
+		}
+	}
+}
+
+// connListener Listener que entrega una única conexión, la que pasa systemd
+// con Accept=yes, y termina cuando esa conexión se cierra.
+type connListener struct {
+	conn   net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+// closeNotifyConn Avisa al listener cuando el servidor HTTP cierra la conexión.
+type closeNotifyConn struct {
+	net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *closeNotifyConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	var conn net.Conn
+	l.once.Do(func() { conn = &closeNotifyConn{Conn: l.conn, closed: l.closed} })
+	if conn != nil {
+		return conn, nil
+	}
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *connListener) Close() error   { return nil }
+func (l *connListener) Addr() net.Addr { return l.conn.LocalAddr() }
+
+// runIPP Implementa el subcomando "ipp", que ejecuta el servicio IPP de cada
+// impresora: atiende por HTTP la conexión entrante (la entrada estándar) y
+// entrega los documentos al dispositivo o a la impresora de red.
+func runIPP(args []string) {
+	fs := flag.NewFlagSet("ipp", flag.ExitOnError)
+	device := fs.String("device", "", tr("nodo de la impresora, por ejemplo /dev/usb/lp0"))
+	to := fs.String("to", "", tr("dirección HOST:PUERTO de la impresora"))
+	name := fs.String("name", defaultUnitName, tr("nombre con el que se anuncia la impresora"))
+	timeout := fs.Duration("timeout", defaultWriteTimeout, tr("tiempo máximo de espera a que la impresora acepte datos"))
+	idle := fs.Duration("idle-timeout", defaultIdleTimeout, tr("tiempo máximo sin recibir datos del cliente (0 sin límite)"))
+	total := fs.Duration("job-timeout", defaultJobTimeout, tr("duración máxima de un trabajo (0 sin límite)"))
+	newLimiter := rateServerFlags(fs)
+	newDelivery := deliveryServerFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s ipp --device NODO | --to HOST:PUERTO\n"), filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if (*device == "") == (*to == "") {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	conn, err := net.FileConn(os.Stdin)
+	if err != nil {
+		log.Fatalf(tr("Error: la entrada no es un socket: %v"), err)
+	}
+	// Como en relay, cada conexión es un proceso y las cuentas de los
+	// clientes se comparten en el directorio de ejecución del servicio.
+	limiter := newLimiter(os.Getenv("RUNTIME_DIRECTORY"))
+	client := rateClient(conn.RemoteAddr())
+	if limiter != nil {
+		if err := limiter.admit(client); err != nil {
+			logger.Warn(fmt.Sprintf(tr("Conexión rechazada: %v"), err), "client", client)
+			return
+		}
+	}
+	delivery := newDelivery(*device, *to, *timeout, *total)
+	deliver := func(r io.Reader) (int64, error) {
+		if limiter != nil {
+			r = limiter.limit(r, client)
+		}
+		n, err := delivery.deliver(r, conn.RemoteAddr().String())
+		if limiter != nil {
+			limiter.record(client, n)
+		}
+		return n, err
+	}
+	srv := &http.Server{
+		Handler:     ippHandler(*name, newIPPJobCounter(os.Getenv("RUNTIME_DIRECTORY")), deliver),
+		ReadTimeout: *total,
+		IdleTimeout: *idle,
+		ErrorLog:    log.New(io.Discard, "", 0),
+	}
+	ln := &connListener{conn: conn, closed: make(chan struct{})}
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Fatalf("Error: %v", err)
+	}
+}
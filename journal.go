@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// journalSocket Socket del protocolo nativo de journald.
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalFieldPrefix Prefijo de los campos propios en el journal, para
+// buscarlos con journalctl ESC_POS_JOB_ID=... sin chocar con los de systemd.
+const journalFieldPrefix = "ESC_POS_"
+
+// journalStream Indica si la salida de error va al journal: systemd pone en
+// JOURNAL_STREAM el dispositivo y el inodo del flujo que conecta con él.
+func journalStream() bool {
+	stream := os.Getenv("JOURNAL_STREAM")
+	if stream == "" {
+		return false
+	}
+	info, err := os.Stderr.Stat()
+	if err != nil {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && stream == fmt.Sprintf("%d:%d", st.Dev, st.Ino)
+}
+
+// journalHandler Envía cada mensaje a journald con el protocolo nativo, con
+// los datos del mensaje (cliente, bytes...) como campos ESC_POS_* propios,
+// que el texto de la salida estándar perdería.
+type journalHandler struct {
+	level slog.Level
+	conn  *net.UnixConn
+	attrs []slog.Attr
+}
+
+// newJournalHandler Conecta con journald.
+func newJournalHandler(level slog.Level) (journalHandler, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return journalHandler{}, err
+	}
+	return journalHandler{level: level, conn: conn}, nil
+}
+
+func (h journalHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h journalHandler) Handle(_ context.Context, r slog.Record) error {
+	var b bytes.Buffer
+	journalField(&b, "MESSAGE", strings.TrimSpace(r.Message))
+	journalField(&b, "PRIORITY", strconv.Itoa(journalPriority(r.Level)))
+	journalField(&b, "SYSLOG_IDENTIFIER", "escpos-socket-install")
+	add := func(a slog.Attr) bool {
+		journalField(&b, journalFieldName(a.Key), a.Value.Resolve().String())
+		return true
+	}
+	for _, a := range h.attrs {
+		add(a)
+	}
+	r.Attrs(add)
+	_, err := h.conn.Write(b.Bytes())
+	return err
+}
+
+func (h journalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return h
+}
+
+func (h journalHandler) WithGroup(string) slog.Handler { return h }
+
+// journalPriority Devuelve la prioridad de syslog del nivel.
+func journalPriority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	}
+	return 7
+}
+
+// journalFieldName Convierte la clave de un dato en un nombre de campo
+// válido: mayúsculas, cifras y guiones bajos, con el prefijo propio.
+func journalFieldName(key string) string {
+	name := []byte(journalFieldPrefix + strings.ToUpper(key))
+	for i, c := range name {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
+
+// journalField Añade un campo al mensaje. Los valores con saltos de línea
+// van en el formato binario: el nombre, su longitud en 64 bits y el valor.
+func journalField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(b, "%s=%s\n", name, value)
+		return
+	}
+	b.WriteString(name + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
+
+// jobRecord Datos de un trabajo para el registro: un mensaje por conexión con
+// su identificador, el cliente, los bytes, la duración y el resultado, para
+// saber qué se imprimió, cuándo y desde dónde.
+type jobRecord struct {
+	ID     string    `json:"id"`
+	Client string    `json:"client"`
+	Target string    `json:"target"`
+	Start  time.Time `json:"start"`
+}
+
+// newJobRecord Empieza el registro de un trabajo.
+func newJobRecord(client, target string) jobRecord {
+	return jobRecord{ID: newJobID(), Client: client, Target: target, Start: time.Now()}
+}
+
+// newJobID Devuelve un identificador aleatorio para el trabajo.
+func newJobID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// attrs Devuelve los datos del trabajo terminado para el registro.
+func (j jobRecord) attrs(n int64, err error) []any {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	attrs := []any{
+		"job_id", j.ID,
+		"client", j.Client,
+		"target", j.Target,
+		"bytes", n,
+		"duration_ms", time.Since(j.Start).Milliseconds(),
+		"result", result,
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err.Error())
+	}
+	return attrs
+}
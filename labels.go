@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// labelsFilePath Archivo donde se guarda la etiqueta de cada puerto USB físico.
+// Permite distinguir dos impresoras idénticas ("caja izquierda", "caja derecha")
+// aunque compartan VID:PID e incluso número de serie.
+var labelsFilePath = "/etc/escpos-printer/labels.conf"
+
+// loadLabels Lee el archivo de etiquetas con líneas del tipo "1-1.3=caja izquierda".
+// Si el archivo no existe devuelve un mapa vacío.
+func loadLabels() (map[string]string, error) {
+	labels := make(map[string]string)
+
+	f, err := os.Open(labelsFilePath)
+	if os.IsNotExist(err) {
+		return labels, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(tr("error al leer las etiquetas: %w"), err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		port, label, ok := strings.Cut(line, "=")
+		if !ok {
+			continue // Ignora las líneas mal formadas
+		}
+		labels[strings.TrimSpace(port)] = strings.TrimSpace(label)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf(tr("error al leer las etiquetas: %w"), err)
+	}
+
+	return labels, nil
+}
+
+// saveLabels Escribe el mapa de etiquetas ordenado por puerto USB.
+func saveLabels(labels map[string]string) error {
+	ports := make([]string, 0, len(labels))
+	for port := range labels {
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+
+	var b strings.Builder
+	b.WriteString("# Etiquetas de impresoras por puerto USB físico (generado por escpos-socket-install)\n")
+	for _, port := range ports {
+		fmt.Fprintf(&b, "%s=%s\n", port, labels[port])
+	}
+
+	if err := os.MkdirAll(filepath.Dir(labelsFilePath), 0755); err != nil {
+		return fmt.Errorf(tr("error al crear el directorio de etiquetas: %w"), err)
+	}
+	if err := os.WriteFile(labelsFilePath, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf(tr("error al guardar las etiquetas: %w"), err)
+	}
+	return nil
+}
+
+// applyLabels Asigna a cada impresora la etiqueta guardada para su puerto USB.
+func applyLabels(printers []printer, labels map[string]string) {
+	for i := range printers {
+		if printers[i].PortPath != "" {
+			printers[i].Label = labels[printers[i].PortPath]
+		}
+	}
+}
+
+// setLabel Guarda la etiqueta de la impresora asociada a su puerto USB físico.
+func setLabel(p *printer, label string) error {
+	if p.PortPath == "" || label == p.Label {
+		return nil
+	}
+
+	labels, err := loadLabels()
+	if err != nil {
+		return err
+	}
+	labels[p.PortPath] = label
+	if err := saveLabels(labels); err != nil {
+		return err
+	}
+	p.Label = label
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logger Registro de lo que hace el programa. Por defecto muestra los mismos
+// mensajes de siempre; con --log-format json emite un objeto por evento, con
+// los datos (rutas, comandos, dispositivos) como campos propios, y desde una
+// unidad de systemd los envía al journal con esos datos como campos ESC_POS_*.
+var logger = slog.New(consoleHandler{level: slog.LevelInfo})
+
+// consoleHandler Muestra solo el texto de cada mensaje, como los fmt.Println
+// de antes. Los avisos y errores van a la salida de error.
+type consoleHandler struct {
+	level slog.Level
+}
+
+func (h consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	w := os.Stdout
+	if r.Level >= slog.LevelWarn {
+		w = os.Stderr
+	}
+	_, err := fmt.Fprintln(w, strings.TrimSuffix(r.Message, "\n"))
+	return err
+}
+
+func (h consoleHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h consoleHandler) WithGroup(string) slog.Handler      { return h }
+
+// setupLogging Configura el nivel y el formato del registro. Los mensajes del
+// paquete log (log.Fatalf y compañía) pasan también por él como errores.
+func setupLogging(verbose, quiet bool, format string) error {
+	level := slog.LevelInfo
+	switch {
+	case verbose:
+		level = slog.LevelDebug
+	case quiet:
+		level = slog.LevelWarn
+	}
+
+	var h slog.Handler
+	switch format {
+	case "", "text":
+		h = consoleHandler{level: level}
+		// Desde una unidad de systemd los mensajes van directamente al
+		// journal, con sus datos como campos que se pueden buscar.
+		if journalStream() {
+			if jh, err := newJournalHandler(level); err == nil {
+				h = jh
+			}
+		}
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+			Level: level,
+			ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+				// Los mensajes llevan saltos de línea pensados para la terminal.
+				if a.Key == slog.MessageKey {
+					a.Value = slog.StringValue(strings.TrimSpace(a.Value.String()))
+				}
+				return a
+			},
+		})
+	default:
+		return fmt.Errorf(tr("formato de registro inválido %q (text o json)"), format)
+	}
+
+	logger = slog.New(h)
+	slog.SetDefault(logger)
+	slog.SetLogLoggerLevel(slog.LevelError)
+	return nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultLPDPort Puerto estándar de LPD (RFC 1179).
+const defaultLPDPort = 515
+
+// frontendLPD Valor de installOptions.Frontend para el socket LPD.
+const frontendLPD = "lpd"
+
+// lpdQueuePattern Nombres de cola LPD admitidos: los clientes de Windows no
+// aceptan espacios y algunos otros se confunden con los caracteres especiales.
+var lpdQueuePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Respuestas de LPD: un byte 0 confirma, cualquier otro rechaza.
+var (
+	lpdAck  = []byte{0}
+	lpdNack = []byte{1}
+)
+
+// lpdSettings Servidor LPD de una impresora, para las aplicaciones que solo
+// imprimen con LPR. Atiende una única cola y entrega los trabajos a la
+// impresora por el mismo camino que el socket RAW.
+type lpdSettings struct {
+	Queue string `yaml:"queue"` // Nombre de la cola, vacío para el nombre de las unidades
+	Port  int    `yaml:"port"`  // Puerto TCP, 0 para defaultLPDPort
+}
+
+// validate Comprueba el nombre de la cola y el puerto.
+func (l *lpdSettings) validate() error {
+	if l.Queue != "" && !lpdQueuePattern.MatchString(l.Queue) {
+		return fmt.Errorf(tr("nombre de cola LPD inválido %q (usa letras, números, '.', '_' o '-')"), l.Queue)
+	}
+	if l.Port == 0 {
+		l.Port = defaultLPDPort
+	}
+	if l.Port < 1 || l.Port > 65535 {
+		return fmt.Errorf(tr("puerto inválido %d"), l.Port)
+	}
+	return nil
+}
+
+// lpdQueue Devuelve el nombre de la cola LPD de la impresora.
+func (opts installOptions) lpdQueue() string {
+	if opts.LPD.Queue != "" {
+		return opts.LPD.Queue
+	}
+	return opts.unitName()
+}
+
+// lpdOptions Devuelve las opciones del par de unidades LPD de la impresora:
+// las mismas que las del socket RAW, en el puerto de LPD y sin socket Unix.
+// Con LPD cada conexión es un trabajo, así que nunca usa el modo daemon.
+func (opts installOptions) lpdOptions() installOptions {
+	lpd := opts
+	lpd.Frontend = frontendLPD
+	lpd.Port = opts.LPD.Port
+	lpd.Unix = nil
+	lpd.TLS = nil
+	lpd.Daemon = false
+	return lpd
+}
+
+// lpdExecStart Devuelve el comando del servicio LPD.
+func lpdExecStart(opts installOptions) string {
+	target := " --device " + opts.devicePath()
+	if opts.Printer.Kind == kindNetwork {
+		target = " --to " + opts.Printer.Path
+	}
+	return installedBinaryPath + " lpd" + target + " --queue " + opts.lpdQueue() + timeoutFlags(opts) + rateFlags(opts) + archiveFlags(opts) + usbResetFlags(opts)
+}
+
+// frontendFromExecStart Devuelve el protocolo que atiende el servicio según
+// su línea ExecStart=, o una cadena vacía para el socket RAW.
+func frontendFromExecStart(execStart string) string {
+	if fields := strings.Fields(execStart); len(fields) > 1 && (fields[1] == frontendLPD || fields[1] == frontendIPP || fields[1] == frontendHTTP) {
+		return fields[1]
+	}
+	return ""
+}
+
+// readLPDLine Lee una línea de órdenes de LPD: el código y el resto de la
+// línea sin el salto.
+func readLPDLine(br *bufio.Reader) (byte, string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	if line == "" {
+		return 0, "", errors.New(tr("orden LPD vacía"))
+	}
+	return line[0], line[1:], nil
+}
+
+// serveLPD Atiende una conexión LPD (RFC 1179). Solo se imprimen los
+// trabajos de la cola queue; los archivos de datos se pasan tal cual a
+// deliver, que es el relay de la impresora. Las consultas de estado responden
+// que la cola está vacía: los trabajos no se guardan, se imprimen al llegar.
+func serveLPD(r io.Reader, w io.Writer, queue string, deliver func(io.Reader) (int64, error)) error {
+	br := bufio.NewReader(r)
+	cmd, operand, err := readLPDLine(br)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf(tr("error al leer la orden LPD: %w"), err)
+	}
+	name, _, _ := strings.Cut(operand, " ")
+
+	switch cmd {
+	case 0x01: // Imprimir los trabajos en espera: no hay ninguno.
+		return nil
+	case 0x02: // Recibir un trabajo.
+		if name != queue {
+			w.Write(lpdNack)
+			return fmt.Errorf(tr("cola LPD desconocida %q (esta impresora atiende %q)"), name, queue)
+		}
+		w.Write(lpdAck)
+		return receiveLPDJob(br, w, deliver)
+	case 0x03, 0x04: // Estado de la cola, corto o largo.
+		if name != queue {
+			fmt.Fprintf(w, tr("%s: cola desconocida\n"), name)
+			return nil
+		}
+		fmt.Fprintf(w, tr("%s: lista, sin trabajos en espera\n"), queue)
+		return nil
+	case 0x05: // Borrar trabajos: no queda ninguno que borrar.
+		return nil
+	}
+	return fmt.Errorf(tr("orden LPD desconocida %#x"), cmd)
+}
+
+// receiveLPDJob Recibe los archivos de control y de datos de un trabajo. Cada
+// archivo de datos se imprime mientras llega y se confirma cuando la
+// impresora lo aceptó entero, así el cliente sabe si falló. Las copias y los
+// formatos del archivo de control se ignoran: el contenido ya es ESC/POS.
+func receiveLPDJob(br *bufio.Reader, w io.Writer, deliver func(io.Reader) (int64, error)) error {
+	for {
+		sub, operand, err := readLPDLine(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf(tr("error al leer la orden LPD: %w"), err)
+		}
+		switch sub {
+		case 0x01: // Cancelar el trabajo.
+			logger.Info(tr("El cliente LPD canceló el trabajo"))
+			return nil
+		case 0x02, 0x03:
+		default:
+			w.Write(lpdNack)
+			return fmt.Errorf(tr("orden LPD desconocida %#x"), sub)
+		}
+		countField, fileName, _ := strings.Cut(operand, " ")
+		count, err := strconv.ParseInt(countField, 10, 64)
+		if err != nil || count < 0 {
+			w.Write(lpdNack)
+			return fmt.Errorf(tr("tamaño inválido %q en la orden LPD"), countField)
+		}
+		w.Write(lpdAck)
+
+		if sub == 0x02 {
+			control, err := io.ReadAll(io.LimitReader(br, count))
+			if err == nil && int64(len(control)) < count {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return fmt.Errorf(tr("error al leer el archivo de control %s: %w"), fileName, err)
+			}
+			logLPDControl(string(control))
+		} else {
+			// Algunos clientes envían el tamaño 0 y los datos hasta cerrar la conexión.
+			var data io.Reader = io.LimitReader(br, count)
+			if count == 0 {
+				data = br
+			}
+			n, err := deliver(data)
+			if err != nil {
+				w.Write(lpdNack)
+				return err
+			}
+			if count == 0 {
+				logger.Info(fmt.Sprintf(tr("Archivo LPD %s de %d bytes impreso"), fileName, n), "file", fileName, "bytes", n)
+				return nil
+			}
+			if n < count {
+				return fmt.Errorf(tr("el archivo %s terminó antes de tiempo (%d de %d bytes)"), fileName, n, count)
+			}
+			logger.Info(fmt.Sprintf(tr("Archivo LPD %s de %d bytes impreso"), fileName, n), "file", fileName, "bytes", n)
+		}
+		// Cada archivo termina con un byte 0 que el servidor confirma.
+		if b, err := br.ReadByte(); err != nil || b != 0 {
+			w.Write(lpdNack)
+			return fmt.Errorf(tr("falta el byte final del archivo %s"), fileName)
+		}
+		w.Write(lpdAck)
+	}
+}
+
+// logLPDControl Anota en el registro el nombre del trabajo, el usuario y el
+// equipo que indica el archivo de control.
+func logLPDControl(control string) {
+	var job, user, host string
+	for _, line := range strings.Split(control, "\n") {
+		if line == "" {
+			continue
+		}
+		switch line[0] {
+		case 'J':
+			job = line[1:]
+		case 'P':
+			user = line[1:]
+		case 'H':
+			host = line[1:]
+		}
+	}
+	logger.Info(fmt.Sprintf(tr("Trabajo LPD %q de %s@%s"), job, user, host), "job", job, "user", user, "host", host)
+}
+
+// runLPD Implementa el subcomando "lpd", que ejecuta el servicio LPD de cada
+// impresora: atiende la conexión entrante (la entrada estándar) según el
+// protocolo LPD y entrega los archivos de datos al dispositivo o a la
+// impresora de red.
+func runLPD(args []string) {
+	fs := flag.NewFlagSet("lpd", flag.ExitOnError)
+	device := fs.String("device", "", tr("nodo de la impresora, por ejemplo /dev/usb/lp0"))
+	to := fs.String("to", "", tr("dirección HOST:PUERTO de la impresora"))
+	queue := fs.String("queue", "", tr("nombre de la cola LPD que se atiende"))
+	timeout := fs.Duration("timeout", defaultWriteTimeout, tr("tiempo máximo de espera a que la impresora acepte datos"))
+	idle := fs.Duration("idle-timeout", defaultIdleTimeout, tr("tiempo máximo sin recibir datos del cliente (0 sin límite)"))
+	total := fs.Duration("job-timeout", defaultJobTimeout, tr("duración máxima de un trabajo (0 sin límite)"))
+	newLimiter := rateServerFlags(fs)
+	newDelivery := deliveryServerFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s lpd --queue COLA --device NODO | --to HOST:PUERTO\n"), filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if (*device == "") == (*to == "") || *queue == "" {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	conn := stdinConn()
+	w, _ := conn.(io.Writer)
+	remote := "stdin"
+	if nc, ok := conn.(net.Conn); ok {
+		remote = nc.RemoteAddr().String()
+	}
+	// Como en relay, cada conexión es un proceso y las cuentas de los
+	// clientes se comparten en el directorio de ejecución del servicio.
+	limiter := newLimiter(os.Getenv("RUNTIME_DIRECTORY"))
+	client := ""
+	if nc, ok := conn.(net.Conn); ok && limiter != nil {
+		client = rateClient(nc.RemoteAddr())
+		if err := limiter.admit(client); err != nil {
+			logger.Warn(fmt.Sprintf(tr("Conexión rechazada: %v"), err), "client", client)
+			return
+		}
+	}
+	in := withTimeouts(conn, jobTimeouts{Idle: *idle, Total: *total})
+	if client != "" {
+		in = limiter.limit(in, client)
+	}
+	delivery := newDelivery(*device, *to, *timeout, *total)
+	var printed int64
+	deliver := func(r io.Reader) (int64, error) {
+		n, err := delivery.deliver(r, remote)
+		printed += n
+		return n, err
+	}
+	err := serveLPD(in, w, *queue, deliver)
+	if client != "" {
+		limiter.record(client, printed)
+	}
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
@@ -1,155 +1,1629 @@
 package main
 
 import (
+	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// socketFileContent Contiene la configuración de la unidad de socket systemd
-// Escucha en todas las interfaces de red en el puerto TCP 9100.
-const socketFileContent = `[Unit]
-Description=ESC/POS Printer Socket
+// stdin Lector compartido de la entrada estándar para todas las preguntas al usuario.
+var stdin = bufio.NewReader(os.Stdin)
 
-[Socket]
-ListenStream=0.0.0.0:9100
-Accept=yes
+// unitDir Directorio donde el instalador escribe las unidades systemd. Con
+// --user es el del usuario (enableUserMode).
+var unitDir = "/etc/systemd/system"
+
+// defaultUnitName Nombre base de las unidades cuando se instala una sola impresora:
+// escpos-printer.socket y escpos-printer@.service.
+const defaultUnitName = "escpos-printer"
+
+// defaultPort Puerto TCP estándar para impresión RAW (JetDirect).
+const defaultPort = 9100
+
+// defaultBind Dirección en la que escucha el socket si no se indica otra: todas las interfaces IPv4.
+const defaultBind = "0.0.0.0"
+
+// bindIPv6OnlyValues Valores que admite BindIPv6Only= en los sockets.
+var bindIPv6OnlyValues = []string{"default", "both", "ipv6-only"}
+
+// Códigos de salida para que los scripts de aprovisionamiento distingan los fallos.
+const (
+	exitFailure  = 1 // Error general
+	exitUsage    = 2 // Parámetros inválidos
+	exitNoDevice = 3 // La impresora indicada no está conectada
+)
 
+// socketFileContent Crea la configuración de la unidad de socket systemd.
+// Escucha en la dirección y el puerto TCP indicados en las opciones.
+//
+// Con el enlace estable de udev el socket se ata a la unidad .device de la
+// impresora: se inicia al conectarla y se detiene al desconectarla, de modo
+// que mientras no está las conexiones se rechazan en lugar de perderse.
+//
+// Los límites de conexiones protegen de un cliente que abre cientos de
+// conexiones y con ellas cientos de procesos. systemd solo los aplica con
+// Accept=yes; checkRateLimits los rechaza en el modo daemon.
+//
+// Con una lista de redes permitidas se rechaza cualquier otra dirección. La
+// propia máquina siempre puede conectarse, para test-print y el anuncio.
+func socketFileContent(opts installOptions) string {
+	unit, wantedBy, accept := "", "sockets.target", "yes"
+	if opts.Daemon {
+		accept = "no"
+	}
+	directives := ""
+	if !opts.Daemon && opts.MaxConnections > 0 {
+		directives += fmt.Sprintf("MaxConnections=%d\n", opts.MaxConnections)
+	}
+	if !opts.Daemon && opts.MaxConnectionsPerSource > 0 {
+		directives += fmt.Sprintf("MaxConnectionsPerSource=%d\n", opts.MaxConnectionsPerSource)
+	}
+	if v := opts.bindIPv6Only(); v != "" {
+		directives += "BindIPv6Only=" + v + "\n"
+	}
+	if opts.Unix != nil {
+		directives += opts.Unix.directives()
+	}
+	if len(opts.AllowFrom) > 0 {
+		directives += "IPAddressAllow=localhost " + strings.Join(opts.AllowFrom, " ") + "\nIPAddressDeny=any\n"
+	}
+	listenStreams := ""
+	for _, addr := range opts.listenAddrs() {
+		listenStreams += "ListenStream=" + addr + "\n"
+	}
+	if opts.hasStablePath() {
+		unit = fmt.Sprintf("BindsTo=%s\nAfter=%s\n", opts.deviceUnit(), opts.deviceUnit())
+		wantedBy = opts.deviceUnit()
+	}
+	return fmt.Sprintf(`[Unit]
+Description=ESC/POS Printer Socket%s
+%s
+[Socket]
+%sAccept=%s
+%s%s
 [Install]
-WantedBy=sockets.target
-`
+WantedBy=%s
+`, opts.descriptionSuffix(), unit, listenStreams, accept, directives, extraDirectives(opts.SocketOptions), wantedBy)
+}
 
-// serviceFileContent Crea la configuración de la unidad de servicio, con el path de la impresora.
+// serviceFileContent Crea la configuración de la unidad de servicio, con el path de la impresora
+// (el enlace estable de udev cuando se puede crear).
 // Este es un servicio de plantilla que se instancia para cada conexión entrante.
-// Utiliza 'tee' para canalizar los datos entrantes a la impresora y /dev/null
-// Se canaliza a /dev/null para darle unos microsegundos a la impresora y detectar la impresion
-func serviceFileContent(printerPath string) string {
+// Ejecuta este mismo programa ("relay") para copiar los datos a la impresora;
+// con una cola de CUPS los datos se entregan a lp en lugar de al dispositivo.
+// La salida va al registro: por defecto iría a la conexión del cliente.
+// Las directivas de aislamiento van antes que las opciones adicionales para
+// que service_options pueda relajar alguna.
+func serviceFileContent(opts installOptions) string {
+	execStart, input := relayExecStart(opts), "StandardInput=socket\n"
+	credentials := tlsCredentials(opts)
+	switch {
+	case opts.Frontend == frontendLPD:
+		execStart = lpdExecStart(opts)
+	case opts.Frontend == frontendIPP:
+		execStart = ippExecStart(opts)
+	case opts.Frontend == frontendHTTP:
+		// Como el modo daemon, recibe el socket que escucha.
+		execStart, input, credentials = httpExecStart(opts), "", httpCredentials(opts)
+	case opts.CUPSQueue != "":
+		execStart = cupsExecStart(opts.CUPSQueue)
+	case opts.Daemon:
+		// El daemon recibe el socket que escucha, no una conexión.
+		execStart, input = daemonExecStart(opts), ""
+	}
+	// Atado al dispositivo, si la impresora se desconecta la conexión se
+	// cierra enseguida con "Dependency failed" en el registro, en lugar de
+	// escribir en un nodo que ya no existe.
+	unit := ""
+	if device := opts.boundDeviceUnit(); device != "" {
+		unit = fmt.Sprintf("BindsTo=%s\nAfter=%s\n", device, device)
+	}
 	return fmt.Sprintf(`[Unit]
-Description=ESC/POS Printer Service
-
+Description=ESC/POS Printer Service%s
+%s
 [Service]
-ExecStart=-/usr/bin/tee /dev/null > %s
-StandardInput=socket
-`, printerPath)
+%s%sExecStart=%s
+%s%sStandardOutput=journal
+%s%s`, opts.descriptionSuffix(), unit, serialSetup(opts), credentials, execStart, input, rateDirectives(opts), hardeningDirectives(opts), extraDirectives(opts.ServiceOptions))
 }
 
-// findPrinters Busca dispositivos de impresora en /dev/usb y devuelve una lista.
-// Se espera que los dispositivos sigan el patrón /dev/usb/lpX.
-func findPrinters() ([]string, error) {
-	// Busca archivos que coincidan con el patrón /dev/usb/lp*
-	matches, err := filepath.Glob("/dev/usb/lp*")
-	if err != nil {
-		return nil, fmt.Errorf("error al buscar impresoras: %w", err)
+// extraDirectives Convierte opciones adicionales de una sección de la unidad
+// en líneas "Clave=valor", ordenadas para que el archivo generado sea estable.
+func extraDirectives(options map[string]string) string {
+	keys := make([]string, 0, len(options))
+	for k := range options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", k, options[k])
 	}
+	return b.String()
+}
 
-	// Filtra los resultados para incluir solo los dispositivos de caracteres
-	var printers []string
-	for _, match := range matches {
-		info, err := os.Stat(match)
+// findPrinters Busca dispositivos de impresora y devuelve una lista. Se esperan
+// los nodos /dev/usb/lpX de las impresoras USB y /dev/lpX de las del puerto
+// paralelo (Centronics), que siguen usando algunas TM-U220 de cajas antiguas.
+func findPrinters() ([]printer, error) {
+	var printers []printer
+	for _, source := range []struct {
+		pattern string
+		kind    string
+	}{
+		{"/dev/usb/lp*", kindUSB},
+		{"/dev/lp[0-9]*", kindParallel},
+	} {
+		matches, err := filepath.Glob(source.pattern)
 		if err != nil {
-			continue // Ignora los errores al obtener información del archivo
+			return nil, fmt.Errorf(tr("error al buscar impresoras: %w"), err)
 		}
-		// S_IFCHR representa un dispositivo de caracteres, como una impresora
-		if info.Mode()&os.ModeCharDevice != 0 {
-			printers = append(printers, match)
+
+		// Filtra los resultados para incluir solo los dispositivos de caracteres
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				continue // Ignora los errores al obtener información del archivo
+			}
+			// S_IFCHR representa un dispositivo de caracteres, como una impresora
+			if info.Mode()&os.ModeCharDevice != 0 {
+				p := printer{Path: match, Kind: source.kind}
+				if source.kind == kindUSB {
+					describeUSB(&p)
+				} else {
+					describeParallel(&p)
+				}
+				printers = append(printers, p)
+			}
 		}
 	}
 
 	return printers, nil
 }
 
-// selectPrinter muestra una lista de impresoras y solicita al usuario que elija una.
-func selectPrinter(printers []string) (string, error) {
+// selectPrinters muestra una lista de impresoras y solicita al usuario que elija
+// una o varias, separadas por comas (por ejemplo "1,2").
+func selectPrinters(printers []printer) ([]printer, error) {
 	if len(printers) == 0 {
-		return "", fmt.Errorf("no se encontraron impresoras USB en /dev/usb/lpX")
+		return nil, errors.New(tr("no se encontraron impresoras USB en /dev/usb/lpX"))
+	}
+
+	// En una terminal se elige con las flechas; con la entrada redirigida
+	// se mantiene la pregunta numerada, que es fácil de automatizar.
+	if isInteractive() {
+		items := make([]string, len(printers))
+		for i, p := range printers {
+			items[i] = printerName(p) + " (" + p.Path + ")"
+		}
+		chosen, err := menuSelect(tr("\nSe encontraron las siguientes impresoras USB:"), items, func(i int) string {
+			return printerDetails(printers[i])
+		}, true)
+		if err != nil {
+			return nil, fmt.Errorf(tr("no se seleccionó ninguna impresora: %w"), err)
+		}
+		selected := make([]printer, len(chosen))
+		for i, c := range chosen {
+			selected[i] = printers[c]
+		}
+		return selected, nil
 	}
 
-	fmt.Println("\nSe encontraron las siguientes impresoras USB:")
+	fmt.Println(tr("\nSe encontraron las siguientes impresoras USB:"))
 	for i, p := range printers {
 		fmt.Printf("%d. %s\n", i+1, p)
 	}
 
-	var choice int
 	for {
-		fmt.Print("Por favor, selecciona el número de la impresora que deseas usar: ")
-		_, err := fmt.Scanln(&choice)
-		if err != nil || choice < 1 || choice > len(printers) {
-			fmt.Println("Entrada inválida. Por favor, ingresa un número de la lista.")
+		fmt.Print(tr("Por favor, selecciona el número de la impresora que deseas usar (varias separadas por comas): "))
+		line, err := readLine()
+		if err != nil {
+			return nil, fmt.Errorf(tr("no se seleccionó ninguna impresora: %w"), err)
+		}
+		selected, ok := parseSelection(line, printers)
+		if !ok {
+			fmt.Println(tr("Entrada inválida. Por favor, ingresa números de la lista."))
 			continue
 		}
-		break
+		return selected, nil
 	}
+}
 
-	return printers[choice-1], nil
+// parseSelection Interpreta una lista de números separados por comas. Rechaza
+// números fuera de la lista y repetidos.
+func parseSelection(line string, printers []printer) ([]printer, bool) {
+	var selected []printer
+	seen := make(map[int]bool)
+	for _, field := range strings.Split(line, ",") {
+		choice, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || choice < 1 || choice > len(printers) || seen[choice] {
+			return nil, false
+		}
+		seen[choice] = true
+		selected = append(selected, printers[choice-1])
+	}
+	return selected, len(selected) > 0
 }
 
-func main() {
-	fmt.Println("Iniciando la configuración del servicio de impresora ESC/POS...")
+// readLine Lee una línea de la entrada estándar sin el salto de línea final.
+func readLine() (string, error) {
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
 
-	// --- Paso 1: Checar acceso root ---
-	// Necesitamos escribir archivos en /etc/systemd/system y ejecutar comandos systemctl,
-	// que requieren permisos elevados.
-	if os.Geteuid() != 0 {
-		log.Fatal("Este programa debe ejecutarse como root o con sudo.")
+// askYesNo Hace una pregunta de sí o no. Enter devuelve la respuesta por defecto.
+func askYesNo(question string, def bool) bool {
+	hint := tr("[s/N]")
+	if def {
+		hint = tr("[S/n]")
 	}
-	fmt.Println("✓ Permisos de root confirmados.")
+	for {
+		fmt.Printf("%s %s: ", question, hint)
+		answer, err := readLine()
+		if err != nil {
+			return def
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def
+		case "s", "si", "sí", "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+		fmt.Println(tr("Respuesta inválida. Por favor, responde s o n."))
+	}
+}
 
-	// --- Paso 2: Encontrar y seleccionar la impresora ---
+// askPort Pregunta el puerto TCP. Enter devuelve el puerto por defecto.
+func askPort(def int) int {
+	for {
+		fmt.Printf(tr("Puerto TCP de la primera impresora [%d]: "), def)
+		answer, err := readLine()
+		if err != nil || answer == "" {
+			return def
+		}
+		if port, err := strconv.Atoi(answer); err == nil && port >= 1 && port <= 65535 {
+			return port
+		}
+		fmt.Println(tr("Puerto inválido. Por favor, ingresa un número entre 1 y 65535."))
+	}
+}
+
+// confirmInstall Muestra el resumen de lo que se va a instalar y pide confirmación.
+func confirmInstall(list []installOptions, announce bool) bool {
+	fmt.Println(tr("\nResumen de la instalación:"))
+	for _, opts := range list {
+		fmt.Printf("  %s → %s (%s.socket)\n", opts.listenAddr(), opts.Printer, opts.unitName())
+		if opts.CUPSQueue != "" {
+			fmt.Printf(tr("    a través de la cola de CUPS %s\n"), opts.CUPSQueue)
+		}
+		if opts.RawQueue {
+			fmt.Printf(tr("    con la cola de CUPS %s en crudo\n"), opts.unitName())
+		}
+		if opts.MDNS {
+			fmt.Println(tr("    anunciada por mDNS"))
+		}
+		if opts.MQTT != nil {
+			fmt.Printf(tr("    imprime los mensajes MQTT de %s\n"), strings.Join(opts.MQTT.Topics, ", "))
+		}
+		if opts.TLS != nil {
+			fmt.Println(tr("    cifrado con TLS"))
+		}
+		if opts.OpenFirewall && opts.exposedTCP() {
+			fmt.Println(tr("    con el puerto abierto en el firewall"))
+		}
+		if opts.Metrics != "" {
+			fmt.Printf(tr("    métricas en http://%s/metrics\n"), opts.Metrics)
+		}
+		if opts.Archive != nil {
+			fmt.Printf(tr("    guarda los trabajos en %s\n"), opts.archiveDir())
+		}
+		if opts.Spool != nil {
+			fmt.Printf(tr("    con la cola de trabajos pendientes en %s\n"), opts.spoolDir())
+		}
+	}
+	if announce {
+		fmt.Println(tr("  Anuncio de la IP en cada arranque"))
+	}
+	return askYesNo(tr("¿Aplicar esta configuración?"), true)
+}
+
+// askLabel Pregunta al usuario una etiqueta para la impresora, que se guarda
+// junto a su puerto USB físico para reconocerla en futuras instalaciones.
+// Devuelve una cadena vacía si el usuario no quiere cambiarla.
+func askLabel(p printer) string {
+	if p.PortPath == "" {
+		return "" // Sin puerto USB conocido no hay nada con qué asociar la etiqueta
+	}
+
+	fmt.Printf(tr("Etiqueta para la impresora del puerto USB %s (por ejemplo \"caja izquierda\")"), p.PortPath)
+	if p.Label != "" {
+		fmt.Printf(tr(", Enter para conservar «%s»: "), p.Label)
+	} else {
+		fmt.Print(tr(", Enter para omitir: "))
+	}
+	label, err := readLine()
+	if err != nil {
+		return ""
+	}
+	return label
+}
+
+// discoverPrinters Busca las impresoras y les asigna las etiquetas guardadas
+// y las capacidades de su modelo.
+func discoverPrinters() ([]printer, error) {
 	printers, err := findPrinters()
 	if err != nil {
-		log.Fatalf("Error: %v", err)
+		return nil, err
+	}
+	labels, err := loadLabels()
+	if err != nil {
+		return nil, err
 	}
-	fmt.Println(len(printers))
-	for _, printer := range printers {
-		fmt.Println(printer)
+	applyLabels(printers, labels)
+	db, err := loadCapabilities()
+	if err != nil {
+		return nil, err
 	}
+	applyCapabilities(printers, db)
+	// Los puertos serie no se pueden identificar como impresoras; se ofrecen
+	// al final de la lista para elegirlos a mano.
+	return append(printers, findSerialPorts()...), nil
+}
 
-	selectedPrinter, err := selectPrinter(printers)
+// lookupPrinter Busca una impresora conectada por su ruta (/dev/usb/lp0),
+// su nombre corto (lp0), su puerto USB (1-1.3) o su etiqueta, o crea la
+// impresora de red indicada con tcp://HOST[:PUERTO]. Con usb:VID:PID[:SERIE]
+// devuelve la impresora conectada de ese modelo o, si no hay ninguna, una
+// marcada como no conectada. Si una USB y
+// una del puerto paralelo comparten nombre corto gana la USB; la otra se
+// elige por su ruta (/dev/lp0).
+func lookupPrinter(name string) (printer, error) {
+	if isNetworkPrinter(name) {
+		return networkPrinter(name)
+	}
+	printers, err := discoverPrinters()
 	if err != nil {
-		log.Fatalf("Error: %v", err)
+		return printer{}, err
 	}
-	fmt.Printf("✓ Impresora seleccionada: %s\n", selectedPrinter)
+	// Un modelo USB se busca entre las conectadas; si no hay ninguna se
+	// instala igualmente para cuando se conecte.
+	if strings.HasPrefix(name, usbModelScheme) {
+		model, err := parseUSBModel(name)
+		if err != nil {
+			return printer{}, err
+		}
+		for _, p := range printers {
+			if p.matchesModel(model) {
+				return p, nil
+			}
+		}
+		db, err := loadCapabilities()
+		if err != nil {
+			return printer{}, err
+		}
+		found := []printer{model}
+		applyCapabilities(found, db)
+		return found[0], nil
+	}
+	// Se admite también el enlace estable de udev (/dev/escpos/...).
+	if resolved, err := filepath.EvalSymlinks(name); err == nil && strings.HasPrefix(name, "/dev/") {
+		name = resolved
+	}
+	for _, p := range printers {
+		if name == p.Path || name == filepath.Base(p.Path) || name == p.PortPath || (p.Label != "" && name == p.Label) {
+			return p, nil
+		}
+	}
+	return printer{}, printerNotFoundError{name}
+}
 
-	// --- Paso 3: Definir rutas de archivos ---
-	socketFilePath := "/etc/systemd/system/escpos-printer.socket"
-	serviceFilePath := "/etc/systemd/system/escpos-printer@.service"
+// printerNotFoundError Indica que la impresora pedida no está conectada.
+type printerNotFoundError struct {
+	name string
+}
 
-	// --- Paso 4: Escribe los archivos de unidad systemd ---
-	err = os.WriteFile(socketFilePath, []byte(socketFileContent), 0644)
-	if err != nil {
-		log.Fatalf("Error al escribir el archivo de socket: %v", err)
+func (e printerNotFoundError) Error() string {
+	return fmt.Sprintf("no se encontró la impresora %q", e.name)
+}
+
+// exitCodeFor Devuelve el código de salida adecuado para un error.
+func exitCodeFor(err error) int {
+	var notFound printerNotFoundError
+	if errors.As(err, &notFound) {
+		return exitNoDevice
+	}
+	return exitFailure
+}
+
+// requireRoot Termina el programa si no se ejecuta como root. Con --user las
+// unidades son del usuario y no hace falta.
+func requireRoot() {
+	if !userMode && os.Geteuid() != 0 {
+		log.Fatal(tr("Este programa debe ejecutarse como root o con sudo."))
+	}
+}
+
+func main() {
+	global, args := extractGlobalFlags(os.Args[1:])
+	language = detectLanguage(global.Lang)
+	if err := setupLogging(global.Verbose, global.Quiet, global.LogFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if global.User {
+		if err := enableUserMode(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFailure)
+		}
+	}
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "usb-reset":
+			runUSBReset(args[1:])
+			return
+		case "print-pairing":
+			runPrintPairing(args[1:])
+			return
+		case "print-netinfo":
+			runPrintNetinfo(args[1:])
+			return
+		case "print-announce":
+			runPrintAnnounce(args[1:])
+			return
+		case "setup-web":
+			runSetupWeb(args[1:])
+			return
+		case "uninstall":
+			runUninstall(args[1:])
+			return
+		case "status":
+			runStatus(args[1:])
+			return
+		case "doctor":
+			runDoctor(args[1:])
+			return
+		case "test-print":
+			runTestPrint(args[1:])
+			return
+		case "reprint":
+			runReprint(args[1:])
+			return
+		case "relay":
+			runRelay(args[1:])
+			return
+		case "serve":
+			runServe(args[1:])
+			return
+		case "lpd":
+			runLPD(args[1:])
+			return
+		case "ipp":
+			runIPP(args[1:])
+			return
+		case "http":
+			runHTTP(args[1:])
+			return
+		case "mqtt":
+			runMQTT(args[1:])
+			return
+		case "tls-cert":
+			runTLSCert(args[1:])
+			return
+		}
+	}
+	runInstall(args)
+}
+
+// runInstall Ejecuta la instalación del socket y el servicio. Por defecto es
+// interactiva; con --auto o --yes no hace preguntas.
+func runInstall(args []string) {
+	fs := flag.NewFlagSet("install", flag.ExitOnError)
+	auto := fs.Bool("auto", false, tr("instalar sin preguntas si hay exactamente una impresora conectada"))
+	printerArg := fs.String("printer", "", tr("impresoras a usar separadas por comas (/dev/usb/lp0, lp0, puerto USB, etiqueta, usb:VID:PID para una que aún no está conectada o tcp://IP para una de red)"))
+	port := fs.Int("port", defaultPort, tr("puerto TCP de la primera impresora; las siguientes usan los puertos consecutivos"))
+	bind := fs.String("bind", defaultBind, tr("direcciones IP en las que escucha el socket, separadas por comas (por ejemplo 127.0.0.1, la IP de la LAN o :: para IPv6)"))
+	bindIPv6Only := fs.String("bind-ipv6-only", "", tr("si el socket en :: acepta también IPv4: both o ipv6-only (BindIPv6Only= de systemd)"))
+	label := fs.String("label", "", tr("etiqueta para la impresora seleccionada (solo con una impresora)"))
+	announce := fs.Bool("announce", false, tr("imprimir la IP de la máquina en cada arranque"))
+	yes := fs.Bool("yes", false, tr("no hacer preguntas; requiere --printer"))
+	configPath := fs.String("config", "", tr("archivo YAML con las impresoras y opciones a instalar"))
+	dryRun := fs.Bool("dry-run", false, tr("mostrar las unidades y los comandos sin escribir ni ejecutar nada"))
+	output := fs.String("output", "text", tr("formato de la salida: text o json"))
+	baud := fs.Int("baud", defaultBaud, tr("velocidad de las impresoras serie"))
+	parity := fs.String("parity", "none", tr("paridad de las impresoras serie: none, even u odd"))
+	flow := fs.String("flow", "none", tr("control de flujo de las impresoras serie: none, rtscts o xonxoff"))
+	viaCUPS := fs.Bool("cups", false, tr("enviar los trabajos a la cola de CUPS de la impresora, si tiene una"))
+	mqttBroker := fs.String("mqtt-broker", "", tr("broker MQTT del que imprimir mensajes, por ejemplo tcp://192.168.1.5:1883 (solo con una impresora)"))
+	mqttTopic := fs.String("mqtt-topic", "", tr("temas MQTT que se imprimen, separados por comas, por ejemplo store/42/receipt"))
+	mqttQoS := fs.Int("mqtt-qos", 1, tr("calidad de servicio de la suscripción MQTT: 0, 1 o 2"))
+	mqttUser := fs.String("mqtt-username", "", tr("usuario del broker MQTT"))
+	mqttPassword := fs.String("mqtt-password-file", "", tr("archivo con la contraseña del broker MQTT"))
+	mdns := fs.Bool("mdns", false, tr("anunciar las impresoras por mDNS (Bonjour) con Avahi para que las encuentren las tabletas y las aplicaciones de punto de venta"))
+	withTLS := fs.Bool("tls", false, tr("cifrar el socket RAW con TLS; sin --tls-cert se genera un certificado autofirmado"))
+	tlsCert := fs.String("tls-cert", "", tr("certificado PEM del socket TLS (solo con una impresora)"))
+	tlsKey := fs.String("tls-key", "", tr("clave privada PEM del certificado del socket TLS"))
+	rawQueue := fs.Bool("cups-raw-queue", false, tr("crear en CUPS una cola en crudo que imprime en el socket, para las aplicaciones que solo saben imprimir con CUPS"))
+	openFirewall := fs.Bool("open-firewall", false, tr("abrir los puertos en ufw o firewalld, solo para las redes de --allow si se indican"))
+	takeOver := fs.Bool("take-over", false, tr("deshabilitar el servicio que ya escuche en el puerto (por ejemplo p910nd)"))
+	daemon := fs.Bool("daemon", false, tr("atender todas las conexiones con un solo proceso que imprime los trabajos de uno en uno"))
+	metricsAddr := fs.String("metrics", "", tr("publicar métricas de Prometheus en http://HOST:PUERTO/metrics, y el estado en /healthz (solo con --daemon y una impresora)"))
+	maxConns := fs.Int("max-connections", 0, tr("conexiones simultáneas admitidas por el socket (0 para el valor de systemd)"))
+	maxConnsPerSource := fs.Int("max-connections-per-source", 0, tr("conexiones simultáneas admitidas desde una misma IP (0 sin límite)"))
+	connsPerMinute := fs.Int("max-connections-per-minute", 0, tr("conexiones por minuto admitidas desde una misma IP (0 sin límite)"))
+	bytesPerMinute := fs.Int64("max-bytes-per-minute", 0, tr("bytes por minuto admitidos desde una misma IP; corta el trabajo que los supera (0 sin límite)"))
+	archiveDir := fs.String("archive", "", tr("guardar una copia de cada trabajo recibido en este directorio, para reimprimirlo con reprint"))
+	archiveMaxJobs := fs.Int("archive-max-jobs", defaultArchiveMaxJobs, tr("trabajos que se conservan por impresora en el archivo"))
+	archiveMaxAge := fs.Duration("archive-max-age", 0, tr("borrar del archivo los trabajos más antiguos que esto, por ejemplo 720h (0 sin límite)"))
+	spoolDir := fs.String("spool", "", tr("guardar en este directorio los trabajos que llegan con la impresora apagada o sin papel e imprimirlos en orden cuando vuelva (solo con --daemon)"))
+	spoolMaxJobs := fs.Int("spool-max-jobs", defaultSpoolMaxJobs, tr("trabajos que admite la cola; con la cola llena se rechazan los nuevos"))
+	spoolMaxAge := fs.Duration("spool-max-age", defaultSpoolMaxAge, tr("descartar los trabajos que llevan más de esto en la cola (0 sin límite)"))
+	idleTimeout := fs.Duration("idle-timeout", 0, tr("cierra la conexión si el cliente no envía datos en este tiempo (0 para 90s)"))
+	jobTimeout := fs.Duration("job-timeout", 0, tr("duración máxima de un trabajo (0 para 10m)"))
+	noHardening := fs.Bool("no-hardening", false, tr("no aislar el servicio de la impresora (para diagnosticar problemas)"))
+	noAppArmor := fs.Bool("no-apparmor", false, tr("no confinar el servicio con un perfil de AppArmor aunque AppArmor esté activo"))
+	usbResetOnHang := fs.Bool("usb-reset-on-hang", false, tr("reiniciar el puerto USB de la impresora cuando deja de aceptar datos y no responde, como usb-reset"))
+	withLPD := fs.Bool("lpd", false, tr("atender también LPD (LPR) para las aplicaciones que no saben imprimir en RAW"))
+	lpdQueue := fs.String("lpd-queue", "", tr("nombre de la cola LPD (solo con una impresora; por defecto el nombre de las unidades)"))
+	lpdPort := fs.Int("lpd-port", defaultLPDPort, tr("puerto LPD de la primera impresora; las siguientes usan los puertos consecutivos"))
+	withIPP := fs.Bool("ipp", false, tr("atender también IPP para imprimir desde CUPS o Windows sin instalar controladores"))
+	ippPort := fs.Int("ipp-port", defaultIPPPort, tr("puerto IPP de la primera impresora; las siguientes usan los puertos consecutivos"))
+	withHTTP := fs.Bool("http-api", false, tr("atender también una API HTTP (POST /printers/NOMBRE/jobs, WebSocket en /printers/NOMBRE/ws, gRPC y ePOS-Print en /cgi-bin/epos/service.cgi) para los sistemas de punto de venta y de gestión"))
+	httpKeys := fs.String("http-api-keys", "", tr("archivo con las claves de los terminales que pueden usar la API HTTP, una línea \"CLIENTE CLAVE\" por terminal"))
+	httpPort := fs.Int("http-api-port", defaultHTTPPort, tr("puerto de la API HTTP de la primera impresora; las siguientes usan los puertos consecutivos"))
+	unixPath := fs.String("unix", "", tr("socket Unix en el que escucha también la impresora, por ejemplo /run/escpos/lp0.sock (solo con una impresora)"))
+	unixOnly := fs.Bool("unix-only", false, tr("escuchar solo en el socket Unix, sin TCP"))
+	unixMode := fs.String("unix-mode", "", tr("permisos del socket Unix en octal, por ejemplo 0660"))
+	unixUser := fs.String("unix-user", "", tr("dueño del socket Unix"))
+	unixGroup := fs.String("unix-group", "", tr("grupo del socket Unix, por ejemplo lp"))
+	allow := fs.String("allow", "", tr("redes que pueden imprimir, separadas por comas (por ejemplo 192.168.1.0/24); el resto se rechaza"))
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s [--lang es|en] [--verbose | --quiet] [--log-format text|json] [--user] [--auto | --printer IMPRESORA[,IMPRESORA...] --yes | --config ARCHIVO] [opciones]\n"), filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr, tr("Subcomandos: status, doctor, test-print, reprint, uninstall, usb-reset, print-pairing, print-netinfo, print-announce, setup-web, relay, serve, lpd, ipp, http, mqtt, tls-cert"))
+		fs.PrintDefaults()
 	}
-	fmt.Printf("✓ Archivo de socket creado exitosamente: %s\n", socketFilePath)
+	fs.Parse(args)
 
-	// Genera el contenido del servicio con la ruta de la impresora seleccionada
-	serviceContent := serviceFileContent(selectedPrinter)
-	err = os.WriteFile(serviceFilePath, []byte(serviceContent), 0644)
+	if *port < 1 || *port > 65535 {
+		fmt.Fprintf(os.Stderr, tr("Error: puerto inválido %d\n"), *port)
+		os.Exit(exitUsage)
+	}
+	if err := validateBind(*bind, *bindIPv6Only); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if *yes && *printerArg == "" {
+		fmt.Fprintln(os.Stderr, tr("Error: --yes requiere --printer"))
+		os.Exit(exitUsage)
+	}
+	if *configPath != "" && (*auto || *printerArg != "") {
+		fmt.Fprintln(os.Stderr, tr("Error: --config no se puede combinar con --auto ni --printer"))
+		os.Exit(exitUsage)
+	}
+	serialDefaults := serialSettings{Baud: *baud, Parity: *parity, FlowControl: *flow}
+	if err := serialDefaults.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if *idleTimeout < 0 || *jobTimeout < 0 {
+		fmt.Fprintln(os.Stderr, tr("Error: los plazos no pueden ser negativos"))
+		os.Exit(exitUsage)
+	}
+	if *metricsAddr != "" {
+		if !*daemon {
+			fmt.Fprintln(os.Stderr, tr("Error: --metrics requiere --daemon"))
+			os.Exit(exitUsage)
+		}
+		if strings.Contains(*printerArg, ",") {
+			fmt.Fprintln(os.Stderr, tr("Error: --metrics solo se puede usar con una impresora"))
+			os.Exit(exitUsage)
+		}
+		if err := checkMetricsAddr(*metricsAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+	if !*withLPD && *lpdQueue != "" {
+		fmt.Fprintln(os.Stderr, tr("Error: --lpd-queue requiere --lpd"))
+		os.Exit(exitUsage)
+	}
+	if *lpdQueue != "" && strings.Contains(*printerArg, ",") {
+		fmt.Fprintln(os.Stderr, tr("Error: --lpd-queue solo se puede usar con una impresora"))
+		os.Exit(exitUsage)
+	}
+	if err := (&lpdSettings{Queue: *lpdQueue, Port: *lpdPort}).validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if err := (&ippSettings{Port: *ippPort}).validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if err := (&httpSettings{Port: *httpPort, KeysFile: *httpKeys}).validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if !*withHTTP && *httpKeys != "" {
+		fmt.Fprintln(os.Stderr, tr("Error: --http-api-keys requiere --http-api"))
+		os.Exit(exitUsage)
+	}
+	var mqtt *mqttSettings
+	if *mqttBroker != "" || *mqttTopic != "" {
+		mqtt = &mqttSettings{Broker: *mqttBroker, QoS: *mqttQoS, Username: *mqttUser, PasswordFile: *mqttPassword}
+		if *mqttTopic != "" {
+			mqtt.Topics = strings.Split(*mqttTopic, ",")
+		}
+		if err := mqtt.validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		if strings.Contains(*printerArg, ",") {
+			fmt.Fprintln(os.Stderr, tr("Error: el puente MQTT solo se puede configurar con una impresora; usa --config para varias"))
+			os.Exit(exitUsage)
+		}
+	}
+	var tlsOptions *tlsSettings
+	if *withTLS {
+		tlsOptions = &tlsSettings{Cert: *tlsCert, Key: *tlsKey}
+		if err := tlsOptions.validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		if *tlsCert != "" && strings.Contains(*printerArg, ",") {
+			fmt.Fprintln(os.Stderr, tr("Error: --tls-cert solo se puede usar con una impresora; usa --config para varias"))
+			os.Exit(exitUsage)
+		}
+	} else if *tlsCert != "" || *tlsKey != "" {
+		fmt.Fprintln(os.Stderr, tr("Error: --tls-cert y --tls-key requieren --tls"))
+		os.Exit(exitUsage)
+	}
+	var unix *unixSocket
+	if *unixPath != "" {
+		unix = &unixSocket{Path: *unixPath, Only: *unixOnly, Mode: *unixMode, User: *unixUser, Group: *unixGroup}
+		if err := unix.validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	} else if *unixOnly || *unixMode != "" || *unixUser != "" || *unixGroup != "" {
+		fmt.Fprintln(os.Stderr, tr("Error: las opciones --unix-* requieren --unix"))
+		os.Exit(exitUsage)
+	}
+	if unix != nil && strings.Contains(*printerArg, ",") {
+		fmt.Fprintln(os.Stderr, tr("Error: --unix solo se puede usar con una impresora"))
+		os.Exit(exitUsage)
+	}
+	if *maxConns < 0 || *maxConnsPerSource < 0 || *connsPerMinute < 0 || *bytesPerMinute < 0 {
+		fmt.Fprintln(os.Stderr, tr("Error: los límites de conexiones no pueden ser negativos"))
+		os.Exit(exitUsage)
+	}
+	var archive *archiveSettings
+	if *archiveDir != "" {
+		archive = &archiveSettings{Dir: *archiveDir, MaxJobs: *archiveMaxJobs, MaxAge: *archiveMaxAge}
+		if err := archive.validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+	var spool *spoolSettings
+	if *spoolDir != "" {
+		if !*daemon {
+			fmt.Fprintln(os.Stderr, tr("Error: --spool requiere --daemon"))
+			os.Exit(exitUsage)
+		}
+		spool = &spoolSettings{Dir: *spoolDir, MaxJobs: *spoolMaxJobs, MaxAge: *spoolMaxAge}
+		if err := spool.validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+	var allowFrom []string
+	if *allow != "" {
+		allowFrom = strings.Split(*allow, ",")
+	}
+	if err := validateAllowList(allowFrom); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if *label != "" && strings.Contains(*printerArg, ",") {
+		fmt.Fprintln(os.Stderr, tr("Error: --label solo se puede usar con una impresora"))
+		os.Exit(exitUsage)
+	}
+	switch *output {
+	case "text":
+	case "json":
+		startJSONOutput(*dryRun)
+	default:
+		fmt.Fprintf(os.Stderr, tr("Error: formato de salida inválido %q (text o json)\n"), *output)
+		os.Exit(exitUsage)
+	}
+
+	logger.Info(tr("Iniciando la configuración del servicio de impresora ESC/POS..."))
+
+	// --- Paso 1: Checar acceso root ---
+	// Necesitamos escribir archivos en /etc/systemd/system y ejecutar comandos systemctl,
+	// que requieren permisos elevados, salvo con --user. Con --dry-run no se toca nada.
+	if !*dryRun {
+		requireRoot()
+		logger.Debug(tr("✓ Permisos de root confirmados."))
+	}
+
+	// --- Paso 2: Encontrar y seleccionar las impresoras ---
+	printers, err := discoverPrinters()
 	if err != nil {
-		log.Fatalf("Error al escribir el archivo de servicio: %v", err)
+		failInstall(err, exitFailure)
+	}
+	report.recordDiscovered(printers)
+	for _, p := range printers {
+		logger.Debug(fmt.Sprintf(tr("Impresora encontrada: %s"), p), "device", p.Path, "port_path", p.PortPath)
+	}
+
+	if *auto {
+		runAutoInstall(usbPrinters(printers), *port, *bind, *dryRun)
+		return
 	}
-	fmt.Printf("✓ Archivo de servicio creado exitosamente: %s\n", serviceFilePath)
 
-	// --- Paso 5: Ejecuta los comandos systemctl para habilitar e iniciar el servicio ---
-	// Habilita el socket para que se inicie durante el arranque y lo inicia inmediatamente.
-	commands := [][]string{
-		{"systemctl", "daemon-reload"},
-		{"systemctl", "enable", "--now", "escpos-printer.socket"},
-		{"systemctl", "restart", "escpos-printer.socket"},
+	if *configPath != "" {
+		cfg, err := loadConfig(*configPath)
+		if err != nil {
+			failInstall(err, exitUsage)
+		}
+		list, err := installFromConfig(cfg, *dryRun)
+		if err != nil {
+			failInstall(err, exitCodeFor(err))
+		}
+		if !*dryRun {
+			printInstallSummary(list)
+		}
+		finishInstall()
+		return
 	}
 
-	for _, cmdArgs := range commands {
-		cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
-		fmt.Printf("Ejecutando: %s...\n", strings.Join(cmd.Args, " "))
-		output, err := cmd.CombinedOutput() // CombinedOutput obtiene tanto stdout como stderr
+	var selected []printer
+	if *printerArg != "" {
+		for _, name := range strings.Split(*printerArg, ",") {
+			p, err := lookupPrinter(strings.TrimSpace(name))
+			if err != nil {
+				failInstall(err, exitCodeFor(err))
+			}
+			selected = append(selected, p)
+		}
+	} else {
+		selected, err = selectPrinters(printers)
 		if err != nil {
-			log.Fatalf("Error al ejecutar el comando '%s': %v\nSalida: %s", strings.Join(cmd.Args, " "), err, string(output))
+			failInstall(err, exitNoDevice)
+		}
+	}
+
+	// El puerto solo se pregunta si no se indicó con --port.
+	portSet := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "port" {
+			portSet = true
+		}
+	})
+	firstPort := *port
+	if !*yes && !portSet {
+		firstPort = askPort(*port)
+	}
+
+	// Si CUPS ya usa la impresora se ofrece enviarle los trabajos en lugar
+	// de competir con él por el dispositivo.
+	queues := cupsQueues()
+	list := make([]installOptions, len(selected))
+	for i := range selected {
+		p := &selected[i]
+		newLabel := *label
+		if newLabel == "" && !*yes {
+			newLabel = askLabel(*p)
+		}
+		if newLabel != "" {
+			if err := applyLabel(p, newLabel, *dryRun); err != nil {
+				failInstall(err, exitFailure)
+			}
+		}
+		logger.Info(fmt.Sprintf(tr("✓ Impresora seleccionada: %s\n"), *p), "device", p.Path)
+		if p.Caps != nil {
+			logger.Info(fmt.Sprintf(tr("  Capacidades: %s\n"), p.Caps))
+		}
+		list[i] = installOptions{
+			Printer:      *p,
+			Port:         firstPort + i,
+			Bind:         *bind,
+			BindIPv6Only: *bindIPv6Only,
+			Unix:         unix,
+			TakeOver:     *takeOver,
+			Daemon:       *daemon,
+			Metrics:      *metricsAddr,
+			Archive:      archive,
+			Spool:        spool,
+
+			MaxConnections:          *maxConns,
+			MaxConnectionsPerSource: *maxConnsPerSource,
+			ConnectionsPerMinute:    *connsPerMinute,
+			BytesPerMinute:          *bytesPerMinute,
+			AllowFrom:               allowFrom,
+			NoHardening:             *noHardening,
+			NoAppArmor:              *noAppArmor,
+			USBResetOnHang:          *usbResetOnHang,
+			IdleTimeout:             *idleTimeout,
+			JobTimeout:              *jobTimeout,
+		}
+		if *withLPD {
+			list[i].LPD = &lpdSettings{Queue: *lpdQueue, Port: *lpdPort + i}
+		}
+		if *withIPP {
+			list[i].IPP = &ippSettings{Port: *ippPort + i}
+		}
+		if *withHTTP {
+			list[i].HTTP = &httpSettings{Port: *httpPort + i, KeysFile: *httpKeys}
+		}
+		list[i].RawQueue = *rawQueue
+		list[i].MDNS = *mdns
+		list[i].MQTT = mqtt
+		list[i].TLS = tlsOptions
+		list[i].OpenFirewall = *openFirewall
+		if q, ok := findCUPSQueue(*p, queues); ok {
+			useCUPS := *viaCUPS
+			if !*yes && !*viaCUPS {
+				useCUPS = askYesNo(fmt.Sprintf(tr("La impresora está configurada en CUPS como la cola %s. ¿Enviar los trabajos a través de CUPS en lugar de al dispositivo?"), q.Name), true)
+			}
+			if useCUPS {
+				list[i].CUPSQueue = q.Name
+			}
+		}
+		if p.Kind == kindSerial {
+			settings := serialDefaults
+			if !*yes {
+				settings = askSerialSettings(*p, serialDefaults)
+			}
+			list[i].Serial = &settings
+		}
+	}
+	assignUnitNames(list)
+	if !*yes {
+		askPortConflicts(list)
+		askFirewall(list)
+	}
+
+	withAnnounce := *announce
+	if !*yes && !*announce {
+		withAnnounce = askYesNo(tr("¿Imprimir la IP de la máquina en cada arranque?"), false)
+	}
+	if !*yes && !*dryRun && !confirmInstall(list, withAnnounce) {
+		failInstall(errors.New(tr("instalación cancelada")), exitFailure)
+	}
+
+	if err := installAll(list, withAnnounce, *dryRun); err != nil {
+		failInstall(err, exitFailure)
+	}
+	if !*dryRun {
+		printInstallSummary(list)
+	}
+	finishInstall()
+}
+
+// applyLabel Asigna la etiqueta a la impresora y la guarda, salvo en --dry-run,
+// donde solo se usa para generar las unidades.
+func applyLabel(p *printer, label string, dryRun bool) error {
+	if dryRun {
+		p.Label = label
+		return nil
+	}
+	return setLabel(p, label)
+}
+
+// printInstallSummary Muestra el mensaje final con la dirección de cada impresora.
+func printInstallSummary(list []installOptions) {
+	logger.Info(tr("\n🎉 ¡Configuración completa! El socket de la impresora ESC/POS está activo y habilitado."))
+	if len(list) == 1 {
+		logger.Info(fmt.Sprintf(tr("La PC está lista para aceptar trabajos de impresión en %s.\n"), list[0].listenAddr()), "listen", list[0].listenAddr())
+		return
+	}
+	logger.Info(tr("La PC está lista para aceptar trabajos de impresión en:"))
+	for _, opts := range list {
+		logger.Info(fmt.Sprintf("  %s → %s\n", opts.listenAddr(), opts.Printer), "listen", opts.listenAddr(), "device", opts.Printer.Path)
+	}
+}
+
+// installOptions Reúne las decisiones de la instalación de una impresora,
+// tomadas de forma interactiva, desde la configuración o desde el asistente web.
+type installOptions struct {
+	Name    string  // Nombre base de las unidades, vacío para defaultUnitName
+	Printer printer // Impresora a la que se envían los trabajos
+	Port    int     // Puerto TCP en el que escucha el socket
+	Bind    string  // Direcciones IP en las que escucha el socket, separadas por comas; vacía para defaultBind
+
+	BindIPv6Only string        // Valor de BindIPv6Only=, vacío para elegirlo según las direcciones
+	Unix         *unixSocket   // Socket Unix en el que escucha también, o solo, la impresora
+	LPD          *lpdSettings  // Servidor LPD adicional, nil si no se atiende LPD
+	IPP          *ippSettings  // Servidor IPP adicional, nil si no se atiende IPP
+	HTTP         *httpSettings // API HTTP adicional, nil si no se atiende HTTP
+	Frontend     string        // Protocolo de este par de unidades: vacío para RAW, frontendLPD, frontendIPP o frontendHTTP
+
+	Serial       *serialSettings  // Configuración de la línea, solo para impresoras serie
+	CUPSQueue    string           // Cola de CUPS que recibe los trabajos, vacía para escribir en el dispositivo
+	RawQueue     bool             // Crear una cola en crudo de CUPS que imprime en el socket
+	MDNS         bool             // Anunciar la impresora por mDNS con Avahi
+	MQTT         *mqttSettings    // Puente MQTT que imprime los mensajes de unos temas, nil sin puente
+	TLS          *tlsSettings     // Cifrado TLS del socket RAW, nil sin cifrar
+	OpenFirewall bool             // Abrir los puertos en ufw o firewalld, solo para las redes de AllowFrom si se indicaron
+	TakeOver     bool             // Deshabilitar el servicio que ya escucha en el puerto, si lo hay
+	Daemon       bool             // Un solo proceso atiende todas las conexiones (Accept=no)
+	Metrics      string           // Dirección HOST:PUERTO de las métricas de Prometheus del daemon, vacía sin métricas
+	Archive      *archiveSettings // Archivo de los trabajos recibidos, nil para no guardarlos
+	Spool        *spoolSettings   // Cola en disco de los trabajos pendientes del daemon, nil sin cola
+
+	USBResetOnHang bool // Reiniciar el puerto USB de la impresora cuando deja de aceptar datos
+
+	MaxConnections          int // Conexiones simultáneas admitidas, 0 para el valor de systemd (64)
+	MaxConnectionsPerSource int // Conexiones simultáneas desde una misma IP, 0 para no limitarlas
+
+	ConnectionsPerMinute int   // Conexiones por minuto desde una misma IP, 0 para no limitarlas
+	BytesPerMinute       int64 // Bytes por minuto desde una misma IP, 0 para no limitarlos
+
+	AllowFrom []string // Direcciones o redes (CIDR) que pueden imprimir; vacía para todas
+
+	NoHardening bool // No aislar el servicio (ProtectSystem=, DeviceAllow=...), para diagnosticar problemas
+	NoAppArmor  bool // No confinar el servicio con un perfil de AppArmor
+	AppArmor    bool // AppArmor está activo en el sistema; lo decide planInstall
+
+	IdleTimeout time.Duration // Plazo sin recibir datos del cliente, 0 para el valor por defecto de relay
+	JobTimeout  time.Duration // Duración máxima de un trabajo, 0 para el valor por defecto de relay
+
+	SocketOptions  map[string]string // Directivas adicionales de la sección [Socket]
+	ServiceOptions map[string]string // Directivas adicionales de la sección [Service]
+}
+
+// validateAllowList Comprueba que cada entrada de la lista de redes
+// permitidas es una dirección IP o una red en notación CIDR, y quita los
+// espacios alrededor.
+func validateAllowList(allow []string) error {
+	for i, entry := range allow {
+		entry = strings.TrimSpace(entry)
+		allow[i] = entry
+		if net.ParseIP(entry) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil {
+			return fmt.Errorf(tr("red inválida %q (usa una IP o una red como 192.168.1.0/24)"), entry)
+		}
+	}
+	return nil
+}
+
+// listenAddr Devuelve el valor del primer ListenStream=, el que se muestra en
+// los mensajes.
+func (opts installOptions) listenAddr() string {
+	return opts.listenAddrs()[0]
+}
+
+// listenAddrs Devuelve un valor de ListenStream= por cada dirección en la que
+// escucha el socket: las TCP primero y, si lo hay, el socket Unix.
+func (opts installOptions) listenAddrs() []string {
+	var addrs []string
+	if opts.listensTCP() {
+		for _, host := range bindHosts(opts.Bind) {
+			addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(opts.Port)))
+		}
+	}
+	if opts.Unix != nil {
+		addrs = append(addrs, opts.Unix.Path)
+	}
+	return addrs
+}
+
+// bindHosts Separa la lista de direcciones de --bind; vacía equivale a defaultBind.
+func bindHosts(bind string) []string {
+	var hosts []string
+	for _, host := range strings.Split(bind, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	if len(hosts) == 0 {
+		return []string{defaultBind}
+	}
+	return hosts
+}
+
+// bindIPv6Only Devuelve el valor de BindIPv6Only= del socket, o una cadena
+// vacía para no escribirlo. Si se escucha a la vez en 0.0.0.0 y en :: el
+// socket IPv6 debe ser solo IPv6; si no, el kernel lo haría de doble pila y
+// los dos chocarían en el mismo puerto.
+func (opts installOptions) bindIPv6Only() string {
+	if !opts.listensTCP() {
+		return ""
+	}
+	if opts.BindIPv6Only != "" {
+		return opts.BindIPv6Only
+	}
+	any4, any6 := false, false
+	for _, host := range bindHosts(opts.Bind) {
+		ip := net.ParseIP(host)
+		any4 = any4 || ip.Equal(net.IPv4zero)
+		any6 = any6 || ip.Equal(net.IPv6unspecified)
+	}
+	if any4 && any6 {
+		return "ipv6-only"
+	}
+	return ""
+}
+
+// validateBind Comprueba la lista de direcciones de --bind y el valor de
+// --bind-ipv6-only.
+func validateBind(bind, ipv6Only string) error {
+	for _, host := range bindHosts(bind) {
+		if net.ParseIP(host) == nil {
+			return fmt.Errorf(tr("dirección inválida %q"), host)
+		}
+	}
+	if ipv6Only != "" && !slices.Contains(bindIPv6OnlyValues, ipv6Only) {
+		return fmt.Errorf(tr("valor inválido %q para BindIPv6Only (default, both o ipv6-only)"), ipv6Only)
+	}
+	return nil
+}
+
+// socketName Devuelve el nombre del par de unidades del socket: el nombre base
+// para el socket RAW y el nombre base con el protocolo para los demás
+// (escpos-printer-lpd.socket).
+func (opts installOptions) socketName() string {
+	if opts.Frontend != "" {
+		return opts.unitName() + "-" + opts.Frontend
+	}
+	return opts.unitName()
+}
+
+// descriptionSuffix Devuelve lo que se añade a Description= para distinguir
+// las unidades de otros protocolos, por ejemplo " (LPD)".
+func (opts installOptions) descriptionSuffix() string {
+	if opts.Frontend == "" {
+		return ""
+	}
+	return " (" + strings.ToUpper(opts.Frontend) + ")"
+}
+
+// unitName Devuelve el nombre base de las unidades de esta impresora.
+func (opts installOptions) unitName() string {
+	if opts.Name == "" {
+		return defaultUnitName
+	}
+	return opts.Name
+}
+
+// assignUnitNames Da a cada impresora su propio par de unidades
+// (escpos-printer-lp0.socket, escpos-printer-lp1.socket...) para que varias
+// instalaciones convivan. Una impresora que ya estaba instalada conserva el
+// nombre de sus unidades, de modo que reinstalarla las actualiza en lugar de
+// duplicarlas. Con una sola impresora se usan los nombres de siempre mientras
+// no los ocupe otra.
+func assignUnitNames(list []installOptions) {
+	installed, _ := readInstallations()
+	taken := make(map[string]bool)
+	for _, inst := range installed {
+		taken[inst.Name] = true
+	}
+	for i := range list {
+		if inst, ok := list[i].currentInstallation(installed); ok {
+			list[i].Name = inst.Name
+			continue
+		}
+		if len(list) == 1 && !taken[defaultUnitName] {
+			continue
+		}
+		name := defaultUnitName + "-" + unitSuffix(list[i].Printer)
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%s-%s-%d", defaultUnitName, unitSuffix(list[i].Printer), n)
+		}
+		list[i].Name = name
+		taken[name] = true
+	}
+}
+
+// unitSuffix Devuelve la parte del nombre de las unidades que identifica a la
+// impresora. Las del puerto paralelo llevan "parallel-" delante porque
+// /dev/lp0 y /dev/usb/lp0 pueden existir a la vez.
+func unitSuffix(p printer) string {
+	suffix := filepath.Base(p.Path)
+	if p.Absent {
+		suffix = strings.ReplaceAll(suffix, ":", "-")
+	}
+	switch p.Kind {
+	case kindParallel:
+		suffix = "parallel-" + suffix
+	case kindNetwork:
+		suffix = networkUnitSuffix(p.Path)
+	}
+	return suffix
+}
+
+// socketUnitPath Devuelve la ruta del archivo de socket de una unidad.
+func socketUnitPath(name string) string {
+	return filepath.Join(unitDir, name+".socket")
+}
+
+// serviceUnitPath Devuelve la ruta del archivo de servicio de plantilla de una unidad.
+func serviceUnitPath(name string) string {
+	return filepath.Join(unitDir, name+"@.service")
+}
+
+// plannedFile Archivo que la instalación escribe.
+type plannedFile struct {
+	Kind    string // Tipo de archivo para los mensajes: "socket", "servicio"...
+	Path    string
+	Content string
+}
+
+// installPlan Todo lo que una instalación va a hacer en el sistema. Se construye
+// completo antes de tocar nada para poder mostrarlo con --dry-run.
+type installPlan struct {
+	Files    []plannedFile
+	Binaries []string         // Rutas a las que se copia este programa
+	Commands []plannedCommand // Comandos que se ejecutan después de escribir los archivos
+
+	// Undo Comandos que deshacen los que cambian algo fuera de los archivos
+	// del plan (el firewall, por ejemplo), por la línea del comando; véase undoWith.
+	Undo map[string][][]string
+}
+
+// undoWith Anota los comandos que deshacen cmd si la instalación falla
+// después de ejecutarlo.
+func (plan *installPlan) undoWith(cmd plannedCommand, undo ...[]string) {
+	if plan.Undo == nil {
+		plan.Undo = make(map[string][][]string)
+	}
+	key := strings.Join(cmd.Args, "\x00")
+	plan.Undo[key] = append(plan.Undo[key], undo...)
+}
+
+// undoFor Devuelve los comandos que deshacen cmd.
+func (plan installPlan) undoFor(cmd plannedCommand) [][]string {
+	return plan.Undo[strings.Join(cmd.Args, "\x00")]
+}
+
+// plannedCommand Comando del plan. Si Needs no está vacío solo se ejecuta
+// cuando cambió alguno de esos archivos, para que reinstalar sin cambios no
+// reinicie los sockets ni corte las conexiones en curso.
+type plannedCommand struct {
+	Args  []string
+	Needs []string
+}
+
+// needed Indica si el comando debe ejecutarse según los archivos que cambiaron.
+func (cmd plannedCommand) needed(changed map[string]bool) bool {
+	if len(cmd.Needs) == 0 {
+		return true
+	}
+	for _, path := range cmd.Needs {
+		if changed[path] {
+			return true
+		}
+	}
+	return false
+}
+
+// planInstall Calcula los archivos y comandos para instalar las impresoras.
+func planInstall(list []installOptions, announce bool) (installPlan, error) {
+	var plan installPlan
+
+	// Con AppArmor activo el servicio de cada impresora lleva su perfil.
+	if !userMode && apparmorEnabled() {
+		for i := range list {
+			list[i].AppArmor = true
+		}
+	}
+	// Cada impresora tiene un par de unidades por protocolo: el socket RAW
+	// y, si se pidieron, los de LPD, IPP y la API HTTP.
+	var sockets []installOptions
+	for _, opts := range list {
+		sockets = append(sockets, opts)
+		if opts.LPD != nil {
+			sockets = append(sockets, opts.lpdOptions())
+		}
+		if opts.IPP != nil {
+			sockets = append(sockets, opts.ippOptions())
+		}
+		if opts.HTTP != nil {
+			sockets = append(sockets, opts.httpOptions())
+		}
+	}
+
+	// Dos impresoras en el mismo puerto harían fallar el segundo socket.
+	seen := make(map[string]bool)
+	for _, opts := range sockets {
+		for _, addr := range opts.listenAddrs() {
+			if seen[addr] {
+				return plan, fmt.Errorf(tr("la dirección %s está asignada a más de una impresora"), addr)
+			}
+			seen[addr] = true
+		}
+	}
+	// Si otro servicio ya escucha en el puerto, "systemctl enable --now"
+	// fallaría con un error poco claro; solo se sigue si se pidió quitárselo.
+	var takeOver []string
+	for _, opts := range sockets {
+		if opts.Daemon && opts.CUPSQueue != "" {
+			return plan, fmt.Errorf(tr("%s: el modo daemon no admite colas de CUPS"), opts.Printer.Path)
+		}
+		if opts.LPD != nil && opts.CUPSQueue != "" {
+			return plan, fmt.Errorf(tr("%s: LPD no admite colas de CUPS; CUPS ya puede atender LPD con cups-lpd"), opts.Printer.Path)
+		}
+		if opts.IPP != nil && opts.CUPSQueue != "" {
+			return plan, fmt.Errorf(tr("%s: IPP no admite colas de CUPS; CUPS ya comparte sus colas por IPP"), opts.Printer.Path)
+		}
+		if opts.HTTP != nil && opts.CUPSQueue != "" {
+			return plan, fmt.Errorf(tr("%s: la API HTTP no admite colas de CUPS"), opts.Printer.Path)
+		}
+		if userMode {
+			if err := checkUserInstall(opts); err != nil {
+				return plan, err
+			}
+		}
+		owner, busy := portConflict(opts)
+		switch {
+		case !busy:
+		case opts.TakeOver && owner.Unit != "":
+			takeOver = append(takeOver, owner.Unit)
+		case opts.TakeOver:
+			return plan, fmt.Errorf(tr("el puerto %d está en uso por %s, que no es una unidad de systemd; detenlo a mano o elige otro puerto"), opts.Port, owner)
+		default:
+			return plan, fmt.Errorf(tr("el puerto %d ya está en uso por %s; elige otro con --port %d o usa --take-over para deshabilitarlo"), opts.Port, owner, nextFreePort(opts.Port+1, nil))
+		}
+	}
+
+	for _, opts := range list {
+		if err := checkRawQueue(opts); err != nil {
+			return plan, err
+		}
+		if err := checkMDNS(opts); err != nil {
+			return plan, err
+		}
+		if err := checkTLS(opts); err != nil {
+			return plan, err
+		}
+		if err := checkRateLimits(opts); err != nil {
+			return plan, err
+		}
+		if err := checkArchive(opts); err != nil {
+			return plan, err
+		}
+		if err := checkUSBReset(opts); err != nil {
+			return plan, err
+		}
+	}
+
+	connected, _ := findPrinters()
+	var rules []string
+	for _, opts := range list {
+		if opts.hasStablePath() {
+			rules = append(rules, udevRulePath(opts.unitName()))
+			plan.Files = append(plan.Files, plannedFile{"regla udev", udevRulePath(opts.unitName()), udevRuleContent(opts, connected)})
+		}
+		if opts.MDNS {
+			plan.Files = append(plan.Files, plannedFile{"servicio de Avahi", avahiServicePath(opts.unitName()), avahiServiceContent(opts)})
+		}
+		if opts.confinedByAppArmor() {
+			plan.Files = append(plan.Files, plannedFile{"perfil de AppArmor", apparmorProfilePath(opts.unitName()), apparmorProfileContent(opts)})
+		}
+	}
+	for _, opts := range sockets {
+		plan.Files = append(plan.Files,
+			plannedFile{"socket", socketUnitPath(opts.socketName()), socketFileContent(opts)},
+			// Genera el contenido del servicio con la ruta de la impresora seleccionada
+			plannedFile{"servicio", opts.serviceFile(), serviceFileContent(opts)},
+		)
+	}
+	for _, opts := range list {
+		if opts.MQTT != nil {
+			plan.Files = append(plan.Files, plannedFile{"servicio", mqttServicePath(opts.unitName()), mqttServiceContent(opts)})
+		}
+	}
+	// El anuncio de IP, el puente MQTT y el servicio de cada impresora (salvo
+	// las que pasan por CUPS) ejecutan este mismo programa desde las unidades.
+	needsBinary := announce
+	for _, opts := range list {
+		needsBinary = needsBinary || opts.CUPSQueue == "" || opts.MQTT != nil
+	}
+	if needsBinary {
+		plan.Binaries = append(plan.Binaries, installedBinaryPath)
+	}
+	if announce {
+		plan.Files = append(plan.Files, announceFiles()...)
+	}
+	// Con SELinux en modo enforcing el programa necesita su módulo de
+	// política para escribir en la impresora desde el servicio.
+	selinux := needsBinary && selinuxPlan()
+	if selinux {
+		plan.Files = append(plan.Files, plannedFile{"módulo de SELinux", selinuxModulePath, selinuxModuleContent()})
+	}
+	// Las reglas de firewall se anotan en un archivo para quitarlas al
+	// desinstalar; sin un firewall activo no hay nada que abrir.
+	firewall := ""
+	for _, opts := range sockets {
+		if opts.OpenFirewall && opts.exposedTCP() {
+			if firewall = detectFirewall(); firewall == "" {
+				logger.Warn(tr("⚠ No se detectó ufw ni firewalld activos; no se abre ningún puerto"))
+			}
+			break
+		}
+	}
+	var firewallCmds []plannedCommand
+	for _, opts := range sockets {
+		if !opts.OpenFirewall || firewall == "" {
+			continue
+		}
+		if rules := firewallRules(opts, firewall); len(rules) > 0 {
+			path := firewallStatePath(opts.socketName())
+			plan.Files = append(plan.Files, plannedFile{"reglas de firewall", path, firewallFileContent(rules)})
+			firewallCmds = append(firewallCmds, firewallCommands(&plan, path, rules)...)
 		}
-		fmt.Printf("✓ Comando exitoso.\n")
 	}
 
-	fmt.Println("\n🎉 ¡Configuración completa! El socket de la impresora ESC/POS está activo y habilitado.")
-	fmt.Println("La PC está lista para aceptar trabajos de impresión en el puerto TCP 9100.")
+	// Habilita cada socket para que se inicie durante el arranque y lo inicia inmediatamente.
+	var allFiles []string
+	for _, f := range plan.Files {
+		allFiles = append(allFiles, f.Path)
+	}
+	// Las reglas udev se aplican antes de arrancar los sockets para que el
+	// enlace estable ya exista cuando llegue el primer trabajo.
+	if len(rules) > 0 {
+		plan.Commands = append(plan.Commands,
+			plannedCommand{[]string{"udevadm", "control", "--reload-rules"}, rules},
+			plannedCommand{[]string{"udevadm", "trigger", "--subsystem-match=usbmisc", "--action=add"}, rules},
+			plannedCommand{[]string{"udevadm", "settle"}, rules},
+		)
+	}
+	if selinux {
+		plan.Commands = append(plan.Commands, selinuxCommands(list)...)
+	}
+	// El perfil tiene que estar cargado antes de que systemd arranque el
+	// servicio con AppArmorProfile=.
+	for _, opts := range list {
+		if opts.confinedByAppArmor() {
+			plan.Commands = append(plan.Commands, apparmorCommand(opts.unitName()))
+		}
+	}
+	// Los certificados autofirmados se crean con el programa ya copiado y
+	// antes de arrancar los sockets que los cargan.
+	for _, opts := range list {
+		if cmd := tlsCertCommand(opts); cmd != nil {
+			plan.Commands = append(plan.Commands, plannedCommand{cmd, nil})
+		}
+	}
+	// ReadWritePaths= necesita que los directorios existan.
+	for _, opts := range list {
+		for _, dir := range opts.writableDirs() {
+			plan.Commands = append(plan.Commands, plannedCommand{[]string{"mkdir", "-p", "-m", "0700", dir}, nil})
+		}
+	}
+	for _, unit := range takeOver {
+		cmd := plannedCommand{systemctlArgs("disable", "--now", unit), nil}
+		plan.undoWith(cmd, systemctlArgs("enable", "--now", unit))
+		plan.Commands = append(plan.Commands, cmd)
+	}
+	plan.Commands = append(plan.Commands, plannedCommand{systemctlArgs("daemon-reload"), allFiles})
+	for _, opts := range sockets {
+		socketUnit := opts.socketName() + ".socket"
+		if opts.Printer.Absent {
+			// Sin la impresora el socket no puede arrancar; systemd lo
+			// iniciará cuando aparezca su unidad .device.
+			plan.Commands = append(plan.Commands, plannedCommand{systemctlArgs("enable", socketUnit), nil})
+			continue
+		}
+		units := []string{socketUnitPath(opts.socketName()), opts.serviceFile()}
+		plan.Commands = append(plan.Commands,
+			plannedCommand{systemctlArgs("enable", "--now", socketUnit), nil},
+			plannedCommand{systemctlArgs("restart", socketUnit), units},
+		)
+		if opts.Daemon {
+			// Reiniciar el socket no reinicia el daemon que ya lo atiende.
+			plan.Commands = append(plan.Commands, plannedCommand{systemctlArgs("try-restart", opts.socketName()+".service"), units})
+		}
+	}
+	// El puente MQTT arranca cuando el socket en el que imprime ya escucha.
+	for _, opts := range list {
+		if opts.MQTT != nil {
+			service := filepath.Base(mqttServicePath(opts.unitName()))
+			plan.Commands = append(plan.Commands,
+				plannedCommand{systemctlArgs("enable", "--now", service), nil},
+				plannedCommand{systemctlArgs("restart", service), []string{mqttServicePath(opts.unitName())}},
+			)
+		}
+	}
+	// Las colas de CUPS se crean al final, cuando el socket ya escucha.
+	for _, opts := range list {
+		if opts.RawQueue {
+			plan.Commands = append(plan.Commands, plannedCommand{rawQueueCommand(opts), nil})
+		}
+	}
+	if announce {
+		// El temporizador se habilita sin --now: solo debe dispararse en el próximo arranque.
+		plan.Commands = append(plan.Commands, plannedCommand{systemctlArgs("enable", "escpos-printer-announce.timer"), nil})
+	}
+	// El firewall se abre al final, con todo lo demás ya funcionando, para
+	// que un fallo no deje un puerto abierto sin nada que lo atienda.
+	plan.Commands = append(plan.Commands, firewallCmds...)
+
+	return plan, nil
+}
+
+// apply Escribe los archivos del plan y ejecuta sus comandos.
+func (plan installPlan) apply() error {
+	// --- Paso 3: Escribe los archivos de unidad systemd ---
+	// A partir de aquí un fallo deja las unidades como estaban. El programa
+	// que se copia por primera vez se borra; el que se actualiza se queda,
+	// porque es compatible con las unidades anteriores.
+	var rb fileRollback
+	for _, dst := range plan.Binaries {
+		_, statErr := os.Stat(dst)
+		if err := copyExecutable(dst); err != nil {
+			rb.undo()
+			return err
+		}
+		if os.IsNotExist(statErr) {
+			rb.record(dst, nil, "")
+		}
+		report.recordFile(dst)
+		logger.Info(fmt.Sprintf(tr("✓ Programa instalado en %s\n"), dst), "path", dst)
+	}
+	// Se verifica después de copiar el programa, que es el ExecStart= de los
+	// servicios, y antes de tocar las unidades instaladas.
+	if err := plan.verifyUnits(); err != nil {
+		rb.undo()
+		return err
+	}
+	// Si la instalación ya existía solo se reescriben los archivos que cambian,
+	// guardando antes una copia de seguridad de la versión anterior.
+	changed, err := plan.changedFiles()
+	if err != nil {
+		rb.undo()
+		return err
+	}
+	for _, f := range plan.Files {
+		if !changed[f.Path] {
+			logger.Info(fmt.Sprintf(tr("✓ Archivo de %s sin cambios: %s\n"), tr(f.Kind), f.Path), "path", f.Path, "changed", false)
+			continue
+		}
+		done := tr("✓ Archivo de %s creado exitosamente: %s\n")
+		old, err := os.ReadFile(f.Path)
+		backup := ""
+		if err == nil {
+			backup, err = backupFile(f.Path, old)
+			if err != nil {
+				rb.undo()
+				return err
+			}
+			report.recordBackup(backup)
+			logger.Info(fmt.Sprintf(tr("El archivo de %s cambia, copia de seguridad en %s:\n"), tr(f.Kind), backup), "path", f.Path, "backup", backup)
+			printDiff(f.Path, f.Content)
+			done = tr("✓ Archivo de %s actualizado: %s\n")
+		}
+		rb.record(f.Path, old, backup)
+		// Con --user ~/.config/systemd/user puede no existir todavía.
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+			rb.undo()
+			return fmt.Errorf(tr("error al crear %s: %w"), filepath.Dir(f.Path), err)
+		}
+		if err := os.WriteFile(f.Path, []byte(f.Content), 0644); err != nil {
+			rb.undo()
+			return fmt.Errorf(tr("error al escribir el archivo de %s: %w"), tr(f.Kind), err)
+		}
+		report.recordFile(f.Path)
+		logger.Info(fmt.Sprintf(done, tr(f.Kind), f.Path), "path", f.Path, "changed", true)
+	}
+
+	// --- Paso 4: Ejecuta los comandos systemctl para habilitar e iniciar el servicio ---
+	for _, cmd := range plan.Commands {
+		if !cmd.needed(changed) {
+			logger.Info(fmt.Sprintf(tr("Omitido (sin cambios): %s\n"), strings.Join(cmd.Args, " ")), "command", cmd.Args, "skipped", true)
+			continue
+		}
+		if err := runCommand(cmd.Args); err != nil {
+			rb.undo()
+			return err
+		}
+		rb.ran(plan.undoFor(cmd))
+	}
+	return nil
+}
+
+// print Muestra el plan sin aplicarlo.
+func (plan installPlan) print() {
+	for _, dst := range plan.Binaries {
+		fmt.Printf(tr("\n# Se copiaría este programa a %s\n"), dst)
+	}
+	changed, err := plan.changedFiles()
+	if err != nil {
+		fmt.Printf("\n# %v\n", err)
+	}
+	for _, f := range plan.Files {
+		_, statErr := os.Stat(f.Path)
+		switch {
+		case !changed[f.Path]:
+			fmt.Printf(tr("\n# --- %s (%s) sin cambios ---\n"), f.Path, tr(f.Kind))
+		case statErr == nil:
+			// El archivo ya existe: basta con mostrar qué cambia.
+			fmt.Printf(tr("\n# --- %s (%s) cambia ---\n"), f.Path, tr(f.Kind))
+			printDiff(f.Path, f.Content)
+		default:
+			fmt.Printf("\n# --- %s (%s) ---\n%s", f.Path, tr(f.Kind), f.Content)
+		}
+	}
+	fmt.Println(tr("\n# Comandos que se ejecutarían:"))
+	for _, cmd := range plan.neededCommands(changed) {
+		fmt.Println(strings.Join(cmd.Args, " "))
+	}
+}
+
+// installAll Escribe las unidades systemd de cada impresora y las habilita.
+// Con dryRun solo muestra lo que haría.
+func installAll(list []installOptions, announce, dryRun bool) error {
+	plan, err := planInstall(list, announce)
+	if err != nil {
+		return err
+	}
+	report.recordSelected(list)
+	// Con --dry-run los problemas de las impresoras solo se avisan: la
+	// simulación puede hacerse sin permisos sobre los dispositivos.
+	if err := preflight(list); err != nil {
+		if !dryRun {
+			return err
+		}
+		logger.Warn(fmt.Sprintf("⚠ %v", err))
+	}
+	if dryRun {
+		if err := plan.verifyUnits(); err != nil {
+			logger.Warn(fmt.Sprintf("⚠ %v", err))
+		}
+		plan.print()
+		// En el informe JSON se anotan los archivos y comandos previstos.
+		changed, _ := plan.changedFiles()
+		for _, f := range plan.Files {
+			if changed[f.Path] {
+				report.recordFile(f.Path)
+			}
+		}
+		for _, cmd := range plan.neededCommands(changed) {
+			report.recordCommand(cmd.Args, "", nil)
+		}
+		return nil
+	}
+	if err := plan.apply(); err != nil {
+		return err
+	}
+	if userMode {
+		warnLinger()
+	}
+	return nil
+}
+
+// runCommand Ejecuta un comando mostrando su progreso.
+func runCommand(cmdArgs []string) error {
+	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+	logger.Info(fmt.Sprintf(tr("Ejecutando: %s...\n"), strings.Join(cmd.Args, " ")), "command", cmdArgs)
+	output, err := cmd.CombinedOutput() // CombinedOutput obtiene tanto stdout como stderr
+	report.recordCommand(cmdArgs, string(output), err)
+	if len(output) > 0 {
+		logger.Debug(strings.TrimSpace(string(output)), "command", cmdArgs)
+	}
+	if err != nil {
+		return fmt.Errorf(tr("error al ejecutar el comando '%s': %w\nSalida: %s"), strings.Join(cmd.Args, " "), err, string(output))
+	}
+	logger.Info(tr("✓ Comando exitoso.\n"))
+	return nil
 }
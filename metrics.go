@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsWriteBuckets Límites en segundos del histograma de escritura en la
+// impresora: de lo normal (milisegundos) a una impresora sin papel que deja
+// de aceptar datos hasta que vence el plazo de escritura.
+var metricsWriteBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 30}
+
+// checkMetricsAddr Comprueba la dirección HOST:PUERTO de /metrics.
+func checkMetricsAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err == nil {
+		_, err = strconv.ParseUint(port, 10, 16)
+	}
+	if err != nil {
+		return fmt.Errorf(tr("dirección de métricas inválida %q (HOST:PUERTO)"), addr)
+	}
+	return nil
+}
+
+// metricsFlags Devuelve la opción de métricas de serve.
+func metricsFlags(opts installOptions) string {
+	if opts.Metrics == "" {
+		return ""
+	}
+	return " --metrics " + opts.Metrics
+}
+
+// metricsFromExecStart Extrae la dirección de las métricas de la línea
+// ExecStart= del daemon, o devuelve una cadena vacía si no las publica.
+func metricsFromExecStart(execStart string) string {
+	fields := strings.Fields(execStart)
+	for i, field := range fields {
+		if field == "--metrics" && i+1 < len(fields) {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
+
+// serveMetrics Contadores del modo daemon, que se publican en /metrics con
+// el formato de texto de Prometheus. Un *serveMetrics nil no cuenta nada,
+// para que serve no tenga que comprobar si se pidieron.
+type serveMetrics struct {
+	addr      string                   // Socket que atiende el daemon, para /healthz
+	check     func() deviceStatus      // Comprueba si la impresora está disponible
+	condition func() *printerCondition // Estado que informa la impresora, nil si no lo informa
+	spooled   func() int               // Trabajos en la cola de disco, nil sin cola
+
+	mu         sync.Mutex
+	jobs       int64
+	jobErrors  int64
+	bytes      int64
+	active     int
+	writes     []int64 // Escrituras por cubeta de metricsWriteBuckets; la última es +Inf
+	writesSum  float64
+	writeCount int64
+}
+
+// newServeMetrics Crea los contadores.
+func newServeMetrics(addr string, check func() deviceStatus, condition func() *printerCondition) *serveMetrics {
+	return &serveMetrics{addr: addr, check: check, condition: condition, writes: make([]int64, len(metricsWriteBuckets)+1)}
+}
+
+// listen Publica /metrics y /healthz en addr. Si no se puede escuchar el
+// servicio termina: es preferible que systemd lo muestre fallido a que la
+// monitorización crea que la tienda no imprime.
+func (m *serveMetrics) listen(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", m)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, checkHealth(m.addr, m.check, m.condition))
+	})
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          log.New(io.Discard, "", 0),
+	}
+	logger.Info(fmt.Sprintf(tr("Métricas en http://%s/metrics"), addr), "metrics", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf(tr("Error al publicar las métricas: %v"), err)
+	}
+}
+
+// connOpened Anota una conexión nueva, que cuenta como activa mientras
+// espera su turno y mientras imprime.
+func (m *serveMetrics) connOpened() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.active++
+	m.mu.Unlock()
+}
+
+// connClosed Anota el cierre de una conexión.
+func (m *serveMetrics) connClosed() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.active--
+	m.mu.Unlock()
+}
+
+// jobDone Anota un trabajo terminado, con los bytes que llegaron a la
+// impresora y su error, si falló.
+func (m *serveMetrics) jobDone(n int64, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs++
+	m.bytes += n
+	if err != nil {
+		m.jobErrors++
+	}
+}
+
+// observeWrite Anota lo que tardó la impresora en aceptar un bloque.
+func (m *serveMetrics) observeWrite(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := d.Seconds()
+	i := 0
+	for i < len(metricsWriteBuckets) && s > metricsWriteBuckets[i] {
+		i++
+	}
+	m.writes[i]++
+	m.writesSum += s
+	m.writeCount++
+}
+
+// meter Envuelve la entrada del trabajo para medir las escrituras. relayDevice
+// y relayNetwork alternan una lectura y una escritura, así que el tiempo que
+// pasa entre que una lectura devuelve datos y la siguiente empieza es lo que
+// tardó en escribirse ese bloque. finish mide el último.
+func (m *serveMetrics) meter(in io.Reader) *writeMeter {
+	return &writeMeter{r: in, m: m}
+}
+
+// writeMeter Lector que mide las escrituras del trabajo; véase meter.
+type writeMeter struct {
+	r    io.Reader
+	m    *serveMetrics
+	last time.Time // Cuándo se leyó el bloque que se está escribiendo
+}
+
+func (w *writeMeter) Read(p []byte) (int, error) {
+	w.finish()
+	n, err := w.r.Read(p)
+	if n > 0 {
+		w.last = time.Now()
+	}
+	return n, err
+}
+
+// finish Mide la escritura del último bloque leído, si queda alguna.
+func (w *writeMeter) finish() {
+	if w.m != nil && !w.last.IsZero() {
+		w.m.observeWrite(time.Since(w.last))
+	}
+	w.last = time.Time{}
+}
+
+// ServeHTTP Devuelve las métricas. La disponibilidad y el estado de la
+// impresora se comprueban en cada consulta, como en /healthz.
+func (m *serveMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := checkHealth(m.addr, m.check, m.condition)
+	up := 0
+	if report.Healthy {
+		up = 1
+	}
+	m.mu.Lock()
+	var b strings.Builder
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	metric("escpos_jobs_total", "counter", "Print jobs finished, successfully or not.")
+	fmt.Fprintf(&b, "escpos_jobs_total %d\n", m.jobs)
+	metric("escpos_job_errors_total", "counter", "Print jobs that ended with an error.")
+	fmt.Fprintf(&b, "escpos_job_errors_total %d\n", m.jobErrors)
+	metric("escpos_bytes_written_total", "counter", "Bytes written to the printer.")
+	fmt.Fprintf(&b, "escpos_bytes_written_total %d\n", m.bytes)
+	metric("escpos_active_connections", "gauge", "Client connections printing or waiting for their turn.")
+	fmt.Fprintf(&b, "escpos_active_connections %d\n", m.active)
+	metric("escpos_device_write_seconds", "histogram", "Time the printer took to accept each block of a job.")
+	var cumulative int64
+	for i, le := range metricsWriteBuckets {
+		cumulative += m.writes[i]
+		fmt.Fprintf(&b, "escpos_device_write_seconds_bucket{le=\"%s\"} %d\n", strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(&b, "escpos_device_write_seconds_bucket{le=\"+Inf\"} %d\n", m.writeCount)
+	fmt.Fprintf(&b, "escpos_device_write_seconds_sum %s\n", strconv.FormatFloat(m.writesSum, 'g', -1, 64))
+	fmt.Fprintf(&b, "escpos_device_write_seconds_count %d\n", m.writeCount)
+	m.mu.Unlock()
+	if m.spooled != nil {
+		metric("escpos_spooled_jobs", "gauge", "Jobs waiting in the disk spool for the printer.")
+		fmt.Fprintf(&b, "escpos_spooled_jobs %d\n", m.spooled())
+	}
+	metric("escpos_printer_up", "gauge", "Whether the printer can print (1) or not (0): reachable, online, with paper, with the cover closed and without errors.")
+	fmt.Fprintf(&b, "escpos_printer_up %d\n", up)
+	// Mientras imprime no se pregunta a la impresora: sin datos es mejor no
+	// publicar las series que publicar valores supuestos.
+	if c := report.Printer; c != nil && !c.Busy {
+		gauge := func(name, help string, set bool) {
+			metric(name, "gauge", help)
+			v := 0
+			if set {
+				v = 1
+			}
+			fmt.Fprintf(&b, "%s %d\n", name, v)
+		}
+		gauge("escpos_printer_online", "Whether the printer reports itself online.", c.Online)
+		gauge("escpos_printer_paper_out", "Whether the printer reports it is out of paper.", c.PaperOut)
+		gauge("escpos_printer_cover_open", "Whether the printer reports its cover open.", c.CoverOpen)
+		gauge("escpos_printer_error", "Whether the printer reports an error, such as a cutter jam.", c.Error)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	io.WriteString(w, b.String())
+}
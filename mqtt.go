@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Parámetros del cliente MQTT.
+const (
+	mqttKeepAlive      = 60 * time.Second
+	mqttReconnectDelay = 10 * time.Second
+	maxMQTTMessage     = 4 << 20
+	mqttCredential     = "mqtt-password"
+)
+
+// Tipos de paquete de MQTT 3.1.1, en los cuatro bits altos de la cabecera.
+const (
+	mqttConnect     = 0x10
+	mqttConnAck     = 0x20
+	mqttPublish     = 0x30
+	mqttPubAck      = 0x40
+	mqttPubRec      = 0x50
+	mqttPubRel      = 0x60
+	mqttPubComp     = 0x70
+	mqttSubscribe   = 0x80
+	mqttSubAck      = 0x90
+	mqttPingReq     = 0xC0
+	mqttPingResp    = 0xD0
+	mqttPacketTypes = 0xF0
+)
+
+// mqttSettings Puente MQTT de una impresora: se suscribe a los temas del
+// broker e imprime cada mensaje en el socket de la impresora. Cada impresora
+// tiene sus temas, así el sistema de punto de venta elige la impresora según
+// el tema en el que publica.
+type mqttSettings struct {
+	Broker       string   `yaml:"broker"`        // tcp://HOST:1883 o mqtts://HOST:8883
+	Topics       []string `yaml:"topics"`        // Por ejemplo store/42/receipt; admite + y #
+	QoS          int      `yaml:"qos"`           // 0, 1 o 2
+	ClientID     string   `yaml:"client_id"`     // Vacío para escpos-EQUIPO-UNIDADES
+	Username     string   `yaml:"username"`      // Vacío sin autenticación
+	PasswordFile string   `yaml:"password_file"` // Archivo con la contraseña, que no queda en la unidad
+}
+
+// validate Comprueba el broker, los temas y la calidad de servicio.
+func (m *mqttSettings) validate() error {
+	if _, _, err := mqttBrokerAddr(m.Broker); err != nil {
+		return err
+	}
+	if len(m.Topics) == 0 {
+		return errors.New(tr("el puente MQTT necesita al menos un tema"))
+	}
+	for _, topic := range m.Topics {
+		if topic == "" || strings.ContainsAny(topic, " \x00") || strings.Contains(strings.TrimSuffix(topic, "#"), "#") {
+			return fmt.Errorf(tr("tema MQTT inválido %q"), topic)
+		}
+	}
+	if m.QoS < 0 || m.QoS > 2 {
+		return fmt.Errorf(tr("QoS de MQTT inválida %d (0, 1 o 2)"), m.QoS)
+	}
+	if m.PasswordFile != "" && !filepath.IsAbs(m.PasswordFile) {
+		return fmt.Errorf(tr("la ruta del archivo de contraseña debe ser absoluta: %q"), m.PasswordFile)
+	}
+	return nil
+}
+
+// mqttBrokerAddr Devuelve la dirección HOST:PUERTO del broker y si se conecta
+// con TLS. Sin esquema se entiende tcp://.
+func mqttBrokerAddr(broker string) (string, bool, error) {
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	u, err := url.Parse(broker)
+	if err != nil || u.Hostname() == "" {
+		return "", false, fmt.Errorf(tr("broker MQTT inválido %q (usa tcp://HOST:PUERTO o mqtts://HOST:PUERTO)"), broker)
+	}
+	port, secure := "1883", false
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "mqtts", "ssl", "tls":
+		port, secure = "8883", true
+	default:
+		return "", false, fmt.Errorf(tr("broker MQTT inválido %q (usa tcp://HOST:PUERTO o mqtts://HOST:PUERTO)"), broker)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port), secure, nil
+}
+
+// mqttServicePath Devuelve la ruta del servicio del puente MQTT de la impresora.
+func mqttServicePath(name string) string {
+	return filepath.Join(unitDir, name+"-mqtt.service")
+}
+
+// localTarget Devuelve la dirección por la que esta máquina imprime en el
+// socket de la impresora: el puerto TCP o, si solo escucha ahí, el socket Unix.
+func (opts installOptions) localTarget() string {
+	if !opts.listensTCP() {
+		return opts.Unix.Path
+	}
+	return net.JoinHostPort(loopbackHost(opts.Bind), strconv.Itoa(opts.Port))
+}
+
+// mqttServiceContent Crea el servicio del puente MQTT. Los mensajes se
+// imprimen a través del socket de la impresora, así pasan por el mismo camino
+// (relay, daemon o CUPS) que los del punto de venta. La contraseña se pasa
+// como credencial de systemd para que no aparezca en la línea de órdenes.
+func mqttServiceContent(opts installOptions) string {
+	m := opts.MQTT
+	execStart := fmt.Sprintf("%s mqtt --broker %s --topic %s --qos %d --name %s --to %s", installedBinaryPath, m.Broker, strings.Join(m.Topics, ","), m.QoS, opts.unitName(), opts.localTarget())
+	if m.ClientID != "" {
+		execStart += " --client-id " + m.ClientID
+	}
+	if m.Username != "" {
+		execStart += " --username " + m.Username
+	}
+	credential, wantedBy := "", "multi-user.target"
+	switch {
+	case m.PasswordFile != "" && userMode:
+		execStart += " --password-file " + m.PasswordFile
+	case m.PasswordFile != "":
+		credential = "LoadCredential=" + mqttCredential + ":" + m.PasswordFile + "\n"
+	}
+	if userMode {
+		wantedBy = "default.target"
+	}
+	hardening := ""
+	if !opts.NoHardening && !userMode {
+		hardening = strings.Join(append(append([]string{}, commonHardening...), "PrivateDevices=yes", "RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6"), "\n") + "\n"
+	}
+	return fmt.Sprintf(`[Unit]
+Description=ESC/POS Printer MQTT bridge (%s)
+Wants=network-online.target
+After=network-online.target %s.socket
+
+[Service]
+ExecStart=%s
+%sRestart=on-failure
+RestartSec=10
+StandardOutput=journal
+%s
+[Install]
+WantedBy=%s
+`, opts.unitName(), opts.socketName(), execStart, credential, hardening, wantedBy)
+}
+
+// mqttClient Conexión con el broker MQTT.
+type mqttClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+	mu   sync.Mutex // Las escrituras vienen de la lectura y de los ping
+}
+
+// mqttString Codifica una cadena con su longitud de dos bytes delante.
+func mqttString(s string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(s))), s...)
+}
+
+// writePacket Envía un paquete con la cabecera fija y la longitud restante.
+func (c *mqttClient) writePacket(header byte, body []byte) error {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(mqttKeepAlive / 2))
+	_, err := c.conn.Write(append(packet, body...))
+	return err
+}
+
+// readPacket Lee un paquete. Si el broker no envía nada, ni siquiera la
+// respuesta a los ping, durante más de un intervalo de keepalive, la conexión
+// se da por perdida.
+func (c *mqttClient) readPacket() (byte, []byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(mqttKeepAlive * 3 / 2))
+	header, err := c.br.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, 0
+	for {
+		b, err := c.br.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7F) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errors.New(tr("paquete MQTT inválido"))
+		}
+	}
+	if n > maxMQTTMessage {
+		return 0, nil, fmt.Errorf(tr("el mensaje supera %d bytes"), maxMQTTMessage)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.br, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// mqttConnAckErrors Motivos de rechazo de CONNACK.
+var mqttConnAckErrors = map[byte]string{
+	1: "versión del protocolo no admitida",
+	2: "identificador de cliente rechazado",
+	3: "servicio no disponible",
+	4: "usuario o contraseña incorrectos",
+	5: "no autorizado",
+}
+
+// defaultMQTTClientID Devuelve el identificador de cliente de la impresora
+// name en el equipo hostname. MQTT 3.1.1 solo obliga a los brokers a admitir
+// identificadores de hasta 23 bytes, así que en lugar del nombre completo se
+// usa "escpos-" y 16 cifras hexadecimales de su resumen.
+func defaultMQTTClientID(hostname, name string) string {
+	sum := sha256.Sum256([]byte(hostname + "\x00" + name))
+	return "escpos-" + hex.EncodeToString(sum[:8])
+}
+
+// connectMQTT Conecta con el broker y se suscribe a los temas. Con QoS 1 o 2
+// la sesión es persistente, para que el broker guarde los mensajes que
+// lleguen mientras el puente está desconectado.
+func connectMQTT(broker, clientID, username, password string, topics []string, qos int) (*mqttClient, error) {
+	addr, secure, err := mqttBrokerAddr(broker)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: relayDialTimeout}
+	var conn net.Conn
+	if secure {
+		host, _, _ := net.SplitHostPort(addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(tr("error al conectar con el broker %s: %w"), addr, err)
+	}
+	c := &mqttClient{conn: conn, br: bufio.NewReader(conn)}
+
+	flags := byte(0)
+	if qos == 0 {
+		flags |= 0x02 // Clean session
+	}
+	payload := mqttString(clientID)
+	if username != "" {
+		flags |= 0x80
+		payload = append(payload, mqttString(username)...)
+		if password != "" {
+			flags |= 0x40
+			payload = append(payload, mqttString(password)...)
+		}
+	}
+	body := append(mqttString("MQTT"), 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(mqttKeepAlive/time.Second))
+	if err := c.writePacket(mqttConnect, append(body, payload...)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	header, ack, err := c.readPacket()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf(tr("error al conectar con el broker %s: %w"), addr, err)
+	}
+	if header&mqttPacketTypes != mqttConnAck || len(ack) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf(tr("respuesta inesperada del broker %s"), addr)
+	}
+	if code := ack[1]; code != 0 {
+		conn.Close()
+		reason, ok := mqttConnAckErrors[code]
+		if !ok {
+			reason = fmt.Sprintf("código %d", code)
+		}
+		return nil, fmt.Errorf(tr("el broker %s rechazó la conexión: %s"), addr, tr(reason))
+	}
+
+	sub := binary.BigEndian.AppendUint16(nil, 1)
+	for _, topic := range topics {
+		sub = append(append(sub, mqttString(topic)...), byte(qos))
+	}
+	if err := c.writePacket(mqttSubscribe|0x02, sub); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// serve Atiende los mensajes del broker hasta que se pierde la conexión.
+// Con QoS 1 y 2 el mensaje solo se confirma cuando está impreso: si la
+// impresora falla se corta la conexión y el broker lo vuelve a entregar al
+// reconectar. Los mensajes retenidos no se imprimen, porque son tickets
+// antiguos que el broker repite a cada nuevo suscriptor.
+func (c *mqttClient) serve(topics []string, deliver func(topic string, payload []byte) error) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(mqttKeepAlive / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				c.writePacket(mqttPingReq, nil)
+			}
+		}
+	}()
+
+	received := make(map[uint16]bool) // QoS 2 a la espera de PUBREL
+	for {
+		header, body, err := c.readPacket()
+		if err != nil {
+			return fmt.Errorf(tr("conexión con el broker perdida: %w"), err)
+		}
+		switch header & mqttPacketTypes {
+		case mqttSubAck:
+			for i, code := range body[min(2, len(body)):] {
+				if code == 0x80 && i < len(topics) {
+					return fmt.Errorf(tr("el broker rechazó la suscripción a %s"), topics[i])
+				}
+			}
+			logger.Info(fmt.Sprintf(tr("Suscrito a %s"), strings.Join(topics, ", ")), "topics", topics)
+		case mqttPublish:
+			qos, retain := (header>>1)&3, header&1 != 0
+			if len(body) < 2 {
+				return errors.New(tr("paquete MQTT inválido"))
+			}
+			n := int(binary.BigEndian.Uint16(body))
+			if len(body) < 2+n {
+				return errors.New(tr("paquete MQTT inválido"))
+			}
+			topic, rest := string(body[2:2+n]), body[2+n:]
+			var id uint16
+			if qos > 0 {
+				if len(rest) < 2 {
+					return errors.New(tr("paquete MQTT inválido"))
+				}
+				id, rest = binary.BigEndian.Uint16(rest), rest[2:]
+			}
+			switch {
+			case retain:
+				logger.Info(fmt.Sprintf(tr("Mensaje retenido de %s ignorado"), topic), "topic", topic)
+			case qos == 2 && received[id]:
+				// Repetición de un mensaje ya impreso.
+			default:
+				if err := deliver(topic, rest); err != nil {
+					if qos == 0 {
+						logger.Error(fmt.Sprintf(tr("Error al imprimir el mensaje de %s: %v"), topic, err), "topic", topic)
+						continue
+					}
+					return fmt.Errorf(tr("error al imprimir el mensaje de %s: %w"), topic, err)
+				}
+				logger.Info(fmt.Sprintf(tr("Mensaje de %s de %d bytes impreso"), topic, len(rest)), "topic", topic, "bytes", len(rest))
+			}
+			switch qos {
+			case 1:
+				err = c.writePacket(mqttPubAck, binary.BigEndian.AppendUint16(nil, id))
+			case 2:
+				received[id] = true
+				err = c.writePacket(mqttPubRec, binary.BigEndian.AppendUint16(nil, id))
+			}
+		case mqttPubRel:
+			if len(body) >= 2 {
+				id := binary.BigEndian.Uint16(body)
+				delete(received, id)
+				err = c.writePacket(mqttPubComp, body[:2])
+			}
+		case mqttPingResp:
+		}
+		if err != nil {
+			return fmt.Errorf(tr("conexión con el broker perdida: %w"), err)
+		}
+	}
+}
+
+// runMQTT Implementa el subcomando "mqtt", el servicio del puente MQTT de
+// cada impresora. Si se pierde la conexión con el broker se reconecta.
+func runMQTT(args []string) {
+	fs := flag.NewFlagSet("mqtt", flag.ExitOnError)
+	broker := fs.String("broker", "", tr("broker MQTT, por ejemplo tcp://192.168.1.5:1883 o mqtts://broker:8883"))
+	topics := fs.String("topic", "", tr("temas a los que suscribirse, separados por comas"))
+	qos := fs.Int("qos", 1, tr("calidad de servicio de la suscripción: 0, 1 o 2"))
+	name := fs.String("name", defaultUnitName, tr("nombre de la impresora, para el identificador de cliente"))
+	clientID := fs.String("client-id", "", tr("identificador de cliente MQTT (por defecto escpos- y un resumen del equipo y el nombre)"))
+	username := fs.String("username", "", tr("usuario del broker"))
+	passwordFile := fs.String("password-file", "", tr("archivo con la contraseña del broker"))
+	to := fs.String("to", "", tr("socket de la impresora: HOST:PUERTO o ruta del socket Unix"))
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s mqtt --broker URL --topic TEMA[,TEMA...] --to HOST:PUERTO\n"), filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	settings := mqttSettings{Broker: *broker, QoS: *qos}
+	if *topics != "" {
+		settings.Topics = strings.Split(*topics, ",")
+	}
+	if *to == "" {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	if err := settings.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	// La contraseña llega como credencial de systemd o en un archivo.
+	password := ""
+	if *passwordFile == "" && os.Getenv("CREDENTIALS_DIRECTORY") != "" {
+		*passwordFile = filepath.Join(os.Getenv("CREDENTIALS_DIRECTORY"), mqttCredential)
+	}
+	if *passwordFile != "" {
+		data, err := os.ReadFile(*passwordFile)
+		if err != nil {
+			log.Fatalf(tr("Error al leer la contraseña del broker: %v"), err)
+		}
+		password = strings.TrimSpace(string(data))
+	}
+	if *clientID == "" {
+		hostname, _ := os.Hostname()
+		*clientID = defaultMQTTClientID(hostname, *name)
+	}
+
+	deliver := func(topic string, payload []byte) error {
+		return sendToSocket(*to, payload)
+	}
+	for {
+		c, err := connectMQTT(*broker, *clientID, *username, password, settings.Topics, *qos)
+		if err == nil {
+			logger.Info(fmt.Sprintf(tr("Conectado al broker %s como %s"), *broker, *clientID), "broker", *broker, "client_id", *clientID)
+			err = c.serve(settings.Topics, deliver)
+			c.conn.Close()
+		}
+		logger.Warn(fmt.Sprintf(tr("⚠ %v; se reintenta en %s"), err, mqttReconnectDelay), "broker", *broker)
+		time.Sleep(mqttReconnectDelay)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultGateways Lee /proc/net/route y devuelve la puerta de enlace
+// predeterminada de cada interfaz (por ejemplo "eth0 192.168.1.1").
+func defaultGateways() ([]string, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, fmt.Errorf(tr("error al leer la tabla de rutas: %w"), err)
+	}
+	defer f.Close()
+
+	var gateways []string
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // Omite la cabecera
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue // Solo interesan las rutas por defecto
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		// El kernel escribe la dirección en el orden de bytes de la máquina (little endian)
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(raw))
+		gateways = append(gateways, fields[0]+" "+ip.String())
+	}
+	return gateways, scanner.Err()
+}
+
+// listeningTCPPorts Devuelve los puertos TCP en estado LISTEN según /proc/net/tcp y tcp6.
+func listeningTCPPorts() []int {
+	seen := make(map[int]bool)
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // Omite la cabecera
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 4 || fields[3] != "0A" { // 0A = TCP_LISTEN
+				continue
+			}
+			_, portHex, ok := strings.Cut(fields[1], ":")
+			if !ok {
+				continue
+			}
+			if port, err := strconv.ParseUint(portHex, 16, 16); err == nil {
+				seen[int(port)] = true
+			}
+		}
+		f.Close()
+	}
+
+	ports := make([]int, 0, len(seen))
+	for port := range seen {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+// firewallStatus Devuelve una línea con el estado de ufw o firewalld, si existen.
+func firewallStatus() string {
+	if _, err := exec.LookPath("ufw"); err == nil {
+		out, err := exec.Command("ufw", "status").CombinedOutput()
+		if err == nil {
+			first, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+			return "ufw: " + first
+		}
+	}
+	if _, err := exec.LookPath("firewall-cmd"); err == nil {
+		out, _ := exec.Command("firewall-cmd", "--state").CombinedOutput()
+		return "firewalld: " + strings.TrimSpace(string(out))
+	}
+	return "no se detectó ufw ni firewalld"
+}
+
+// netinfoReceipt Construye el recibo de diagnóstico de red.
+func netinfoReceipt() (*receipt, error) {
+	r := newReceipt().
+		align(alignCenter).bold(true).size(2, 2).line("Diagnóstico de red").size(1, 1).bold(false)
+	hostname, _ := os.Hostname()
+	r.line(hostname).line(time.Now().Format("2006-01-02 15:04:05")).feed(1).align(alignLeft)
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf(tr("error al listar las interfaces de red: %w"), err)
+	}
+	r.bold(true).line("Interfaces").bold(false)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		state := "inactiva"
+		if iface.Flags&net.FlagUp != 0 {
+			state = "activa"
+		}
+		r.line(fmt.Sprintf("%s (%s) %s", iface.Name, state, iface.HardwareAddr))
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			r.line("  " + addr.String())
+		}
+	}
+
+	r.feed(1).bold(true).line("Puerta de enlace").bold(false)
+	gateways, err := defaultGateways()
+	if err != nil || len(gateways) == 0 {
+		r.line("  ninguna")
+	}
+	for _, gw := range gateways {
+		r.line("  " + gw)
+	}
+
+	r.feed(1).bold(true).line("Puertos TCP en escucha").bold(false)
+	var ports []string
+	for _, port := range listeningTCPPorts() {
+		ports = append(ports, strconv.Itoa(port))
+	}
+	r.line("  " + strings.Join(ports, " "))
+
+	r.feed(1).bold(true).line("Firewall").bold(false)
+	r.line("  " + firewallStatus())
+
+	return r.feed(3).cut(), nil
+}
+
+// runPrintNetinfo Implementa el subcomando "print-netinfo [impresora]", que
+// imprime la configuración de red de la máquina en la impresora.
+func runPrintNetinfo(args []string) {
+	if len(args) > 1 {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s print-netinfo [impresora]\n"), filepath.Base(os.Args[0]))
+		os.Exit(2)
+	}
+	// Con una impresora indicada no hace falta que esté instalada: el
+	// diagnóstico sirve precisamente cuando la instalación no funciona.
+	var p printer
+	var err error
+	if len(args) == 1 {
+		p, err = lookupPrinter(args[0])
+	} else {
+		p, _, err = installedPrinter("")
+	}
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	r, err := netinfoReceipt()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := writeToDevice(p.Path, r.Bytes()); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	logger.Info(fmt.Sprintf(tr("✓ Diagnóstico de red impreso en %s\n"), p))
+}
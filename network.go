@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// networkScheme Prefijo con el que se indica una impresora de red en
+// --printer o en la configuración: tcp://192.168.1.50 o tcp://192.168.1.50:9100.
+const networkScheme = "tcp://"
+
+// Reintentos de la conexión con una impresora de red. Las impresoras Epson
+// aceptan una sola conexión a la vez y tardan en liberar el puerto entre
+// trabajos, así que un rechazo no suele durar más de unos segundos.
+const (
+	relayDialTimeout = 5 * time.Second
+	relayAttempts    = 5
+	relayRetryDelay  = 2 * time.Second
+)
+
+// isNetworkPrinter Indica si el nombre designa una impresora de red.
+func isNetworkPrinter(name string) bool {
+	return strings.HasPrefix(name, networkScheme)
+}
+
+// networkPrinter Crea la impresora de red a partir de tcp://HOST[:PUERTO].
+// La ruta de la impresora es la dirección HOST:PUERTO a la que se reenvían
+// los trabajos; si no se indica el puerto se usa el 9100.
+func networkPrinter(name string) (printer, error) {
+	addr := strings.TrimPrefix(name, networkScheme)
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = strings.Trim(addr, "[]"), strconv.Itoa(defaultPort)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return printer{}, fmt.Errorf(tr("puerto inválido en %s"), name)
+	}
+	if host == "" || strings.ContainsAny(host, " /") {
+		return printer{}, fmt.Errorf(tr("dirección de impresora de red inválida %q"), name)
+	}
+	return printer{Path: net.JoinHostPort(host, port), Kind: kindNetwork}, nil
+}
+
+// networkUnitSuffix Devuelve la parte del nombre de las unidades que identifica
+// a una impresora de red (net-192.168.1.50 o net-192.168.1.50-9101). systemd
+// no admite los corchetes ni los ":" de IPv6 dentro de un nombre de plantilla.
+func networkUnitSuffix(addr string) string {
+	host, port, _ := net.SplitHostPort(addr)
+	suffix := "net-" + strings.ReplaceAll(host, ":", "-")
+	if port != strconv.Itoa(defaultPort) {
+		suffix += "-" + port
+	}
+	return suffix
+}
+
+// remoteFromExecStart Extrae la dirección de la impresora de red de la línea
+// ExecStart= del servicio (relay, serve, lpd, ipp o http), o devuelve una cadena vacía si no
+// reenvía a la red.
+func remoteFromExecStart(execStart string) string {
+	fields := strings.Fields(execStart)
+	for i, field := range fields {
+		if field == "--to" && i > 0 && (fields[i-1] == "relay" || fields[i-1] == "serve" || fields[i-1] == frontendLPD || fields[i-1] == frontendIPP || fields[i-1] == frontendHTTP) && i+1 < len(fields) {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
+
+// checkRemote Comprueba que la impresora de red acepta conexiones. Usa los
+// mismos campos que checkDevice: Exists y Writable si la conexión se abre.
+func checkRemote(addr string) deviceStatus {
+	st := deviceStatus{Path: addr}
+	conn, err := net.DialTimeout("tcp", addr, relayDialTimeout)
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	conn.Close()
+	st.Exists = true
+	st.Writable = true
+	return st
+}
+
+// dialPrinter Abre la conexión con la impresora de red, reintentando mientras
+// esté ocupada con otro trabajo.
+func dialPrinter(addr string) (net.Conn, error) {
+	var err error
+	for attempt := 1; attempt <= relayAttempts; attempt++ {
+		var conn net.Conn
+		conn, err = net.DialTimeout("tcp", addr, relayDialTimeout)
+		if err == nil {
+			return conn, nil
+		}
+		if attempt < relayAttempts {
+			logger.Warn(fmt.Sprintf(tr("No se pudo conectar con %s (intento %d de %d): %v"), addr, attempt, relayAttempts, err), "remote", addr)
+			time.Sleep(relayRetryDelay)
+		}
+	}
+	return nil, fmt.Errorf(tr("error al conectar con la impresora %s: %w"), addr, err)
+}
+
+// relayNetwork Copia el trabajo de la entrada a la impresora de red y espera
+// a que la impresora cierre la conexión. Devuelve los bytes enviados.
+func relayNetwork(in io.Reader, addr string) (int64, error) {
+	conn, err := dialPrinter(addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	n, err := io.Copy(conn, in)
+	if err != nil {
+		return n, fmt.Errorf(tr("error al enviar el trabajo a %s: %w"), addr, err)
+	}
+	// Se cierra solo el envío para que la impresora sepa que el trabajo
+	// terminó; lo que responda (estado ASB, por ejemplo) se descarta.
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	}
+	conn.SetReadDeadline(time.Now().Add(relayDialTimeout))
+	if _, err := io.Copy(io.Discard, conn); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+		logger.Debug(fmt.Sprintf(tr("La impresora %s cerró la conexión con un error: %v"), addr, err), "remote", addr)
+	}
+	return n, nil
+}
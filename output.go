@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+)
+
+// installReport Resultado de la instalación que se emite con --output json,
+// para que las herramientas de gestión no tengan que interpretar los mensajes.
+type installReport struct {
+	DryRun     bool              `json:"dry_run"`
+	Discovered []printer         `json:"discovered"`
+	Selected   []selectedPrinter `json:"selected"`
+	Files      []string          `json:"files"`
+	Backups    []string          `json:"backups"`
+	Commands   []commandResult   `json:"commands"`
+	Success    bool              `json:"success"`
+	Error      string            `json:"error,omitempty"`
+	ExitCode   int               `json:"exit_code"`
+}
+
+// selectedPrinter Impresora elegida y las unidades que la exponen.
+type selectedPrinter struct {
+	Unit    string  `json:"unit"`
+	Listen  string  `json:"listen"`
+	Printer printer `json:"printer"`
+}
+
+// commandResult Comando ejecutado (o que se ejecutaría con --dry-run) y su resultado.
+type commandResult struct {
+	Command []string `json:"command"`
+	Output  string   `json:"output,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// report Informe de la instalación en curso; nil salvo con --output json.
+var report *installReport
+
+// jsonStdout Salida estándar original, reservada para el informe JSON.
+var jsonStdout *os.File
+
+// startJSONOutput Activa el informe JSON. Los mensajes habituales se siguen
+// mostrando, pero por la salida de error, de modo que la salida estándar
+// solo contiene el documento JSON.
+func startJSONOutput(dryRun bool) {
+	report = &installReport{
+		DryRun:     dryRun,
+		Discovered: []printer{},
+		Selected:   []selectedPrinter{},
+		Files:      []string{},
+		Backups:    []string{},
+		Commands:   []commandResult{},
+	}
+	jsonStdout = os.Stdout
+	os.Stdout = os.Stderr
+}
+
+// recordDiscovered Anota las impresoras encontradas.
+func (r *installReport) recordDiscovered(printers []printer) {
+	if r == nil {
+		return
+	}
+	r.Discovered = append(r.Discovered, printers...)
+}
+
+// recordSelected Anota las impresoras que se van a instalar.
+func (r *installReport) recordSelected(list []installOptions) {
+	if r == nil {
+		return
+	}
+	for _, opts := range list {
+		r.Selected = append(r.Selected, selectedPrinter{
+			Unit:    opts.unitName(),
+			Listen:  opts.listenAddr(),
+			Printer: opts.Printer,
+		})
+	}
+}
+
+// recordFile Anota un archivo escrito.
+func (r *installReport) recordFile(path string) {
+	if r == nil {
+		return
+	}
+	r.Files = append(r.Files, path)
+}
+
+// recordBackup Anota la copia de seguridad de un archivo que se reemplazó.
+func (r *installReport) recordBackup(path string) {
+	if r == nil {
+		return
+	}
+	r.Backups = append(r.Backups, path)
+}
+
+// recordCommand Anota un comando y su resultado.
+func (r *installReport) recordCommand(cmdArgs []string, output string, err error) {
+	if r == nil {
+		return
+	}
+	res := commandResult{Command: cmdArgs, Output: output}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	r.Commands = append(r.Commands, res)
+}
+
+// emit Escribe el informe en la salida estándar original.
+func (r *installReport) emit() {
+	enc := json.NewEncoder(jsonStdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(r)
+}
+
+// failInstall Termina la instalación con un error. Con --output json el error
+// forma parte del informe; si no, se muestra como hasta ahora.
+func failInstall(err error, code int) {
+	if report == nil {
+		log.Printf("Error: %v", err)
+		os.Exit(code)
+	}
+	report.Error = err.Error()
+	report.ExitCode = code
+	report.emit()
+	os.Exit(code)
+}
+
+// finishInstall Emite el informe de una instalación correcta, si se pidió.
+func finishInstall() {
+	if report == nil {
+		return
+	}
+	report.Success = true
+	report.emit()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// hostIPv4s Devuelve las direcciones IPv4 de las interfaces activas, sin loopback.
+func hostIPv4s() ([]net.IP, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf(tr("error al listar las interfaces de red: %w"), err)
+	}
+
+	var ips []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+				ips = append(ips, ipnet.IP)
+			}
+		}
+	}
+	return ips, nil
+}
+
+// printerName Devuelve el nombre con el que se presenta la impresora a los clientes:
+// su etiqueta, su modelo, el nombre que da su descriptor USB o, si no se conoce
+// nada, el nombre del nodo (lp0).
+func printerName(p printer) string {
+	switch {
+	case p.Label != "":
+		return p.Label
+	case p.Caps != nil:
+		return p.Caps.Model
+	case p.usbName() != "":
+		return p.usbName()
+	default:
+		return filepath.Base(p.Path)
+	}
+}
+
+// installedPrinter Devuelve la impresora indicada por el usuario y su
+// instalación o, si no se indica ninguna, la única impresora instalada.
+func installedPrinter(name string) (printer, installation, error) {
+	if name != "" {
+		p, err := lookupPrinter(name)
+		if err != nil {
+			return printer{}, installation{}, err
+		}
+		inst, err := findInstallation(p.Path)
+		return p, inst, err
+	}
+
+	inst, err := findInstallation("")
+	if err != nil {
+		return printer{}, installation{}, err
+	}
+	if inst.Device == "" {
+		return printer{}, installation{}, fmt.Errorf(tr("el servicio %s no indica una impresora"), inst.Name)
+	}
+	if p, err := lookupPrinter(inst.Device); err == nil {
+		return p, inst, nil
+	}
+	// La impresora puede no estar conectada ahora mismo; se usa la ruta tal cual.
+	return printer{Path: inst.Device}, inst, nil
+}
+
+// pairingURL Construye el contenido del código QR de emparejamiento.
+func pairingURL(host string, port int, name, token string) string {
+	u := url.URL{
+		Scheme: "escpos",
+		Host:   net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:   "/" + name,
+	}
+	if token != "" {
+		u.RawQuery = url.Values{"token": {token}}.Encode()
+	}
+	return u.String()
+}
+
+// runPrintPairing Implementa el subcomando "print-pairing [impresora]", que
+// imprime un recibo con un código QR para dar de alta tabletas y terminales.
+func runPrintPairing(args []string) {
+	fs := flag.NewFlagSet("print-pairing", flag.ExitOnError)
+	token := fs.String("token", "", tr("token de API que se incluye en el código QR"))
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s print-pairing [--token TOKEN] [impresora]\n"), filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	p, inst, err := installedPrinter(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	port, err := inst.Port()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Si el socket escucha en una dirección concreta se anuncia esa;
+	// si escucha en todas se anuncia la primera IPv4 de la máquina.
+	host, _, _ := net.SplitHostPort(inst.Listen)
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		ips, err := hostIPv4s()
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if len(ips) == 0 {
+			log.Fatal(tr("Error: la máquina no tiene ninguna dirección IPv4 activa"))
+		}
+		host = ips[0].String()
+	}
+
+	name := printerName(p)
+	r := newReceipt().
+		align(alignCenter).
+		bold(true).size(2, 2).line("Emparejar impresora").size(1, 1).bold(false).
+		feed(1).
+		qr(pairingURL(host, port, name, *token), 8).
+		feed(1).
+		line(name).
+		line(fmt.Sprintf("%s:%d", host, port))
+	if *token != "" {
+		r.line("Incluye token de API")
+	}
+	r.feed(3).cut()
+
+	if err := writeToDevice(p.Path, r.Bytes()); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	logger.Info(fmt.Sprintf(tr("✓ Recibo de emparejamiento impreso en %s (%s:%d)\n"), p, host, port))
+}
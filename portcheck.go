@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// portOwner Describe quién escucha ya en un puerto: la unidad systemd, si se
+// conoce, y el proceso.
+type portOwner struct {
+	Unit    string // Unidad que escucha, por ejemplo p910nd.service o cups.socket
+	Process string // Proceso que escucha, por ejemplo "812 (p910nd)"
+}
+
+// String Devuelve la descripción del dueño del puerto que se muestra al usuario.
+func (o portOwner) String() string {
+	switch {
+	case o.Unit != "" && o.Process != "":
+		return o.Unit + " [" + o.Process + "]"
+	case o.Unit != "":
+		return o.Unit
+	case o.Process != "":
+		return o.Process
+	}
+	return tr("un programa desconocido")
+}
+
+// socketUnitForPort Devuelve la unidad .socket de systemd que escucha en el
+// puerto, según "systemctl list-sockets".
+func socketUnitForPort(port int) string {
+	out, err := systemctlCommand("list-sockets", "--all", "--no-legend", "--plain").Output()
+	if err != nil {
+		return ""
+	}
+	suffix := ":" + strconv.Itoa(port)
+	for _, line := range strings.Split(string(out), "\n") {
+		// 0.0.0.0:9100 escpos-printer.socket escpos-printer@0.service
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && strings.HasSuffix(fields[0], suffix) {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// listeningInodes Devuelve los inodos de los sockets que escuchan en el puerto.
+func listeningInodes(port int) map[string]bool {
+	inodes := make(map[string]bool)
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // Omite la cabecera
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 || fields[3] != "0A" { // 0A = TCP_LISTEN
+				continue
+			}
+			_, portHex, _ := strings.Cut(fields[1], ":")
+			if p, err := strconv.ParseUint(portHex, 16, 16); err == nil && int(p) == port {
+				inodes[fields[9]] = true
+			}
+		}
+		f.Close()
+	}
+	return inodes
+}
+
+// processForPort Busca el proceso que tiene abierto el socket que escucha en
+// el puerto y la unidad de servicio a la que pertenece según su cgroup.
+// Sin root solo se encuentran los procesos propios.
+func processForPort(port int) (process, unit string) {
+	inodes := listeningInodes(port)
+	if len(inodes) == 0 {
+		return "", ""
+	}
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		link, err := os.Readlink(fd)
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		if !inodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")] {
+			continue
+		}
+		pid := filepath.Base(filepath.Dir(filepath.Dir(fd)))
+		comm, _ := os.ReadFile(filepath.Join("/proc", pid, "comm"))
+		process = fmt.Sprintf("%s (%s)", pid, strings.TrimSpace(string(comm)))
+		// 0::/system.slice/p910nd.service
+		cgroup, _ := os.ReadFile(filepath.Join("/proc", pid, "cgroup"))
+		for _, line := range strings.Split(string(cgroup), "\n") {
+			if base := filepath.Base(line); strings.HasSuffix(base, ".service") {
+				unit = base
+			}
+		}
+		return process, unit
+	}
+	return "", ""
+}
+
+// findPortOwner Indica si algo escucha ya en el puerto y quién. Si lo hace un
+// socket de systemd el proceso es el propio systemd y solo interesa la unidad.
+func findPortOwner(port int) (portOwner, bool) {
+	listening := false
+	for _, p := range listeningTCPPorts() {
+		listening = listening || p == port
+	}
+	if !listening {
+		return portOwner{}, false
+	}
+	if unit := socketUnitForPort(port); unit != "" {
+		return portOwner{Unit: unit}, true
+	}
+	process, unit := processForPort(port)
+	return portOwner{Unit: unit, Process: process}, true
+}
+
+// nextFreePort Devuelve el primer puerto a partir de from en el que no escucha
+// nadie y que no está reservado para otra impresora de la instalación.
+func nextFreePort(from int, reserved map[int]bool) int {
+	listening := make(map[int]bool)
+	for _, p := range listeningTCPPorts() {
+		listening[p] = true
+	}
+	port := from
+	for port < 65535 && (listening[port] || reserved[port]) {
+		port++
+	}
+	return port
+}
+
+// portConflict Devuelve quién ocupa el puerto de la impresora, salvo que sea
+// su propio socket (una reinstalación).
+func portConflict(opts installOptions) (portOwner, bool) {
+	if !opts.listensTCP() {
+		return portOwner{}, false
+	}
+	owner, busy := findPortOwner(opts.Port)
+	if !busy || owner.Unit == opts.socketName()+".socket" {
+		return portOwner{}, false
+	}
+	return owner, true
+}
+
+// askPortConflicts Resuelve de forma interactiva los puertos ocupados: ofrece
+// deshabilitar el servicio que lo usa o, si no se quiere o no se puede, pasar
+// al siguiente puerto libre.
+func askPortConflicts(list []installOptions) {
+	reserved := make(map[int]bool)
+	for _, opts := range list {
+		reserved[opts.Port] = true
+	}
+	for i := range list {
+		owner, busy := portConflict(list[i])
+		if !busy || list[i].TakeOver {
+			continue
+		}
+		free := nextFreePort(list[i].Port+1, reserved)
+		fmt.Printf(tr("\nEl puerto %d ya está en uso por %s.\n"), list[i].Port, owner)
+		if owner.Unit != "" && askYesNo(fmt.Sprintf(tr("¿Detener y deshabilitar %s para usar el puerto %d?"), owner.Unit, list[i].Port), false) {
+			list[i].TakeOver = true
+			continue
+		}
+		fmt.Printf(tr("Se usará el puerto %d.\n"), free)
+		list[i].Port = free
+		reserved[free] = true
+	}
+}
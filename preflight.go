@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// deviceHolders Devuelve los procesos que tienen abierto el dispositivo, como
+// "1234 (java)", buscando en /proc/PID/fd. Sin root solo se ven los propios.
+func deviceHolders(path string) []string {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		target = path
+	}
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	seen := make(map[string]bool)
+	var holders []string
+	for _, fd := range fds {
+		if link, err := os.Readlink(fd); err != nil || link != target {
+			continue
+		}
+		pid := filepath.Base(filepath.Dir(filepath.Dir(fd)))
+		if seen[pid] {
+			continue
+		}
+		seen[pid] = true
+		comm, _ := os.ReadFile(filepath.Join("/proc", pid, "comm"))
+		holders = append(holders, fmt.Sprintf("%s (%s)", pid, strings.TrimSpace(string(comm))))
+	}
+	return holders
+}
+
+// preflightDevice Comprueba que el servicio podrá escribir en la impresora:
+// que el controlador usblp está cargado y que el nodo se puede abrir para
+// escritura sin que otro programa lo tenga tomado. Las impresoras que se
+// atienden a través de CUPS o de la red, y las que aún no están conectadas,
+// no se comprueban.
+func preflightDevice(opts installOptions) error {
+	p := opts.Printer
+	if opts.CUPSQueue != "" || p.Kind == kindNetwork || p.Absent {
+		return nil
+	}
+	if p.Kind == kindUSB {
+		if f := checkUSBLP(); f.Level != findingOK {
+			return fmt.Errorf("%s: %s", f.Detail, f.Fix)
+		}
+	}
+
+	// O_NONBLOCK evita que la apertura de un puerto serie espere a la
+	// portadora; usblp admite un solo proceso a la vez y responde EBUSY.
+	f, err := os.OpenFile(p.Path, os.O_WRONLY|syscall.O_NONBLOCK|syscall.O_NOCTTY, 0)
+	if err == nil {
+		return f.Close()
+	}
+	switch {
+	case errors.Is(err, syscall.EBUSY):
+		msg := fmt.Sprintf(tr("la impresora %s está ocupada por otro programa"), p.Path)
+		if holders := deviceHolders(p.Path); len(holders) > 0 {
+			msg += " (" + strings.Join(holders, ", ") + ")"
+		}
+		return errors.New(msg + tr("; suele ser un programa de punto de venta que usa libusb o CUPS con ipp-usb. Ciérralo o usa --cups si la impresora está en CUPS"))
+	case errors.Is(err, syscall.EACCES), errors.Is(err, syscall.EPERM):
+		// Con --user el servicio escribe con los permisos del usuario, que
+		// necesita pertenecer al grupo del nodo (lp en casi todas las distribuciones).
+		if g := deviceGroup(p.Path); userMode && g != "" {
+			return fmt.Errorf(tr("no se puede escribir en %s; agrega el usuario al grupo %s (usermod -aG %s USUARIO) y vuelve a iniciar sesión: %w"), p.Path, g, g, err)
+		}
+		return fmt.Errorf(tr("no se puede escribir en %s: %w"), p.Path, err)
+	case errors.Is(err, syscall.ENODEV), errors.Is(err, syscall.ENXIO), errors.Is(err, syscall.ENOENT):
+		return fmt.Errorf(tr("la impresora %s no responde; revisa el cable y que esté encendida: %w"), p.Path, err)
+	}
+	return fmt.Errorf(tr("error al abrir la impresora %s: %w"), p.Path, err)
+}
+
+// preflight Comprueba todas las impresoras antes de escribir las unidades,
+// para no dejar instalado un servicio que fallará con el primer trabajo.
+func preflight(list []installOptions) error {
+	for _, opts := range list {
+		if err := preflightDevice(opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
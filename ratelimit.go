@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// rateWindow Ventana en la que se cuentan las conexiones y los bytes de cada
+// cliente.
+const rateWindow = time.Minute
+
+// rateLimits Límites por IP de origen, para que un cliente que falla no
+// vacíe el rollo de papel enviando el mismo ticket sin parar. Cero desactiva
+// cada límite.
+type rateLimits struct {
+	Connections int   // Conexiones por minuto
+	Bytes       int64 // Bytes por minuto
+}
+
+// enabled Indica si hay algún límite.
+func (l rateLimits) enabled() bool {
+	return l.Connections > 0 || l.Bytes > 0
+}
+
+// checkRateLimits Rechaza los límites por minuto con una cola de CUPS: el
+// servicio entrega la conexión a lp y no pasa por relay, que es quien los
+// aplica. Rechaza también los de conexiones simultáneas en el modo daemon:
+// systemd solo los aplica con Accept=yes y se perderían sin avisar.
+func checkRateLimits(opts installOptions) error {
+	switch {
+	case opts.CUPSQueue != "" && (opts.ConnectionsPerMinute > 0 || opts.BytesPerMinute > 0):
+		return fmt.Errorf(tr("%s: los límites por minuto no admiten colas de CUPS"), opts.Printer.Path)
+	case opts.Daemon && (opts.MaxConnections > 0 || opts.MaxConnectionsPerSource > 0):
+		return fmt.Errorf(tr("%s: los límites de conexiones simultáneas no se aplican en el modo daemon"), opts.Printer.Path)
+	}
+	return nil
+}
+
+// rateFlags Devuelve las opciones de límites de relay y serve.
+func rateFlags(opts installOptions) string {
+	var flags string
+	if opts.ConnectionsPerMinute > 0 {
+		flags += " --max-connections-per-minute " + strconv.Itoa(opts.ConnectionsPerMinute)
+	}
+	if opts.BytesPerMinute > 0 {
+		flags += " --max-bytes-per-minute " + strconv.FormatInt(opts.BytesPerMinute, 10)
+	}
+	return flags
+}
+
+// rateDirectives Devuelve el directorio en el que los procesos de relay, lpd
+// o ipp, uno por conexión, comparten las cuentas de cada cliente. Se conserva
+// entre conexiones; el modo daemon y la API HTTP las llevan en memoria. Las
+// unidades RAW, LPD e IPP de una impresora usan el mismo directorio, así que
+// un cliente tiene el mismo límite por todos los protocolos. ipp guarda
+// además en él el contador de trabajos, así que lo tiene siempre.
+func rateDirectives(opts installOptions) string {
+	limits := opts.ConnectionsPerMinute > 0 || opts.BytesPerMinute > 0
+	if opts.Daemon || opts.CUPSQueue != "" || (!limits && opts.Frontend != frontendIPP) {
+		return ""
+	}
+	return "RuntimeDirectory=escpos-printer/" + opts.unitName() + "\nRuntimeDirectoryPreserve=yes\n"
+}
+
+// rateEvent Conexión o trabajo de un cliente dentro de la ventana.
+type rateEvent struct {
+	At    time.Time
+	Conn  bool  // Una conexión nueva
+	Bytes int64 // Bytes de un trabajo terminado
+}
+
+// rateLimiter Lleva las cuentas de cada cliente. Con dir las cuentas están
+// en un archivo por cliente, bloqueado con flock mientras se actualiza, para
+// compartirlas entre los procesos de relay; sin dir están en memoria.
+type rateLimiter struct {
+	limits rateLimits
+	dir    string
+
+	mu     sync.Mutex
+	events map[string][]rateEvent
+}
+
+// newRateLimiter Crea el limitador, o nil si no hay límites.
+func newRateLimiter(limits rateLimits, dir string) *rateLimiter {
+	if !limits.enabled() {
+		return nil
+	}
+	return &rateLimiter{limits: limits, dir: dir, events: make(map[string][]rateEvent)}
+}
+
+// rateServerFlags Añade las opciones de límites a relay o serve y devuelve la
+// función que crea el limitador después de fs.Parse; nil sin límites.
+func rateServerFlags(fs *flag.FlagSet) func(dir string) *rateLimiter {
+	conns := fs.Int("max-connections-per-minute", 0, tr("conexiones por minuto admitidas desde una misma IP (0 sin límite)"))
+	bytes := fs.Int64("max-bytes-per-minute", 0, tr("bytes por minuto admitidos desde una misma IP; corta el trabajo que los supera (0 sin límite)"))
+	return func(dir string) *rateLimiter {
+		return newRateLimiter(rateLimits{Connections: *conns, Bytes: *bytes}, dir)
+	}
+}
+
+// rateClient Devuelve el cliente al que se atribuye la conexión: su IP, sin
+// el puerto, o "unix" para los sockets Unix.
+func rateClient(addr net.Addr) string {
+	if addr == nil || addr.Network() == "unix" {
+		return "unix"
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// update Aplica fn a las cuentas vigentes del cliente y guarda el resultado.
+func (l *rateLimiter) update(client string, fn func([]rateEvent) []rateEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.dir == "" {
+		l.events[client] = fn(pruneRateEvents(l.events[client]))
+		if len(l.events[client]) == 0 {
+			delete(l.events, client)
+		}
+		return nil
+	}
+
+	f, err := os.OpenFile(filepath.Join(l.dir, client), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf(tr("error al abrir las cuentas de %s: %w"), client, err)
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf(tr("error al bloquear las cuentas de %s: %w"), client, err)
+	}
+	events := pruneRateEvents(readRateEvents(f))
+	events = fn(events)
+	var b strings.Builder
+	for _, e := range events {
+		kind := "b"
+		if e.Conn {
+			kind = "c"
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", kind, e.At.UnixNano(), e.Bytes)
+	}
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf(tr("error al guardar las cuentas de %s: %w"), client, err)
+	}
+	if _, err := f.WriteAt([]byte(b.String()), 0); err != nil {
+		return fmt.Errorf(tr("error al guardar las cuentas de %s: %w"), client, err)
+	}
+	return nil
+}
+
+// readRateEvents Lee las cuentas guardadas: una línea "c|b NANOSEGUNDOS BYTES"
+// por suceso.
+func readRateEvents(r io.Reader) []rateEvent {
+	var events []rateEvent
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		at, err1 := strconv.ParseInt(fields[1], 10, 64)
+		n, err2 := strconv.ParseInt(fields[2], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		events = append(events, rateEvent{At: time.Unix(0, at), Conn: fields[0] == "c", Bytes: n})
+	}
+	return events
+}
+
+// pruneRateEvents Quita los sucesos que ya salieron de la ventana.
+func pruneRateEvents(events []rateEvent) []rateEvent {
+	cutoff := time.Now().Add(-rateWindow)
+	kept := events[:0]
+	for _, e := range events {
+		if e.At.After(cutoff) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// usage Devuelve las conexiones y los bytes del cliente dentro de la ventana.
+func usage(events []rateEvent) (conns int, bytes int64) {
+	for _, e := range events {
+		if e.Conn {
+			conns++
+		}
+		bytes += e.Bytes
+	}
+	return conns, bytes
+}
+
+// admit Anota una conexión nueva del cliente, o la rechaza si ya llegó a
+// alguno de los límites. Si las cuentas no se pueden leer la conexión se
+// admite: es preferible imprimir de más que dejar la caja sin tickets.
+func (l *rateLimiter) admit(client string) error {
+	var refused error
+	err := l.update(client, func(events []rateEvent) []rateEvent {
+		conns, bytes := usage(events)
+		switch {
+		case l.limits.Connections > 0 && conns >= l.limits.Connections:
+			refused = fmt.Errorf(tr("%s superó el límite de %d conexiones por minuto"), client, l.limits.Connections)
+		case l.limits.Bytes > 0 && bytes >= l.limits.Bytes:
+			refused = fmt.Errorf(tr("%s superó el límite de %d bytes por minuto"), client, l.limits.Bytes)
+		default:
+			events = append(events, rateEvent{At: time.Now(), Conn: true})
+		}
+		return events
+	})
+	if err != nil {
+		logger.Warn(fmt.Sprintf("⚠ %v", err), "client", client)
+		return nil
+	}
+	return refused
+}
+
+// limit Envuelve la entrada del trabajo para cortarlo cuando el cliente
+// agote los bytes que le quedan en la ventana. Se calcula al empezar a
+// imprimir, no al conectar, porque en el modo daemon el trabajo puede haber
+// esperado su turno detrás de otros del mismo cliente.
+func (l *rateLimiter) limit(in io.Reader, client string) io.Reader {
+	if l.limits.Bytes == 0 {
+		return in
+	}
+	left := l.limits.Bytes
+	if err := l.update(client, func(events []rateEvent) []rateEvent {
+		_, bytes := usage(events)
+		left -= bytes
+		return events
+	}); err != nil {
+		logger.Warn(fmt.Sprintf("⚠ %v", err), "client", client)
+		return in
+	}
+	return &budgetReader{r: in, left: left, client: client, limit: l.limits.Bytes}
+}
+
+// record Anota los bytes de un trabajo terminado.
+func (l *rateLimiter) record(client string, n int64) {
+	if n == 0 {
+		return
+	}
+	if err := l.update(client, func(events []rateEvent) []rateEvent {
+		return append(events, rateEvent{At: time.Now(), Bytes: n})
+	}); err != nil {
+		logger.Warn(fmt.Sprintf("⚠ %v", err), "client", client)
+	}
+}
+
+// budgetReader Corta el trabajo cuando el cliente agota los bytes que le
+// quedan en la ventana.
+type budgetReader struct {
+	r      io.Reader
+	left   int64
+	client string
+	limit  int64
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		// Un trabajo que ocupa justo lo que quedaba termina bien.
+		var one [1]byte
+		if n, err := b.r.Read(one[:]); n == 0 {
+			return 0, err
+		}
+		return 0, fmt.Errorf(tr("%s superó el límite de %d bytes por minuto; se corta el trabajo"), b.client, b.limit)
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.r.Read(p)
+	b.left -= int64(n)
+	return n, err
+}
+
+// limitListener Aplica los límites de cada cliente a las conexiones de un
+// servidor de un solo proceso, como la API HTTP: con Accept=no systemd no
+// aplica MaxConnections= ni MaxConnectionsPerSource=.
+type limitListener struct {
+	net.Listener
+	limiter   *rateLimiter // Conexiones por minuto, nil sin límite
+	max       int          // Conexiones simultáneas, 0 sin límite
+	perSource int          // Conexiones simultáneas desde una misma IP, 0 sin límite
+
+	mu    sync.Mutex
+	open  map[string]int // Conexiones abiertas de cada cliente
+	total int
+}
+
+// connectionServerFlags Añade a http las opciones de conexiones simultáneas
+// y devuelve la función que envuelve el socket después de fs.Parse; sin
+// límites lo devuelve tal cual. Los bytes por minuto se aplican a cada
+// trabajo y no a la conexión, que también lleva las cabeceras HTTP.
+func connectionServerFlags(fs *flag.FlagSet) func(ln net.Listener, limiter *rateLimiter) net.Listener {
+	max := fs.Int("max-connections", 0, tr("conexiones simultáneas admitidas (0 sin límite)"))
+	perSource := fs.Int("max-connections-per-source", 0, tr("conexiones simultáneas admitidas desde una misma IP (0 sin límite)"))
+	return func(ln net.Listener, limiter *rateLimiter) net.Listener {
+		if limiter == nil && *max == 0 && *perSource == 0 {
+			return ln
+		}
+		return &limitListener{Listener: ln, limiter: limiter, max: *max, perSource: *perSource, open: make(map[string]int)}
+	}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		client := rateClient(conn.RemoteAddr())
+		if err := l.admit(client); err != nil {
+			logger.Warn(fmt.Sprintf(tr("Conexión rechazada: %v"), err), "client", client)
+			conn.Close()
+			continue
+		}
+		return &limitConn{Conn: conn, listener: l, client: client}, nil
+	}
+}
+
+// admit Anota una conexión nueva del cliente, o la rechaza si ya llegó a
+// alguno de los límites.
+func (l *limitListener) admit(client string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case l.max > 0 && l.total >= l.max:
+		return fmt.Errorf(tr("se alcanzó el límite de %d conexiones simultáneas"), l.max)
+	case l.perSource > 0 && l.open[client] >= l.perSource:
+		return fmt.Errorf(tr("%s superó el límite de %d conexiones simultáneas"), client, l.perSource)
+	}
+	if l.limiter != nil {
+		if err := l.limiter.admit(client); err != nil {
+			return err
+		}
+	}
+	l.total++
+	l.open[client]++
+	return nil
+}
+
+// limitConn Conexión admitida por limitListener, que libera su plaza al
+// cerrarse.
+type limitConn struct {
+	net.Conn
+	listener *limitListener
+	client   string
+	once     sync.Once
+}
+
+func (c *limitConn) Close() error {
+	c.once.Do(func() {
+		l := c.listener
+		l.mu.Lock()
+		l.total--
+		if l.open[c.client]--; l.open[c.client] == 0 {
+			delete(l.open, c.client)
+		}
+		l.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
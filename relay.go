@@ -0,0 +1,332 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// defaultWriteTimeout Tiempo máximo que se espera a que la impresora acepte
+// más datos. Sin papel o con la tapa abierta las TM dejan de leer y la
+// escritura quedaría bloqueada para siempre.
+const defaultWriteTimeout = 30 * time.Second
+
+// Plazos por defecto de cada conexión. Un cliente que deja de enviar datos o
+// un trabajo que no termina liberan la impresora en lugar de retenerla.
+const (
+	defaultIdleTimeout = 90 * time.Second
+	defaultJobTimeout  = 10 * time.Minute
+)
+
+// relayExecStart Devuelve el comando con el que el servicio entrega cada
+// conexión a la impresora: este mismo programa con el subcomando "relay".
+func relayExecStart(opts installOptions) string {
+	if opts.Printer.Kind == kindNetwork {
+		return installedBinaryPath + " relay --to " + opts.Printer.Path + timeoutFlags(opts) + tlsFlags(opts) + rateFlags(opts) + archiveFlags(opts)
+	}
+	return installedBinaryPath + " relay --device " + opts.devicePath() + timeoutFlags(opts) + tlsFlags(opts) + rateFlags(opts) + archiveFlags(opts) + usbResetFlags(opts)
+}
+
+// timeoutFlags Devuelve las opciones de plazos de relay y serve que difieren
+// de los valores por defecto.
+func timeoutFlags(opts installOptions) string {
+	var flags string
+	if opts.IdleTimeout > 0 {
+		flags += " --idle-timeout " + opts.IdleTimeout.String()
+	}
+	if opts.JobTimeout > 0 {
+		flags += " --job-timeout " + opts.JobTimeout.String()
+	}
+	return flags
+}
+
+// jobTimeouts Plazos de una conexión: sin recibir datos (Idle) y en total
+// (Total). Cero desactiva el plazo.
+type jobTimeouts struct {
+	Idle  time.Duration
+	Total time.Duration
+}
+
+// readDeadliner Conexión de la que se lee con plazo: net.Conn o *os.File.
+type readDeadliner interface {
+	io.Reader
+	SetReadDeadline(time.Time) error
+}
+
+// timeoutReader Lee de la conexión aplicando los plazos del trabajo.
+type timeoutReader struct {
+	r     readDeadliner
+	t     jobTimeouts
+	start time.Time
+}
+
+// withTimeouts Devuelve un lector que termina el trabajo cuando el cliente deja
+// de enviar datos y falla cuando se supera la duración máxima.
+func withTimeouts(r readDeadliner, t jobTimeouts) io.Reader {
+	return &timeoutReader{r: r, t: t, start: time.Now()}
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	var deadline time.Time
+	if r.t.Idle > 0 {
+		deadline = time.Now().Add(r.t.Idle)
+	}
+	if r.t.Total > 0 {
+		if end := r.start.Add(r.t.Total); deadline.IsZero() || end.Before(deadline) {
+			deadline = end
+		}
+	}
+	r.r.SetReadDeadline(deadline)
+	n, err := r.r.Read(p)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		if r.t.Total > 0 && !time.Now().Before(r.start.Add(r.t.Total)) {
+			return n, fmt.Errorf(tr("el trabajo superó el tiempo máximo de %s"), r.t.Total)
+		}
+		// Muchos clientes dejan la conexión abierta después de enviar el
+		// ticket; como hacen las impresoras de red, el silencio termina el
+		// trabajo en lugar de ser un error.
+		logger.Warn(fmt.Sprintf(tr("El cliente no envió datos en %s; se da por terminado el trabajo"), r.t.Idle))
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// stdinConn Devuelve la conexión que systemd pasa como entrada estándar
+// (StandardInput=socket). Como net.Conn admite plazos de lectura; si la
+// entrada no es un socket (al probar a mano con una tubería) se usa tal cual.
+func stdinConn() readDeadliner {
+	if conn, err := net.FileConn(os.Stdin); err == nil {
+		return conn
+	}
+	return os.Stdin
+}
+
+// resetConn Hace que al cerrar la conexión se envíe un RST en lugar de un
+// FIN. Un FIN parece un trabajo entregado; con el RST el programa de punto de
+// venta ve un error de conexión y puede reintentar o avisar. En relay basta
+// con llamarla antes de salir: la conexión se cierra al terminar el proceso.
+func resetConn(conn net.Conn) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+}
+
+// deviceBusyWait Tiempo mínimo que se reintenta abrir un nodo ocupado. usblp
+// y lp solo admiten una apertura, y "status" abre el nodo para preguntarle su
+// estado a la impresora; la espera cubre las cuatro preguntas de DLE EOT para
+// que un trabajo que llega en ese momento no falle.
+const deviceBusyWait = 4*dleEOTTimeout + time.Second
+
+// openPrinterDevice Abre el nodo de la impresora para escribir, esperando si
+// otro proceso lo tiene abierto. Las unidades RAW, LPD, IPP y HTTP de una
+// impresora escriben en el mismo nodo, así que la espera dura lo que puede
+// durar el trabajo de otra (jobTimeout), y sin límite si es cero.
+func openPrinterDevice(path string, jobTimeout time.Duration) (*os.File, error) {
+	deadline := time.Now().Add(max(jobTimeout, deviceBusyWait))
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if !errors.Is(err, syscall.EBUSY) || (jobTimeout > 0 && time.Now().After(deadline)) {
+			return f, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// printerHungError La impresora dejó de aceptar datos durante el plazo de
+// escritura.
+type printerHungError struct {
+	path    string
+	timeout time.Duration
+}
+
+func (e *printerHungError) Error() string {
+	return fmt.Sprintf(tr("la impresora %s no aceptó datos en %s; revisa el papel y la tapa"), e.path, e.timeout)
+}
+
+// relayDevice Copia el trabajo de la entrada al nodo de la impresora y
+// devuelve los bytes escritos. A diferencia del antiguo "tee", un error de
+// escritura o una impresora que deja de aceptar datos terminan el trabajo
+// con un error que queda en el registro. jobTimeout es la duración máxima de
+// un trabajo, que limita la espera si otro tiene el nodo abierto.
+func relayDevice(in io.Reader, path string, timeout, jobTimeout time.Duration) (int64, error) {
+	f, err := openPrinterDevice(path, jobTimeout)
+	if err != nil {
+		return 0, fmt.Errorf(tr("error al abrir la impresora %s: %w"), path, err)
+	}
+
+	var total int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := in.Read(buf)
+		if n > 0 {
+			// usblp y los puertos serie admiten poll, así que el plazo de
+			// escritura funciona; si el nodo no lo admite se escribe sin plazo.
+			f.SetWriteDeadline(time.Now().Add(timeout))
+			written, err := f.Write(buf[:n])
+			total += int64(written)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				f.Close()
+				return total, &printerHungError{path, timeout}
+			}
+			if err != nil {
+				f.Close()
+				return total, fmt.Errorf(tr("error al escribir en la impresora %s: %w"), path, err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			f.Close()
+			return total, fmt.Errorf(tr("error al leer el trabajo: %w"), readErr)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return total, fmt.Errorf(tr("error al cerrar la impresora %s: %w"), path, err)
+	}
+	return total, nil
+}
+
+// jobDelivery Entrega a la impresora los trabajos de lpd, ipp y http con el
+// archivo y el reinicio del puerto USB de relay.
+type jobDelivery struct {
+	device, to  string
+	timeout     time.Duration
+	jobTimeout  time.Duration
+	archive     *jobArchive
+	recoverHung func(device string, err error)
+}
+
+// deliveryServerFlags Añade a lpd, ipp o http las opciones del archivo y del
+// reinicio del puerto USB y devuelve la función que crea la entrega después
+// de fs.Parse.
+func deliveryServerFlags(fs *flag.FlagSet) func(device, to string, timeout, jobTimeout time.Duration) jobDelivery {
+	newArchive := archiveServerFlags(fs)
+	recoverHung := usbResetServerFlags(fs)
+	return func(device, to string, timeout, jobTimeout time.Duration) jobDelivery {
+		return jobDelivery{device: device, to: to, timeout: timeout, jobTimeout: jobTimeout, archive: newArchive(), recoverHung: recoverHung}
+	}
+}
+
+// deliver Imprime un trabajo de client y devuelve los bytes que aceptó la
+// impresora.
+func (d jobDelivery) deliver(in io.Reader, client string) (int64, error) {
+	target := d.device
+	if d.to != "" {
+		target = d.to
+	}
+	if d.archive != nil {
+		in = d.archive.capture(newJobRecord(client, target), in)
+	}
+	var n int64
+	var err error
+	if d.to != "" {
+		n, err = relayNetwork(in, d.to)
+	} else {
+		n, err = relayDevice(in, d.device, d.timeout, d.jobTimeout)
+		d.recoverHung(d.device, err)
+	}
+	finishArchive(in, n, err)
+	return n, err
+}
+
+// runRelay Implementa el subcomando "relay", que ejecuta el servicio de cada
+// impresora: lee el trabajo de la conexión entrante (la entrada estándar) y lo
+// escribe en el dispositivo o lo reenvía a la impresora de red. La conexión
+// sigue abierta hasta que la impresora aceptó todo el trabajo y, si falla, se
+// corta con un RST para que el cliente no lo dé por impreso.
+func runRelay(args []string) {
+	fs := flag.NewFlagSet("relay", flag.ExitOnError)
+	device := fs.String("device", "", tr("nodo de la impresora, por ejemplo /dev/usb/lp0"))
+	to := fs.String("to", "", tr("dirección HOST:PUERTO de la impresora"))
+	timeout := fs.Duration("timeout", defaultWriteTimeout, tr("tiempo máximo de espera a que la impresora acepte datos"))
+	idle := fs.Duration("idle-timeout", defaultIdleTimeout, tr("tiempo máximo sin recibir datos del cliente (0 sin límite)"))
+	total := fs.Duration("job-timeout", defaultJobTimeout, tr("duración máxima de un trabajo (0 sin límite)"))
+	loadTLS := tlsServerFlags(fs)
+	newLimiter := rateServerFlags(fs)
+	newArchive := archiveServerFlags(fs)
+	recoverHung := usbResetServerFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s relay --device NODO | --to HOST:PUERTO\n"), filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if (*device == "") == (*to == "") {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	tlsConfig, err := loadTLS()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	conn := stdinConn()
+	target := *device
+	if *to != "" {
+		target = *to
+	}
+	remote := "stdin"
+	if nc, ok := conn.(net.Conn); ok {
+		remote = nc.RemoteAddr().String()
+	}
+	job := newJobRecord(remote, target)
+	// Cada conexión es un proceso: las cuentas de los clientes se comparten
+	// en el directorio de ejecución del servicio (RuntimeDirectory=).
+	limiter := newLimiter(os.Getenv("RUNTIME_DIRECTORY"))
+	client := ""
+	if nc, ok := conn.(net.Conn); ok && limiter != nil {
+		client = rateClient(nc.RemoteAddr())
+		if err := limiter.admit(client); err != nil {
+			logger.Warn(fmt.Sprintf(tr("Conexión rechazada: %v"), err), "client", client)
+			return
+		}
+	}
+	if tlsConfig != nil {
+		nc, ok := conn.(net.Conn)
+		if !ok {
+			log.Fatal(tr("Error: TLS necesita que la entrada estándar sea un socket"))
+		}
+		tc := tls.Server(nc, tlsConfig)
+		if err := handshakeTLS(tc); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		conn = tc
+	}
+	in := withTimeouts(conn, jobTimeouts{Idle: *idle, Total: *total})
+	if client != "" {
+		in = limiter.limit(in, client)
+	}
+	if archive := newArchive(); archive != nil {
+		in = archive.capture(job, in)
+	}
+	var n int64
+	if *to != "" {
+		n, err = relayNetwork(in, *to)
+	} else {
+		n, err = relayDevice(in, *device, *timeout, *total)
+		recoverHung(*device, err)
+	}
+	finishArchive(in, n, err)
+	if client != "" {
+		limiter.record(client, n)
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: %v", err), job.attrs(n, err)...)
+		if nc, ok := conn.(net.Conn); ok {
+			resetConn(nc)
+		}
+		os.Exit(1)
+	}
+	logger.Info(fmt.Sprintf(tr("Trabajo de %d bytes enviado a %s"), n, target), job.attrs(n, nil)...)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// selinuxModule Nombre del módulo de política que instala el programa.
+const selinuxModule = "escpos_printer"
+
+// selinuxModulePath Módulo de política en CIL, que semodule carga sin
+// necesidad de compilarlo con checkmodule ni de instalar selinux-policy-devel.
+const selinuxModulePath = "/etc/escpos-printer/selinux/" + selinuxModule + ".cil"
+
+// selinuxEnforceFile Vale "1" si SELinux está en modo enforcing.
+const selinuxEnforceFile = "/sys/fs/selinux/enforce"
+
+// selinuxDeviceTypes Tipos de los nodos en los que escriben los servicios:
+// las impresoras USB (usblp), los puertos serie y los adaptadores USB a serie.
+var selinuxDeviceTypes = []string{"printer_device_t", "tty_device_t", "usbtty_device_t"}
+
+// selinuxEnforcing Indica si SELinux está en modo enforcing. En modo
+// permissive las denegaciones solo se registran y no hace falta el módulo.
+func selinuxEnforcing() bool {
+	data, err := os.ReadFile(selinuxEnforceFile)
+	return err == nil && strings.TrimSpace(string(data)) == "1"
+}
+
+// selinuxModuleContent Devuelve el módulo de política. El programa copiado a
+// installedBinaryPath puede conservar la etiqueta del directorio en el que se
+// descargó (user_home_t, user_tmp_t...), y systemd lo ejecutaría entonces en
+// un dominio que no puede escribir en la impresora. El módulo le da un tipo
+// propio, del que systemd pasa al dominio habitual de los servicios, y le
+// permite usar los nodos de las impresoras.
+func selinuxModuleContent() string {
+	var b strings.Builder
+	b.WriteString("; Módulo de SELinux de escpos-socket-install; se quita al desinstalar.\n")
+	b.WriteString("(type escpos_printer_exec_t)\n")
+	b.WriteString("(roletype object_r escpos_printer_exec_t)\n")
+	b.WriteString("(typeattributeset exec_type (escpos_printer_exec_t))\n")
+	b.WriteString("(typeattributeset file_type (escpos_printer_exec_t))\n")
+	b.WriteString("(allow init_t escpos_printer_exec_t (file (getattr open read execute map)))\n")
+	b.WriteString("(allow init_t unconfined_service_t (process (transition)))\n")
+	b.WriteString("(typetransition init_t escpos_printer_exec_t process unconfined_service_t)\n")
+	b.WriteString("(allow unconfined_service_t escpos_printer_exec_t (file (entrypoint getattr open read execute execute_no_trans map)))\n")
+	for _, t := range selinuxDeviceTypes {
+		fmt.Fprintf(&b, "(allow unconfined_service_t %s (chr_file (getattr open read write ioctl lock)))\n", t)
+	}
+	fmt.Fprintf(&b, "(filecon %q file (system_u object_r escpos_printer_exec_t ((s0) (s0))))\n", installedBinaryPath)
+	return b.String()
+}
+
+// selinuxCommands Devuelve los comandos que cargan el módulo y reetiquetan el
+// programa y los nodos de las impresoras con los contextos de la política.
+// El programa se reetiqueta siempre, porque se vuelve a copiar en cada
+// instalación; un nodo creado a mano con mknod también puede tener una
+// etiqueta equivocada.
+func selinuxCommands(list []installOptions) []plannedCommand {
+	cmds := []plannedCommand{
+		{[]string{"semodule", "-i", selinuxModulePath}, []string{selinuxModulePath}},
+		{[]string{"restorecon", "-F", installedBinaryPath}, nil},
+	}
+	for _, opts := range list {
+		if opts.CUPSQueue != "" || opts.Printer.Kind == kindNetwork || opts.Printer.Absent {
+			continue
+		}
+		if target, err := filepath.EvalSymlinks(opts.Printer.Path); err == nil {
+			cmds = append(cmds, plannedCommand{[]string{"restorecon", "-F", target}, nil})
+		}
+	}
+	return cmds
+}
+
+// selinuxPlan Indica si la instalación debe cargar el módulo. Sin las
+// herramientas de policycoreutils solo se avisa: el socket se instala, pero
+// es probable que SELinux bloquee los trabajos.
+func selinuxPlan() bool {
+	if userMode || !selinuxEnforcing() {
+		return false
+	}
+	for _, tool := range []string{"semodule", "restorecon"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			logger.Warn(fmt.Sprintf(tr("⚠ SELinux está en modo enforcing pero no se encontró %s (policycoreutils); es probable que bloquee la impresión"), tool))
+			return false
+		}
+	}
+	return true
+}
+
+// selinuxUninstallCommands Devuelve el comando que quita el módulo, si la
+// instalación lo cargó.
+func selinuxUninstallCommands() [][]string {
+	if _, err := os.Stat(selinuxModulePath); err != nil {
+		return nil
+	}
+	return [][]string{{"semodule", "-r", selinuxModule}}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultBaud Velocidad por defecto de las impresoras serie Epson TM.
+const defaultBaud = 9600
+
+// serialSettings Configuración de la línea de una impresora serie (RS-232).
+// Siempre se usan 8 bits de datos y 1 bit de parada, como en todas las TM.
+type serialSettings struct {
+	Baud        int    `yaml:"baud" json:"baud"`
+	Parity      string `yaml:"parity" json:"parity"`             // none, even u odd
+	FlowControl string `yaml:"flow_control" json:"flow_control"` // none, rtscts o xonxoff
+}
+
+// serialBauds Velocidades que admiten las impresoras serie.
+var serialBauds = []int{1200, 2400, 4800, 9600, 19200, 38400, 57600, 115200}
+
+// validate Comprueba la configuración y completa los valores por defecto.
+func (s *serialSettings) validate() error {
+	if s.Baud == 0 {
+		s.Baud = defaultBaud
+	}
+	if s.Parity == "" {
+		s.Parity = "none"
+	}
+	if s.FlowControl == "" {
+		s.FlowControl = "none"
+	}
+	valid := false
+	for _, b := range serialBauds {
+		valid = valid || b == s.Baud
+	}
+	if !valid {
+		return fmt.Errorf(tr("velocidad inválida %d"), s.Baud)
+	}
+	switch s.Parity {
+	case "none", "even", "odd":
+	default:
+		return fmt.Errorf(tr("paridad inválida %q (none, even u odd)"), s.Parity)
+	}
+	switch s.FlowControl {
+	case "none", "rtscts", "xonxoff":
+	default:
+		return fmt.Errorf(tr("control de flujo inválido %q (none, rtscts o xonxoff)"), s.FlowControl)
+	}
+	return nil
+}
+
+// sttyArgs Devuelve los argumentos de stty que configuran la línea en modo
+// crudo, sin eco ni traducción de saltos de línea, para que los comandos
+// ESC/POS lleguen tal cual a la impresora.
+func (s serialSettings) sttyArgs(path string) string {
+	args := []string{"-F", path, strconv.Itoa(s.Baud), "cs8", "-cstopb", "raw", "-echo"}
+	switch s.Parity {
+	case "even":
+		args = append(args, "parenb", "-parodd")
+	case "odd":
+		args = append(args, "parenb", "parodd")
+	default:
+		args = append(args, "-parenb")
+	}
+	switch s.FlowControl {
+	case "rtscts":
+		args = append(args, "crtscts", "-ixon", "-ixoff")
+	case "xonxoff":
+		args = append(args, "-crtscts", "ixon", "ixoff")
+	default:
+		args = append(args, "-crtscts", "-ixon", "-ixoff")
+	}
+	return strings.Join(args, " ")
+}
+
+// String Devuelve la configuración en la notación habitual, por ejemplo "9600 8N1 rtscts".
+func (s serialSettings) String() string {
+	return fmt.Sprintf("%d 8%s1 %s", s.Baud, strings.ToUpper(s.Parity[:1]), s.FlowControl)
+}
+
+// findSerialPorts Busca puertos serie en los que puede haber una impresora:
+// adaptadores USB-serie (/dev/ttyUSB*) y puertos de la placa (/dev/ttyS*).
+// De los ttyS solo se devuelven los que tienen un UART real; el kernel crea
+// varios aunque la máquina no tenga puertos físicos.
+func findSerialPorts() []printer {
+	var ports []printer
+	for _, pattern := range []string{"/dev/ttyUSB*", "/dev/ttyS*"} {
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+				continue
+			}
+			sys := filepath.Join("/sys/class/tty", filepath.Base(match))
+			if strings.HasPrefix(filepath.Base(match), "ttyS") && readSysfsAttr(sys, "type") == "0" {
+				continue // PORT_UNKNOWN: no hay hardware detrás
+			}
+			ports = append(ports, printer{Path: match, Kind: kindSerial})
+		}
+	}
+	return ports
+}
+
+// serialSetup Devuelve la línea ExecStartPre= que configura el puerto serie
+// antes de cada conexión, o nada si la impresora no es serie.
+func serialSetup(opts installOptions) string {
+	if opts.Serial == nil {
+		return ""
+	}
+	return "ExecStartPre=/bin/stty " + opts.Serial.sttyArgs(opts.devicePath()) + "\n"
+}
+
+// defaultSerial Devuelve la configuración por defecto para una impresora
+// serie, o nil si no lo es.
+func defaultSerial(p printer) *serialSettings {
+	if p.Kind != kindSerial {
+		return nil
+	}
+	s := serialSettings{}
+	s.validate()
+	return &s
+}
+
+// askSerialSettings Pregunta la configuración de la línea serie. Enter
+// conserva el valor propuesto.
+func askSerialSettings(p printer, def serialSettings) serialSettings {
+	fmt.Printf(tr("La impresora %s es serie; indica la configuración de la línea.\n"), p.Path)
+	s := def
+	for {
+		fmt.Printf(tr("Velocidad [%d]: "), def.Baud)
+		if answer, err := readLine(); err == nil && answer != "" {
+			s.Baud, _ = strconv.Atoi(answer)
+		}
+		fmt.Printf(tr("Paridad (none, even, odd) [%s]: "), def.Parity)
+		if answer, err := readLine(); err == nil && answer != "" {
+			s.Parity = strings.ToLower(answer)
+		}
+		fmt.Printf(tr("Control de flujo (none, rtscts, xonxoff) [%s]: "), def.FlowControl)
+		if answer, err := readLine(); err == nil && answer != "" {
+			s.FlowControl = strings.ToLower(answer)
+		}
+		if err := s.validate(); err != nil {
+			fmt.Println(err)
+			s = def
+			continue
+		}
+		return s
+	}
+}
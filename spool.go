@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Límites por defecto de la cola de trabajos pendientes.
+const (
+	defaultSpoolMaxJobs = 100
+	defaultSpoolMaxAge  = 24 * time.Hour
+)
+
+// spoolRetryInterval Espera entre dos intentos de imprimir el primer trabajo
+// de la cola mientras la impresora no está disponible.
+const spoolRetryInterval = 5 * time.Second
+
+// spoolSettings Cola en disco del modo daemon: los trabajos se guardan antes
+// de imprimirse y, si la impresora está apagada o sin papel, esperan en
+// orden a que vuelva en lugar de perderse. Solo el modo daemon tiene cola: con
+// Accept=yes cada conexión es un proceso que termina con el trabajo y nadie
+// volvería a intentarlo.
+type spoolSettings struct {
+	Dir     string        `yaml:"dir"`      // Cada impresora guarda su cola en un subdirectorio con su nombre
+	MaxJobs int           `yaml:"max_jobs"` // 0 para defaultSpoolMaxJobs
+	MaxAge  time.Duration `yaml:"max_age"`  // 0 para defaultSpoolMaxAge
+}
+
+// validate Comprueba la cola de trabajos.
+func (s *spoolSettings) validate() error {
+	if !filepath.IsAbs(s.Dir) {
+		return fmt.Errorf(tr("el directorio de la cola de trabajos %q no es una ruta absoluta"), s.Dir)
+	}
+	if s.MaxJobs < 0 || s.MaxAge < 0 {
+		return errors.New(tr("los límites de la cola de trabajos no pueden ser negativos"))
+	}
+	return nil
+}
+
+// spoolDir Devuelve el directorio con la cola de la impresora.
+func (opts installOptions) spoolDir() string {
+	return filepath.Join(opts.Spool.Dir, opts.unitName())
+}
+
+// spoolFlags Devuelve las opciones de la cola de serve.
+func spoolFlags(opts installOptions) string {
+	if opts.Spool == nil {
+		return ""
+	}
+	flags := " --spool " + opts.spoolDir()
+	if opts.Spool.MaxJobs > 0 {
+		flags += " --spool-max-jobs " + strconv.Itoa(opts.Spool.MaxJobs)
+	}
+	if opts.Spool.MaxAge > 0 {
+		flags += " --spool-max-age " + opts.Spool.MaxAge.String()
+	}
+	return flags
+}
+
+// spoolServerFlags Añade las opciones de la cola a serve y devuelve la
+// función que la crea después de fs.Parse; nil sin cola.
+func spoolServerFlags(fs *flag.FlagSet) func() *jobSpool {
+	dir := fs.String("spool", "", tr("guardar los trabajos en este directorio antes de imprimirlos y reintentarlos mientras la impresora no esté disponible"))
+	maxJobs := fs.Int("spool-max-jobs", defaultSpoolMaxJobs, tr("trabajos pendientes admitidos en la cola; con la cola llena se rechazan los nuevos"))
+	maxAge := fs.Duration("spool-max-age", defaultSpoolMaxAge, tr("se descartan los trabajos que llevan más de esto en la cola (0 sin límite)"))
+	return func() *jobSpool {
+		if *dir == "" {
+			return nil
+		}
+		return &jobSpool{dir: *dir, maxJobs: *maxJobs, maxAge: *maxAge, notify: make(chan struct{}, 1)}
+	}
+}
+
+// jobSpool Cola de trabajos pendientes de una impresora. Cada trabajo es un
+// par de archivos con el mismo nombre: los bytes en .job y sus datos en
+// .json. El nombre empieza por la hora de llegada, así que el orden
+// alfabético es el de impresión.
+type jobSpool struct {
+	dir     string
+	maxJobs int
+	maxAge  time.Duration
+	notify  chan struct{} // Avisa a run de que hay un trabajo nuevo
+
+	mu sync.Mutex // Para que dos conexiones no pasen a la vez del límite
+}
+
+// pending Devuelve los nombres de los trabajos de la cola, en orden.
+func (s *jobSpool) pending() []string {
+	matches, _ := filepath.Glob(filepath.Join(s.dir, "*.job"))
+	for i, match := range matches {
+		matches[i] = strings.TrimSuffix(match, ".job")
+	}
+	return matches
+}
+
+// size Devuelve los trabajos que esperan en la cola.
+func (s *jobSpool) size() int {
+	return len(s.pending())
+}
+
+// add Recibe el trabajo entero en la cola y devuelve sus bytes. Con la cola
+// llena, o si la recepción falla, el trabajo no se guarda.
+func (s *jobSpool) add(job jobRecord, in io.Reader) (int64, error) {
+	if s.maxJobs > 0 && s.size() >= s.maxJobs {
+		return 0, fmt.Errorf(tr("la cola de trabajos está llena (%d trabajos)"), s.maxJobs)
+	}
+	base := filepath.Join(s.dir, fmt.Sprintf("%020d-%s", job.Start.UnixNano(), job.ID))
+	f, err := os.OpenFile(base+".job.tmp", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return 0, fmt.Errorf(tr("error al guardar el trabajo en la cola: %w"), err)
+	}
+	n, err := io.Copy(f, in)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf(tr("error al guardar el trabajo en la cola: %w"), closeErr)
+	}
+	if err != nil {
+		os.Remove(base + ".job.tmp")
+		return n, err
+	}
+	meta, _ := json.Marshal(job)
+	err = os.WriteFile(base+".json", meta, 0600)
+	if err == nil {
+		s.mu.Lock()
+		if s.maxJobs > 0 && s.size() >= s.maxJobs {
+			err = fmt.Errorf(tr("la cola de trabajos está llena (%d trabajos)"), s.maxJobs)
+		} else {
+			err = os.Rename(base+".job.tmp", base+".job")
+		}
+		s.mu.Unlock()
+	}
+	if err != nil {
+		os.Remove(base + ".job.tmp")
+		os.Remove(base + ".json")
+		return n, err
+	}
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return n, nil
+}
+
+// remove Quita de la cola un trabajo impreso o descartado.
+func (s *jobSpool) remove(base string) {
+	os.Remove(base + ".job")
+	os.Remove(base + ".json")
+}
+
+// run Imprime los trabajos de la cola de uno en uno y en orden, incluidos
+// los que quedaron de antes de reiniciar el servicio. Si la impresión falla
+// el trabajo sigue el primero y se reintenta entero cada spoolRetryInterval:
+// si la impresora se quedó sin papel a mitad, el ticket sale completo al
+// volver, con el trozo ya impreso repetido. print imprime un trabajo.
+func (s *jobSpool) run(print func(job jobRecord, in io.Reader) (int64, error)) {
+	// Los trabajos a medio recibir cuando se paró el servicio no están completos.
+	tmp, _ := filepath.Glob(filepath.Join(s.dir, "*.job.tmp"))
+	for _, path := range tmp {
+		os.Remove(path)
+		os.Remove(strings.TrimSuffix(path, ".job.tmp") + ".json")
+	}
+	failing := ""
+	for {
+		queue := s.pending()
+		if len(queue) == 0 {
+			<-s.notify
+			continue
+		}
+		base := queue[0]
+		var job jobRecord
+		data, err := os.ReadFile(base + ".json")
+		if err == nil {
+			err = json.Unmarshal(data, &job)
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf(tr("Se descarta el trabajo %s de la cola: %v"), filepath.Base(base), err))
+			s.remove(base)
+			continue
+		}
+		if s.maxAge > 0 && time.Since(job.Start) > s.maxAge {
+			err := fmt.Errorf(tr("lleva en la cola más de %s"), s.maxAge)
+			logger.Error(fmt.Sprintf(tr("Se descarta el trabajo de %s: %v"), job.Client, err), job.attrs(0, err)...)
+			s.remove(base)
+			continue
+		}
+
+		f, err := os.Open(base + ".job")
+		if err != nil {
+			logger.Error(fmt.Sprintf(tr("Se descarta el trabajo %s de la cola: %v"), job.ID, err), job.attrs(0, err)...)
+			s.remove(base)
+			continue
+		}
+		n, err := print(job, f)
+		f.Close()
+		if err != nil {
+			// Se avisa del primer fallo de cada trabajo, no de cada intento.
+			if base != failing {
+				logger.Warn(fmt.Sprintf(tr("El trabajo de %s sigue en la cola (%d pendientes): %v"), job.Client, len(queue), err), job.attrs(n, err)...)
+				failing = base
+			}
+			time.Sleep(spoolRetryInterval)
+			continue
+		}
+		s.remove(base)
+		failing = ""
+		logger.Info(fmt.Sprintf(tr("Trabajo de %d bytes de %s enviado a %s"), n, job.Client, job.Target), job.attrs(n, nil)...)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// unitStatus Estado de una unidad systemd según "systemctl show".
+type unitStatus struct {
+	ActiveState   string `json:"active_state"`
+	SubState      string `json:"sub_state"`
+	UnitFileState string `json:"unit_file_state"`
+}
+
+// deviceStatus Estado del nodo de la impresora.
+type deviceStatus struct {
+	Path     string `json:"path"`
+	Exists   bool   `json:"exists"`
+	Writable bool   `json:"writable"`
+	Error    string `json:"error,omitempty"`
+}
+
+// printerStatus Resumen del estado de una impresora instalada.
+type printerStatus struct {
+	Name        string            `json:"name"`
+	Listen      string            `json:"listen"`
+	Socket      unitStatus        `json:"socket"`
+	Connections int               `json:"connections"`          // Instancias del servicio en ejecución
+	Accepted    string            `json:"accepted"`             // Conexiones aceptadas desde que arrancó el socket
+	Device      deviceStatus      `json:"device"`               // Con una cola de CUPS, el estado de la cola
+	Queue       string            `json:"cups_queue,omitempty"` // Cola de CUPS que recibe los trabajos
+	Remote      string            `json:"remote,omitempty"`     // Impresora de red que recibe los trabajos
+	Printer     *printerCondition `json:"printer,omitempty"`    // Estado que informa la impresora, si responde
+	Healthy     bool              `json:"healthy"`
+}
+
+// systemctlShow Devuelve las propiedades pedidas de una unidad.
+func systemctlShow(unit string, props ...string) map[string]string {
+	out, _ := systemctlCommand("show", unit, "--property="+strings.Join(props, ",")).Output()
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			values[k] = v
+		}
+	}
+	return values
+}
+
+// runningInstances Cuenta las instancias activas del servicio de plantilla,
+// una por cada conexión en curso.
+func runningInstances(name string) int {
+	out, err := systemctlCommand("list-units", name+"@*.service", "--state=active", "--no-legend", "--plain").Output()
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.TrimSpace(line) != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// checkDevice Comprueba que el nodo existe, es un dispositivo de caracteres
+// y que el usuario actual puede escribir en él.
+func checkDevice(path string) deviceStatus {
+	st := deviceStatus{Path: path}
+	if path == "" {
+		st.Error = tr("el servicio no indica una impresora")
+		return st
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	st.Exists = true
+	if info.Mode()&os.ModeCharDevice == 0 {
+		st.Error = tr("no es un dispositivo de caracteres")
+		return st
+	}
+	// 2 = W_OK
+	if err := syscall.Access(path, 2); err != nil {
+		st.Error = tr("sin permiso de escritura: ") + err.Error()
+		return st
+	}
+	st.Writable = true
+	return st
+}
+
+// installStatus Reúne el estado de una instalación.
+func installStatus(inst installation) printerStatus {
+	props := systemctlShow(inst.Name+".socket", "ActiveState", "SubState", "UnitFileState", "NAccepted")
+	st := printerStatus{
+		Name:   inst.Name,
+		Listen: inst.Listen,
+		Socket: unitStatus{
+			ActiveState:   props["ActiveState"],
+			SubState:      props["SubState"],
+			UnitFileState: props["UnitFileState"],
+		},
+		Connections: runningInstances(inst.Name),
+		Accepted:    props["NAccepted"],
+		Device:      checkDevice(inst.Device),
+		Queue:       inst.Queue,
+		Remote:      inst.Remote,
+	}
+	switch {
+	case inst.Queue != "":
+		st.Device = checkCUPSQueue(inst.Queue)
+	case inst.Remote != "":
+		st.Device = checkRemote(inst.Remote)
+	}
+	// Preguntar a la impresora abre su nodo (o la única conexión que atiende
+	// una impresora de red), así que solo se hace si no hay ningún trabajo:
+	// el daemon lo sabe y responde por /healthz; sin métricas no se le
+	// pregunta, porque un trabajo que llegara mientras tanto fallaría. Con
+	// CUPS la impresora es de CUPS, que ya pregunta su estado.
+	switch {
+	case !st.Device.Writable || inst.Queue != "":
+	case inst.Daemon:
+		if inst.Metrics != "" {
+			st.Printer = daemonCondition(inst.Metrics)
+		}
+	case st.Connections == 0:
+		st.Printer = conditionReader(inst.Device, inst.Remote)()
+	}
+	st.Healthy = st.Socket.ActiveState == "active" && st.Device.Writable && st.Printer.ok()
+	return st
+}
+
+// runStatus Implementa el subcomando "status". Devuelve un código de salida
+// distinto de cero si alguna impresora no está lista, para los scripts de monitoreo.
+func runStatus(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, tr("mostrar el estado en formato JSON"))
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s status [--json]\n"), filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	installs, err := readInstallations()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	statuses := make([]printerStatus, 0, len(installs))
+	healthy := len(installs) > 0
+	for _, inst := range installs {
+		st := installStatus(inst)
+		healthy = healthy && st.Healthy
+		statuses = append(statuses, st)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(statuses)
+	} else if len(statuses) == 0 {
+		fmt.Printf(tr("No se encontró ninguna instalación en %s.\n"), unitDir)
+	} else {
+		for _, st := range statuses {
+			mark := "✓"
+			if !st.Healthy {
+				mark = "✗"
+			}
+			fmt.Printf("%s %s (%s)\n", mark, st.Name, st.Listen)
+			fmt.Printf("  Socket:   %s/%s, %s\n", st.Socket.ActiveState, st.Socket.SubState, st.Socket.UnitFileState)
+			fmt.Printf(tr("  Conexiones activas: %d, aceptadas: %s\n"), st.Connections, st.Accepted)
+			device := tr("listo")
+			if st.Device.Error != "" {
+				device = st.Device.Error
+			}
+			switch {
+			case st.Queue != "":
+				fmt.Printf(tr("  Cola de CUPS: %s (%s)\n"), st.Queue, device)
+			case st.Remote != "":
+				fmt.Printf(tr("  Impresora de red: %s (%s)\n"), st.Remote, device)
+			default:
+				fmt.Printf(tr("  Impresora: %s (%s)\n"), st.Device.Path, device)
+			}
+			if st.Printer != nil {
+				fmt.Printf(tr("  Estado de la impresora: %s\n"), st.Printer)
+			}
+		}
+	}
+
+	if !healthy {
+		os.Exit(exitFailure)
+	}
+}
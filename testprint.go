@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultColumns Columnas que se asumen cuando no se conoce el modelo.
+const defaultColumns = 42
+
+// testPageReceipt Construye la página de prueba: muestras de alineación,
+// negrita, tamaños y acentos, una regla del ancho del papel y el corte.
+func testPageReceipt(p printer, via string) *receipt {
+	columns := defaultColumns
+	if p.Caps != nil && p.Caps.Columns > 0 {
+		columns = p.Caps.Columns
+	}
+	hostname, _ := os.Hostname()
+
+	r := newReceipt().
+		align(alignCenter).bold(true).size(2, 2).line("Página de prueba").size(1, 1).bold(false).
+		line(printerName(p)).
+		line(hostname).
+		line(via).
+		feed(1)
+
+	r.align(alignLeft).line("Alineación izquierda").
+		align(alignCenter).line("Alineación centrada").
+		align(alignRight).line("Alineación derecha").
+		align(alignLeft).feed(1)
+
+	r.text("Normal ").bold(true).text("Negrita").bold(false).line("")
+	r.size(2, 1).line("Doble ancho").
+		size(1, 2).line("Doble alto").
+		size(2, 2).line("Doble").
+		size(1, 1).feed(1)
+
+	r.line("Acentos: áéíóú ÁÉÍÓÚ ñÑ ü ¿? ¡!")
+	ruler := strings.Repeat("1234567890", columns/10+1)[:columns]
+	r.line(ruler)
+	r.line(fmt.Sprintf("%d columnas", columns))
+
+	return r.feed(1).align(alignCenter).line(time.Now().Format("2006-01-02 15:04:05")).feed(3).cut()
+}
+
+// runTestPrint Implementa el subcomando "test-print [impresora]", que imprime
+// una página de prueba a través del socket instalado para comprobar el camino
+// completo, o directamente en el dispositivo con --direct.
+func runTestPrint(args []string) {
+	fs := flag.NewFlagSet("test-print", flag.ExitOnError)
+	direct := fs.Bool("direct", false, tr("escribir directamente en el dispositivo en lugar de usar el socket"))
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s test-print [--direct] [impresora]\n"), filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	// En modo directo la impresora no necesita estar instalada.
+	if *direct {
+		var p printer
+		var err error
+		if fs.NArg() == 1 {
+			p, err = lookupPrinter(fs.Arg(0))
+		} else {
+			p, _, err = installedPrinter("")
+		}
+		if err != nil {
+			log.Printf("Error: %v", err)
+			os.Exit(exitCodeFor(err))
+		}
+		if err := writeToDevice(p.Path, testPageReceipt(p, "Directo a "+p.Path).Bytes()); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		logger.Info(fmt.Sprintf(tr("✓ Página de prueba impresa en %s\n"), p))
+		return
+	}
+
+	p, inst, err := installedPrinter(fs.Arg(0))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		os.Exit(exitCodeFor(err))
+	}
+	addr, err := inst.localAddr()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	logger.Info(fmt.Sprintf(tr("Enviando la página de prueba por %s...\n"), addr))
+	send := sendToSocket
+	if inst.TLS {
+		send = sendToTLSSocket
+	}
+	if err := send(addr, testPageReceipt(p, "Vía socket "+inst.Listen).Bytes()); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	logger.Info(fmt.Sprintf(tr("✓ Página de prueba enviada a %s\n"), p))
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Credenciales de systemd con el certificado y la clave del socket TLS.
+const (
+	tlsCertCredential = "tls-cert"
+	tlsKeyCredential  = "tls-key"
+)
+
+// Parámetros del socket TLS y de los certificados autofirmados.
+const (
+	tlsHandshakeTimeout = 10 * time.Second
+	tlsCertValidity     = 10 * 365 * 24 * time.Hour
+)
+
+// tlsDir Directorio de los certificados autofirmados que crea la instalación.
+var tlsDir = "/etc/escpos-printer/tls"
+
+// tlsSettings Cifrado TLS del socket RAW, para las instalaciones en las que
+// los tickets cruzan redes en las que no se confía. Sin certificado la
+// instalación genera uno autofirmado.
+type tlsSettings struct {
+	Cert string `yaml:"cert"` // Certificado PEM, vacío para generar uno autofirmado
+	Key  string `yaml:"key"`  // Clave privada PEM del certificado
+}
+
+// validate Comprueba que el certificado y la clave se indican juntos y con
+// rutas absolutas, porque el servicio no comparte el directorio de trabajo.
+func (t *tlsSettings) validate() error {
+	if (t.Cert == "") != (t.Key == "") {
+		return errors.New(tr("el certificado y la clave TLS se indican juntos"))
+	}
+	for _, path := range []string{t.Cert, t.Key} {
+		if path != "" && !filepath.IsAbs(path) {
+			return fmt.Errorf(tr("la ruta del certificado o la clave TLS debe ser absoluta: %q"), path)
+		}
+	}
+	return nil
+}
+
+// tlsCertPath Devuelve la ruta del certificado autofirmado de la impresora.
+func tlsCertPath(name string) string {
+	return filepath.Join(tlsDir, name+".crt")
+}
+
+// tlsKeyPath Devuelve la ruta de la clave privada autofirmada de la impresora.
+func tlsKeyPath(name string) string {
+	return filepath.Join(tlsDir, name+".key")
+}
+
+// tlsPaths Devuelve el certificado y la clave del socket: los indicados o
+// los autofirmados de tlsDir.
+func (opts installOptions) tlsPaths() (cert, key string) {
+	if opts.TLS.Cert != "" {
+		return opts.TLS.Cert, opts.TLS.Key
+	}
+	return tlsCertPath(opts.unitName()), tlsKeyPath(opts.unitName())
+}
+
+// checkTLS Rechaza lo que no funciona con el socket cifrado: lo que imprime
+// en él sin TLS (la cola en crudo de CUPS, el puente MQTT), el anuncio mDNS
+// de un socket RAW normal y los sockets Unix, que no salen de la máquina.
+func checkTLS(opts installOptions) error {
+	switch {
+	case opts.TLS == nil:
+	case opts.CUPSQueue != "":
+		return fmt.Errorf(tr("%s: TLS no admite colas de CUPS"), opts.Printer.Path)
+	case opts.RawQueue:
+		return fmt.Errorf(tr("%s: la cola en crudo de CUPS no sabe imprimir en un socket TLS"), opts.Printer.Path)
+	case opts.MQTT != nil:
+		return fmt.Errorf(tr("%s: el puente MQTT no sabe imprimir en un socket TLS"), opts.Printer.Path)
+	case opts.MDNS:
+		return fmt.Errorf(tr("%s: mDNS anunciaría el socket TLS como RAW sin cifrar"), opts.Printer.Path)
+	case opts.Unix != nil:
+		return fmt.Errorf(tr("%s: TLS no admite sockets Unix"), opts.Printer.Path)
+	}
+	return nil
+}
+
+// tlsFlags Devuelve las opciones de TLS de relay y serve. Fuera de --user el
+// certificado y la clave llegan como credenciales de systemd y el programa
+// los busca en $CREDENTIALS_DIRECTORY.
+func tlsFlags(opts installOptions) string {
+	if opts.TLS == nil {
+		return ""
+	}
+	if userMode {
+		cert, key := opts.tlsPaths()
+		return " --tls-cert " + cert + " --tls-key " + key
+	}
+	return " --tls"
+}
+
+// tlsCredentials Devuelve las líneas LoadCredential= del certificado y la
+// clave. systemd las lee como root, así la clave puede ser solo de root.
+func tlsCredentials(opts installOptions) string {
+	if opts.TLS == nil || userMode {
+		return ""
+	}
+	cert, key := opts.tlsPaths()
+	return "LoadCredential=" + tlsCertCredential + ":" + cert + "\nLoadCredential=" + tlsKeyCredential + ":" + key + "\n"
+}
+
+// tlsHosts Devuelve los nombres y direcciones del certificado autofirmado:
+// el nombre de la máquina, las direcciones en las que escucha el socket o,
+// si escucha en todas, las de sus interfaces.
+func (opts installOptions) tlsHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if hostname, err := os.Hostname(); err == nil {
+		hosts = append([]string{hostname}, hosts...)
+	}
+	specific := false
+	for _, host := range bindHosts(opts.Bind) {
+		if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+			hosts, specific = append(hosts, host), true
+		}
+	}
+	if !specific {
+		addrs, _ := net.InterfaceAddrs()
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && !ipnet.IP.IsLinkLocalUnicast() {
+				hosts = append(hosts, ipnet.IP.String())
+			}
+		}
+	}
+	return hosts
+}
+
+// tlsCertCommand Devuelve el comando del plan que crea el certificado
+// autofirmado, o nil si se indicó uno.
+func tlsCertCommand(opts installOptions) []string {
+	if opts.TLS == nil || opts.TLS.Cert != "" {
+		return nil
+	}
+	cert, key := opts.tlsPaths()
+	return []string{installedBinaryPath, "tls-cert", "--cert", cert, "--key", key, "--hosts", strings.Join(opts.tlsHosts(), ",")}
+}
+
+// tlsFromExecStart Indica si el servicio cifra las conexiones con TLS.
+func tlsFromExecStart(execStart string) bool {
+	for _, field := range strings.Fields(execStart) {
+		if field == "--tls" || field == "--tls-cert" {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsServerFlags Añade las opciones de TLS a relay o serve y devuelve la
+// función que carga el certificado después de fs.Parse; nil sin TLS.
+func tlsServerFlags(fs *flag.FlagSet) func() (*tls.Config, error) {
+	credentials := fs.Bool("tls", false, tr("cifrar las conexiones con TLS con las credenciales tls-cert y tls-key de systemd"))
+	cert := fs.String("tls-cert", "", tr("certificado PEM con el que cifrar las conexiones con TLS"))
+	key := fs.String("tls-key", "", tr("clave privada PEM del certificado"))
+	return func() (*tls.Config, error) {
+		if *credentials {
+			dir := os.Getenv("CREDENTIALS_DIRECTORY")
+			if dir == "" {
+				return nil, errors.New(tr("--tls necesita las credenciales de systemd (CREDENTIALS_DIRECTORY); usa --tls-cert y --tls-key"))
+			}
+			*cert, *key = filepath.Join(dir, tlsCertCredential), filepath.Join(dir, tlsKeyCredential)
+		}
+		if *cert == "" && *key == "" {
+			return nil, nil
+		}
+		pair, err := tls.LoadX509KeyPair(*cert, *key)
+		if err != nil {
+			return nil, fmt.Errorf(tr("error al cargar el certificado TLS: %w"), err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{pair}, MinVersion: tls.VersionTLS12}, nil
+	}
+}
+
+// handshakeTLS Completa el saludo TLS con un plazo, para que un cliente que
+// no envía nada, o que envía el ticket sin cifrar, no retenga la impresora.
+func handshakeTLS(conn *tls.Conn) error {
+	conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+	if err := conn.Handshake(); err != nil {
+		return fmt.Errorf(tr("error en el saludo TLS con %s: %w"), conn.RemoteAddr(), err)
+	}
+	return nil
+}
+
+// sendToTLSSocket Envía datos a un socket TCP con TLS. No se comprueba el
+// certificado: solo se usa para imprimir en el socket de esta misma máquina.
+func sendToTLSSocket(addr string, data []byte) error {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return fmt.Errorf(tr("error al conectar con %s: %w"), addr, err)
+	}
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(data); err != nil {
+		conn.Close()
+		return fmt.Errorf(tr("error al enviar datos a %s: %w"), addr, err)
+	}
+	return conn.Close()
+}
+
+// selfSignedCert Crea un certificado autofirmado ECDSA P-256 para los nombres
+// y direcciones indicados. Devuelve el certificado y la clave en PEM.
+func selfSignedCert(hosts []string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hosts[0], Organization: []string{"ESC/POS Printer"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(tlsCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// certFingerprint Devuelve la huella SHA-256 del certificado PEM, la que
+// comparan los clientes que fijan el certificado.
+func certFingerprint(certPEM []byte) string {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return ""
+	}
+	sum := sha256.Sum256(block.Bytes)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// runTLSCert Implementa el subcomando "tls-cert", con el que la instalación
+// crea el certificado autofirmado del socket. Un certificado que ya existe
+// se conserva, para que los clientes que lo fijaron sigan confiando en él.
+func runTLSCert(args []string) {
+	fs := flag.NewFlagSet("tls-cert", flag.ExitOnError)
+	cert := fs.String("cert", "", tr("ruta del certificado"))
+	key := fs.String("key", "", tr("ruta de la clave privada"))
+	hosts := fs.String("hosts", "", tr("nombres y direcciones IP del certificado, separados por comas"))
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s tls-cert --cert ARCHIVO --key ARCHIVO --hosts NOMBRE[,NOMBRE...]\n"), filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *cert == "" || *key == "" || *hosts == "" {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	if existing, err := os.ReadFile(*cert); err == nil {
+		if _, err := os.Stat(*key); err == nil {
+			logger.Info(fmt.Sprintf(tr("✓ Se conserva el certificado TLS %s (huella SHA-256 %s)\n"), *cert, certFingerprint(existing)), "path", *cert)
+			return
+		}
+	}
+	certPEM, keyPEM, err := selfSignedCert(strings.Split(*hosts, ","))
+	if err != nil {
+		log.Fatalf(tr("Error al crear el certificado TLS: %v"), err)
+	}
+	for _, f := range []struct {
+		path string
+		data []byte
+		mode os.FileMode
+	}{
+		{*key, keyPEM, 0600},
+		{*cert, certPEM, 0644},
+	} {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			log.Fatalf(tr("Error al crear %s: %v"), filepath.Dir(f.path), err)
+		}
+		if err := os.WriteFile(f.path, f.data, f.mode); err != nil {
+			log.Fatalf(tr("Error al escribir %s: %v"), f.path, err)
+		}
+	}
+	logger.Info(fmt.Sprintf(tr("✓ Certificado TLS autofirmado creado en %s (huella SHA-256 %s)\n"), *cert, certFingerprint(certPEM)), "path", *cert)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// getTermios Lee la configuración de la terminal de fd.
+func getTermios(fd uintptr) (syscall.Termios, error) {
+	var t syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&t)))
+	if errno != 0 {
+		return t, errno
+	}
+	return t, nil
+}
+
+// setTermios Aplica una configuración de terminal a fd.
+func setTermios(fd uintptr, t syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&t)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// isInteractive Indica si la entrada y la salida son una terminal, de modo que
+// se puede usar la selección con flechas. Con una tubería o un archivo se usan
+// las preguntas de siempre.
+func isInteractive() bool {
+	if _, err := getTermios(os.Stdin.Fd()); err != nil {
+		return false
+	}
+	_, err := getTermios(os.Stdout.Fd())
+	return err == nil
+}
+
+// rawMode Desactiva el eco y el modo de líneas de la terminal para leer las
+// teclas una a una. Devuelve la función que restaura la configuración anterior.
+func rawMode() (func(), error) {
+	fd := os.Stdin.Fd()
+	old, err := getTermios(fd)
+	if err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.ISIG
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := setTermios(fd, raw); err != nil {
+		return nil, err
+	}
+	return func() { setTermios(fd, old) }, nil
+}
+
+// Teclas que entiende el menú.
+const (
+	keyOther = iota
+	keyUp
+	keyDown
+	keySpace
+	keyEnter
+	keyCancel
+)
+
+// readKey Lee una tecla, interpretando las secuencias de escape de las flechas.
+func readKey() (int, error) {
+	b, err := stdin.ReadByte()
+	if err != nil {
+		return keyCancel, err
+	}
+	switch b {
+	case '\r', '\n':
+		return keyEnter, nil
+	case ' ':
+		return keySpace, nil
+	case 'k':
+		return keyUp, nil
+	case 'j':
+		return keyDown, nil
+	case 'q', 3: // 3 = Ctrl+C
+		return keyCancel, nil
+	case 0x1b:
+		// Las flechas llegan como ESC [ A / ESC [ B. Un ESC solo cancela.
+		if stdin.Buffered() == 0 {
+			return keyCancel, nil
+		}
+		if next, _ := stdin.ReadByte(); next != '[' {
+			return keyOther, nil
+		}
+		switch code, _ := stdin.ReadByte(); code {
+		case 'A':
+			return keyUp, nil
+		case 'B':
+			return keyDown, nil
+		}
+	}
+	return keyOther, nil
+}
+
+// menuSelect Muestra un menú que se recorre con las flechas. Debajo de la
+// opción actual se muestran sus detalles. Con multi se marcan varias opciones
+// con la barra espaciadora; Enter confirma (la opción actual si no se marcó
+// ninguna). Devuelve los índices elegidos.
+func menuSelect(title string, items []string, details func(int) string, multi bool) ([]int, error) {
+	restore, err := rawMode()
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+
+	cursor := 0
+	marked := make([]bool, len(items))
+	drawn := 0
+	for {
+		// Se vuelve al principio del menú y se redibuja completo.
+		if drawn > 0 {
+			fmt.Printf("\x1b[%dA", drawn)
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "\x1b[2K%s\n", title)
+		if multi {
+			fmt.Fprintf(&b, "\x1b[2K%s\n", tr("  ↑/↓ mover, espacio marcar, Enter confirmar, q cancelar"))
+		} else {
+			fmt.Fprintf(&b, "\x1b[2K%s\n", tr("  ↑/↓ mover, Enter confirmar, q cancelar"))
+		}
+		for i, item := range items {
+			pointer := "  "
+			if i == cursor {
+				pointer = "▸ "
+			}
+			box := ""
+			if multi {
+				box = "[ ] "
+				if marked[i] {
+					box = "[x] "
+				}
+			}
+			fmt.Fprintf(&b, "\x1b[2K%s%s%s\n", pointer, box, item)
+		}
+		fmt.Fprintf(&b, "\x1b[2K\n")
+		detail := ""
+		if details != nil {
+			detail = details(cursor)
+		}
+		lines := strings.Split(detail, "\n")
+		// Se reservan siempre tantas líneas como la opción con más detalles
+		// para que el menú no cambie de tamaño al moverse.
+		maxLines := 0
+		for i := range items {
+			if details != nil {
+				if n := strings.Count(details(i), "\n") + 1; n > maxLines {
+					maxLines = n
+				}
+			}
+		}
+		for i := 0; i < maxLines; i++ {
+			line := ""
+			if i < len(lines) {
+				line = lines[i]
+			}
+			fmt.Fprintf(&b, "\x1b[2K  %s\n", line)
+		}
+		fmt.Print(b.String())
+		drawn = strings.Count(b.String(), "\n")
+
+		key, err := readKey()
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case keyUp:
+			cursor = (cursor + len(items) - 1) % len(items)
+		case keyDown:
+			cursor = (cursor + 1) % len(items)
+		case keySpace:
+			if multi {
+				marked[cursor] = !marked[cursor]
+			}
+		case keyCancel:
+			return nil, errors.New(tr("selección cancelada"))
+		case keyEnter:
+			var chosen []int
+			for i, m := range marked {
+				if m {
+					chosen = append(chosen, i)
+				}
+			}
+			if len(chosen) == 0 {
+				chosen = []int{cursor}
+			}
+			return chosen, nil
+		}
+	}
+}
+
+// printerDetails Describe una impresora para el panel de detalles del menú.
+func printerDetails(p printer) string {
+	lines := []string{fmt.Sprintf(tr("Dispositivo: %s"), p.Path)}
+	if p.PortPath != "" {
+		lines = append(lines, fmt.Sprintf(tr("Puerto USB: %s"), p.PortPath))
+	}
+	if p.VendorID != "" {
+		lines = append(lines, fmt.Sprintf("USB: %s:%s %s", p.VendorID, p.ProductID, p.usbName()))
+	}
+	if p.Serial != "" {
+		lines = append(lines, fmt.Sprintf(tr("Serie: %s"), p.Serial))
+	}
+	if p.Label != "" {
+		lines = append(lines, fmt.Sprintf(tr("Etiqueta: %s"), p.Label))
+	}
+	if p.Caps != nil {
+		lines = append(lines, fmt.Sprintf(tr("Capacidades: %s"), p.Caps))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// udevRulesDir Directorio donde se escriben las reglas udev del instalador.
+const udevRulesDir = "/etc/udev/rules.d"
+
+// stableDeviceDir Directorio de los enlaces estables que crean las reglas udev.
+// El número lpX depende del orden en que el kernel detecta las impresoras y
+// puede cambiar tras un reinicio; el enlace sigue siempre a la misma impresora.
+const stableDeviceDir = "/dev/escpos"
+
+// udevRulePath Devuelve la ruta de la regla udev de una unidad.
+func udevRulePath(name string) string {
+	return filepath.Join(udevRulesDir, "99-"+name+".rules")
+}
+
+// hasStablePath Indica si se puede crear un enlace estable para la impresora:
+// hace falta conocer su posición en el bus USB o, si todavía no está
+// conectada, su modelo. Con una cola de CUPS no se usa el dispositivo y no
+// hace falta; con --user no se puede, porque la regla udev la escribe root.
+func (opts installOptions) hasStablePath() bool {
+	return !userMode && (opts.Printer.PortPath != "" || opts.Printer.Absent) && opts.CUPSQueue == ""
+}
+
+// usbModelScheme Prefijo con el que se indica una impresora USB por su modelo
+// en --printer o en la configuración: usb:VID:PID o usb:VID:PID:SERIE. Sirve
+// para instalar una impresora que todavía no está conectada.
+const usbModelScheme = "usb:"
+
+// parseUSBModel Interpreta usb:VID:PID[:SERIE] y devuelve la impresora
+// correspondiente, marcada como no conectada.
+func parseUSBModel(name string) (printer, error) {
+	fields := strings.SplitN(strings.TrimPrefix(name, usbModelScheme), ":", 3)
+	if len(fields) < 2 || len(fields[0]) != 4 || len(fields[1]) != 4 {
+		return printer{}, fmt.Errorf(tr("modelo USB inválido %q (usb:VID:PID o usb:VID:PID:SERIE)"), name)
+	}
+	p := printer{
+		Path:      name,
+		Kind:      kindUSB,
+		VendorID:  strings.ToLower(fields[0]),
+		ProductID: strings.ToLower(fields[1]),
+		Absent:    true,
+	}
+	if len(fields) == 3 {
+		p.Serial = fields[2]
+	}
+	return p, nil
+}
+
+// matchesModel Indica si una impresora conectada es del modelo indicado y,
+// si se indicó, tiene el mismo número de serie.
+func (p printer) matchesModel(model printer) bool {
+	return p.VendorID == model.VendorID && p.ProductID == model.ProductID && (model.Serial == "" || p.Serial == model.Serial)
+}
+
+// systemdEscapePath Convierte una ruta en el nombre de unidad que le asigna
+// systemd, como "systemd-escape --path": /dev/escpos/escpos-printer se
+// convierte en dev-escpos-escpos\x2dprinter.
+func systemdEscapePath(path string) string {
+	var b strings.Builder
+	for i, c := range []byte(strings.Trim(path, "/")) {
+		switch {
+		case c == '/':
+			b.WriteByte('-')
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == ':', c == '_', c == '.' && i > 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		}
+	}
+	return b.String()
+}
+
+// deviceUnit Devuelve la unidad .device que systemd crea para el enlace
+// estable. La regla udev la etiqueta para systemd, así que aparece al conectar
+// la impresora y desaparece al desconectarla.
+func (opts installOptions) deviceUnit() string {
+	return systemdEscapePath(opts.devicePath()) + ".device"
+}
+
+// devicePath Devuelve la ruta de la impresora que usa el servicio: el enlace
+// estable si existe la regla udev o, si no, el nodo /dev/usb/lpX.
+func (opts installOptions) devicePath() string {
+	if !opts.hasStablePath() {
+		return opts.Printer.Path
+	}
+	return filepath.Join(stableDeviceDir, opts.unitName())
+}
+
+// boundDeviceUnit Devuelve la unidad .device a la que se ata el servicio, o
+// una cadena vacía si no se puede. systemd solo crea unidades .device para los
+// nodos que udev etiqueta: el enlace estable (lo hace nuestra regla) y los
+// puertos paralelo y serie (lo hacen las reglas de systemd); los /dev/usb/lpX
+// no llevan la etiqueta. Con CUPS o una impresora de red no hay dispositivo.
+func (opts installOptions) boundDeviceUnit() string {
+	switch {
+	case opts.CUPSQueue != "" || opts.Printer.Kind == kindNetwork:
+		return ""
+	case opts.hasStablePath(), opts.Printer.Kind == kindParallel, opts.Printer.Kind == kindSerial:
+		return opts.deviceUnit()
+	}
+	return ""
+}
+
+// udevMatch Devuelve las condiciones de la regla que identifican la impresora.
+// Se usa el número de serie cuando ninguna otra impresora conectada del mismo
+// modelo lo repite (algunos lotes salen de fábrica con el mismo); si no, el
+// puerto USB físico. Para una impresora que no está conectada solo se conoce
+// el modelo y, si se indicó, el número de serie.
+func udevMatch(p printer, connected []printer) string {
+	if p.Absent {
+		match := fmt.Sprintf(`ATTRS{idVendor}=="%s", ATTRS{idProduct}=="%s"`, p.VendorID, p.ProductID)
+		if p.Serial != "" {
+			match += fmt.Sprintf(`, ATTRS{serial}=="%s"`, p.Serial)
+		}
+		return match
+	}
+	if p.Serial != "" && p.VendorID != "" {
+		unique := true
+		for _, other := range connected {
+			if other.Path != p.Path && other.VendorID == p.VendorID && other.ProductID == p.ProductID && other.Serial == p.Serial {
+				unique = false
+			}
+		}
+		if unique {
+			return fmt.Sprintf(`ATTRS{idVendor}=="%s", ATTRS{idProduct}=="%s", ATTRS{serial}=="%s"`, p.VendorID, p.ProductID, p.Serial)
+		}
+	}
+	return fmt.Sprintf(`KERNELS=="%s"`, p.PortPath)
+}
+
+// udevRuleContent Crea la regla udev que mantiene el enlace estable de la
+// impresora. TAG+="systemd" crea la unidad .device a la que se ata el socket.
+func udevRuleContent(opts installOptions, connected []printer) string {
+	where := fmt.Sprintf("del puerto USB %s", opts.Printer.PortPath)
+	if opts.Printer.Absent {
+		where = fmt.Sprintf("%s:%s", opts.Printer.VendorID, opts.Printer.ProductID)
+	}
+	return fmt.Sprintf(`# Enlace estable %s para la impresora %s, creado por escpos-socket-install
+SUBSYSTEM=="usbmisc", KERNEL=="lp[0-9]*", %s, SYMLINK+="%s", TAG+="systemd"
+`, opts.devicePath(), where, udevMatch(opts.Printer, connected), filepath.Join(filepath.Base(stableDeviceDir), opts.unitName()))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// runUninstall Implementa el subcomando "uninstall", que revierte la instalación:
+// detiene y deshabilita las unidades, borra los archivos creados y recarga systemd.
+func runUninstall(args []string) {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s uninstall\n"), filepath.Base(os.Args[0]))
+		os.Exit(2)
+	}
+	requireRoot()
+	logger.Info(tr("Desinstalando el servicio de impresora ESC/POS..."))
+
+	// Se intenta todo aunque alguna unidad no exista: el objetivo es dejar
+	// el sistema limpio incluso tras una instalación a medias.
+	installs, err := readInstallations()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	var commands [][]string
+	for _, queue := range rawQueuesOf(installs) {
+		commands = append(commands, []string{"lpadmin", "-x", queue})
+	}
+	for _, inst := range installs {
+		commands = append(commands,
+			systemctlArgs("disable", "--now", inst.Name+".socket"),
+			systemctlArgs("stop", inst.Name+"@*.service"),
+		)
+		if inst.Daemon {
+			commands = append(commands, systemctlArgs("stop", inst.Name+".service"))
+		}
+		commands = append(commands, firewallUninstallCommands(inst.Name)...)
+		commands = append(commands, apparmorUninstallCommands(inst.Name)...)
+		if _, err := os.Stat(mqttServicePath(inst.Name)); err == nil {
+			commands = append(commands, systemctlArgs("disable", "--now", filepath.Base(mqttServicePath(inst.Name))))
+		}
+	}
+	if _, err := os.Stat(announceTimerPath); err == nil {
+		commands = append(commands, systemctlArgs("disable", "--now", "escpos-printer-announce.timer"))
+	}
+	commands = append(commands, selinuxUninstallCommands()...)
+	for _, cmdArgs := range commands {
+		if err := runCommand(cmdArgs); err != nil {
+			logger.Warn(fmt.Sprintf("⚠ %v\n", err), "command", cmdArgs)
+		}
+	}
+
+	paths := []string{announceServicePath, announceTimerPath, installedBinaryPath, selinuxModulePath}
+	for _, inst := range installs {
+		paths = append(paths, socketUnitPath(inst.Name), serviceUnitPath(inst.Name), daemonServicePath(inst.Name), udevRulePath(inst.Name), avahiServicePath(inst.Name), mqttServicePath(inst.Name), tlsCertPath(inst.Name), tlsKeyPath(inst.Name), firewallStatePath(inst.Name), apparmorProfilePath(inst.Name))
+	}
+	// Las versiones anteriores guardaban las copias de seguridad junto a cada
+	// archivo; las de /etc/apparmor.d se cargarían en el próximo arranque.
+	for _, path := range paths {
+		old, _ := filepath.Glob(path + ".*.bak")
+		paths = append(paths, old...)
+	}
+	var removed []string
+	for _, path := range paths {
+		err := os.Remove(path)
+		switch {
+		case err == nil:
+			removed = append(removed, path)
+		case !os.IsNotExist(err):
+			log.Fatalf(tr("Error al borrar %s: %v"), path, err)
+		}
+	}
+
+	if _, err := os.Stat(backupDir); err == nil {
+		if err := os.RemoveAll(backupDir); err != nil {
+			log.Fatalf(tr("Error al borrar %s: %v"), backupDir, err)
+		}
+		removed = append(removed, backupDir)
+	}
+
+	if err := runCommand(systemctlArgs("daemon-reload")); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	for _, path := range removed {
+		if filepath.Dir(path) == udevRulesDir {
+			// Sin la regla, udev deja de crear el enlace estable en el próximo evento.
+			if err := runCommand([]string{"udevadm", "control", "--reload-rules"}); err != nil {
+				logger.Warn(fmt.Sprintf("⚠ %v\n", err))
+			}
+			break
+		}
+	}
+
+	if len(removed) == 0 {
+		logger.Info(tr("\nNo se encontraron archivos de una instalación previa."))
+		return
+	}
+	logger.Info(tr("\nArchivos eliminados:"))
+	for _, path := range removed {
+		logger.Info(fmt.Sprintf("  %s\n", path), "removed", path)
+	}
+	if _, err := os.Stat(labelsFilePath); err == nil {
+		logger.Info(fmt.Sprintf(tr("Se conservan las etiquetas de impresoras en %s.\n"), labelsFilePath))
+	}
+	logger.Info(tr("\n✓ Desinstalación completa."))
+}
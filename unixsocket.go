@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// unixSocket Socket Unix en el que escucha también (o solo) la impresora,
+// para los programas de punto de venta de la misma máquina. systemd crea el
+// archivo y los directorios que falten al arrancar el socket.
+type unixSocket struct {
+	Path  string `yaml:"path"`  // Por ejemplo /run/escpos/lp0.sock
+	Only  bool   `yaml:"only"`  // No escuchar en TCP
+	Mode  string `yaml:"mode"`  // Permisos en octal, vacío para el valor de systemd (0666)
+	User  string `yaml:"user"`  // Dueño del archivo, vacío para root
+	Group string `yaml:"group"` // Grupo del archivo, vacío para root
+}
+
+// validate Comprueba la ruta y los permisos del socket Unix.
+func (u *unixSocket) validate() error {
+	if !filepath.IsAbs(u.Path) {
+		return fmt.Errorf(tr("la ruta del socket Unix debe ser absoluta: %q"), u.Path)
+	}
+	u.Path = filepath.Clean(u.Path)
+	if u.Mode != "" {
+		if m, err := strconv.ParseUint(u.Mode, 8, 32); err != nil || m > 0777 {
+			return fmt.Errorf(tr("permisos inválidos %q para el socket Unix (en octal, por ejemplo 0660)"), u.Mode)
+		}
+	}
+	return nil
+}
+
+// directives Devuelve las directivas de la sección [Socket] que fijan el
+// dueño y los permisos del archivo.
+func (u unixSocket) directives() string {
+	var s string
+	if u.Mode != "" {
+		s += "SocketMode=" + u.Mode + "\n"
+	}
+	if u.User != "" {
+		s += "SocketUser=" + u.User + "\n"
+	}
+	if u.Group != "" {
+		s += "SocketGroup=" + u.Group + "\n"
+	}
+	return s
+}
+
+// listensTCP Indica si el socket escucha en TCP, es decir, si no es solo Unix.
+func (opts installOptions) listensTCP() bool {
+	return opts.Unix == nil || !opts.Unix.Only
+}
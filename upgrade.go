@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// changedFiles Devuelve los archivos del plan cuyo contenido es distinto del
+// que hay en el sistema, incluidos los que todavía no existen.
+func (plan installPlan) changedFiles() (map[string]bool, error) {
+	changed := make(map[string]bool)
+	for _, f := range plan.Files {
+		old, err := os.ReadFile(f.Path)
+		switch {
+		case err == nil:
+			if string(old) != f.Content {
+				changed[f.Path] = true
+			}
+		case os.IsNotExist(err):
+			changed[f.Path] = true
+		default:
+			return changed, fmt.Errorf(tr("error al leer %s: %w"), f.Path, err)
+		}
+	}
+	return changed, nil
+}
+
+// neededCommands Devuelve los comandos que hay que ejecutar según los archivos que cambian.
+func (plan installPlan) neededCommands(changed map[string]bool) []plannedCommand {
+	var cmds []plannedCommand
+	for _, cmd := range plan.Commands {
+		if cmd.needed(changed) {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+// backupDir Directorio de las copias de seguridad de los archivos que
+// reemplaza la instalación. Está fuera de los directorios que leen systemd,
+// udev o AppArmor: AppArmor carga al arrancar también los .bak de
+// /etc/apparmor.d, y la copia del perfil anterior podría sustituir al nuevo.
+var backupDir = "/var/lib/escpos-printer/backups"
+
+// backupFile Guarda el contenido anterior de un archivo en backupDir, en la
+// misma ruta y con la fecha en el nombre
+// (etc/systemd/system/escpos-printer.socket.20240131-120000.bak).
+func backupFile(path string, content []byte) (string, error) {
+	backup := filepath.Join(backupDir, path) + "." + time.Now().Format("20060102-150405") + ".bak"
+	err := os.MkdirAll(filepath.Dir(backup), 0755)
+	if err == nil {
+		err = os.WriteFile(backup, content, 0644)
+	}
+	if err != nil {
+		return "", fmt.Errorf(tr("error al guardar la copia de seguridad de %s: %w"), path, err)
+	}
+	return backup, nil
+}
+
+// printDiff Muestra las diferencias entre un archivo y su nuevo contenido con
+// "diff -u". Si diff no está instalado solo se avisa de que el archivo cambia.
+func printDiff(path, content string) {
+	cmd := exec.Command("diff", "-u", "--label", path, "--label", path+" "+tr("(nuevo)"), path, "-")
+	cmd.Stdin = strings.NewReader(content)
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	// diff termina con 1 cuando encuentra diferencias.
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		logger.Warn(fmt.Sprintf(tr("  (no se pudieron mostrar las diferencias: %v)\n"), err))
+		return
+	}
+	logger.Info(string(out), "path", path)
+}
+
+// fileRollback Versiones anteriores de los archivos que escribió la
+// instalación, para dejar el sistema como estaba si algo falla a mitad.
+type fileRollback struct {
+	paths    []string
+	previous map[string][]byte // nil si el archivo no existía
+	commands [][]string        // Comandos que deshacen los ya ejecutados, en orden de ejecución
+	backups  []string          // Copias de seguridad, que sobran si se restaura el original
+}
+
+// ran Anota los comandos que deshacen uno que ya se ejecutó.
+func (rb *fileRollback) ran(undo [][]string) {
+	rb.commands = append(rb.commands, undo...)
+}
+
+// record Anota el contenido que tenía el archivo antes de escribirlo y, si se
+// guardó, su copia de seguridad.
+func (rb *fileRollback) record(path string, old []byte, backup string) {
+	if backup != "" {
+		rb.backups = append(rb.backups, backup)
+	}
+	if rb.previous == nil {
+		rb.previous = make(map[string][]byte)
+	}
+	rb.paths = append(rb.paths, path)
+	rb.previous[path] = old
+}
+
+// undo Deshace la instalación: deshabilita las unidades nuevas que se
+// llegaron a habilitar, borra los archivos nuevos (también el programa, si no
+// estaba instalado), restaura los que había, recarga systemd y udev, reinicia
+// los sockets restaurados y deshace los comandos anotados con ran, como las
+// reglas de firewall o los servicios de --take-over. Las copias de seguridad
+// se borran con los archivos ya restaurados. Sigue aunque algún paso falle
+// para deshacer todo lo posible.
+func (rb *fileRollback) undo() {
+	if len(rb.paths) == 0 && len(rb.commands) == 0 {
+		return
+	}
+	logger.Warn(tr("La instalación falló; se deshacen los cambios."))
+	reloadRules := false
+	for _, path := range rb.paths {
+		switch filepath.Ext(path) {
+		case ".socket", ".timer", ".service":
+			// Los servicios de plantilla no se habilitan; systemctl solo avisa.
+			if rb.previous[path] == nil {
+				systemctlCommand("disable", "--now", filepath.Base(path)).Run()
+			}
+		case ".rules":
+			reloadRules = true
+		}
+	}
+	restoreFailed := false
+	for i := len(rb.paths) - 1; i >= 0; i-- {
+		path := rb.paths[i]
+		var err error
+		if old := rb.previous[path]; old != nil {
+			err = os.WriteFile(path, old, 0644)
+			logger.Info(fmt.Sprintf(tr("Restaurado %s\n"), path), "path", path)
+		} else {
+			err = os.Remove(path)
+			logger.Info(fmt.Sprintf(tr("Borrado %s\n"), path), "path", path)
+		}
+		if err != nil {
+			logger.Warn(fmt.Sprintf(tr("No se pudo deshacer el cambio en %s: %v"), path, err), "path", path)
+			restoreFailed = true
+		}
+	}
+	// Si algún archivo no se pudo restaurar, su copia es lo único que queda.
+	if !restoreFailed {
+		for _, backup := range rb.backups {
+			os.Remove(backup)
+		}
+	}
+	if err := systemctlCommand("daemon-reload").Run(); err != nil {
+		logger.Warn(fmt.Sprintf(tr("No se pudo recargar systemd: %v"), err))
+	}
+	if reloadRules {
+		exec.Command("udevadm", "control", "--reload-rules").Run()
+	}
+	// Los sockets restaurados vuelven a escuchar con su versión anterior.
+	for _, path := range rb.paths {
+		if filepath.Ext(path) == ".socket" && rb.previous[path] != nil {
+			systemctlCommand("restart", filepath.Base(path)).Run()
+		}
+	}
+	// Al final, con el puerto ya libre, para que los servicios de --take-over
+	// vuelvan a escuchar en él.
+	for i := len(rb.commands) - 1; i >= 0; i-- {
+		args := rb.commands[i]
+		logger.Info(fmt.Sprintf(tr("Ejecutando: %s...\n"), strings.Join(args, " ")), "command", args)
+		if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			logger.Warn(fmt.Sprintf(tr("No se pudo deshacer %s: %v %s"), strings.Join(args, " "), err, strings.TrimSpace(string(out))), "command", args)
+		}
+	}
+}
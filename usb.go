@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Tipos de conexión de una impresora.
+const (
+	kindUSB      = "usb"
+	kindParallel = "parallel"
+	kindSerial   = "serial"
+	kindNetwork  = "network"
+)
+
+// printer Describe una impresora encontrada en el sistema.
+type printer struct {
+	Path      string `json:"path"`              // Nodo del dispositivo, por ejemplo /dev/usb/lp0
+	Kind      string `json:"kind"`              // Conexión: kindUSB, kindParallel, kindSerial o kindNetwork
+	PortPath  string `json:"port_path"`         // Ruta física del puerto USB según sysfs, por ejemplo 1-1.3
+	VendorID  string `json:"vendor_id"`         // idVendor en hexadecimal, por ejemplo 04b8
+	ProductID string `json:"product_id"`        // idProduct en hexadecimal, por ejemplo 0e28
+	Serial    string `json:"serial,omitempty"`  // Número de serie USB, puede estar vacío o repetirse entre equipos
+	Vendor    string `json:"vendor,omitempty"`  // Fabricante según el descriptor USB, por ejemplo EPSON
+	Product   string `json:"product,omitempty"` // Modelo según el descriptor USB, por ejemplo TM-T20III
+	Label     string `json:"label,omitempty"`   // Etiqueta asignada por el operador, por ejemplo "caja izquierda"
+	Absent    bool   `json:"absent,omitempty"`  // No está conectada: se instala para cuando se conecte (usb:VID:PID)
+
+	Caps *capabilities `json:"capabilities,omitempty"` // Capacidades del modelo según la base de datos, nil si no se conoce
+}
+
+// usbDeviceDir Devuelve el directorio sysfs del dispositivo USB al que pertenece
+// el nodo /dev/usb/lpX. El enlace /sys/class/usbmisc/lpX/device apunta a la
+// interfaz (1-1.3:1.0); el directorio padre es el dispositivo (1-1.3).
+func usbDeviceDir(devPath string) (string, error) {
+	link := filepath.Join("/sys/class/usbmisc", filepath.Base(devPath), "device")
+	iface, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(iface), nil
+}
+
+// readSysfsAttr Lee un atributo de sysfs y elimina el salto de línea final.
+// Si el atributo no existe devuelve una cadena vacía.
+func readSysfsAttr(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// describeUSB Completa los datos USB de la impresora a partir de sysfs.
+// Si sysfs no está disponible la impresora se deja solo con su ruta.
+func describeUSB(p *printer) {
+	dir, err := usbDeviceDir(p.Path)
+	if err != nil {
+		return
+	}
+	// El nombre del directorio (por ejemplo 1-1.3) identifica el bus y la
+	// cadena de puertos físicos, que no cambia mientras no se mueva el cable.
+	p.PortPath = filepath.Base(dir)
+	p.VendorID = readSysfsAttr(dir, "idVendor")
+	p.ProductID = readSysfsAttr(dir, "idProduct")
+	p.Serial = readSysfsAttr(dir, "serial")
+	p.Vendor = readSysfsAttr(dir, "manufacturer")
+	p.Product = readSysfsAttr(dir, "product")
+}
+
+// describeParallel Completa el fabricante y el modelo de una impresora del
+// puerto paralelo con el identificador IEEE 1284 que el kernel lee al cargar
+// parport ("MFG:EPSON;MODEL:TM-U220;..."). Muchas impresoras antiguas no lo
+// informan y se quedan solo con su ruta.
+func describeParallel(p *printer) {
+	n := strings.TrimPrefix(filepath.Base(p.Path), "lp")
+	data, err := os.ReadFile(filepath.Join("/proc/sys/dev/parport", "parport"+n, "autoprobe"))
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSuffix(strings.TrimSpace(line), ";"), ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "MANUFACTURER", "MFG":
+			p.Vendor = value
+		case "MODEL", "MDL":
+			p.Product = value
+		}
+	}
+}
+
+// usbName Devuelve el fabricante y el modelo según el descriptor USB
+// ("EPSON TM-T20III"), o una cadena vacía si la impresora no los informa.
+func (p printer) usbName() string {
+	name := strings.TrimSpace(p.Vendor + " " + p.Product)
+	// Algunos modelos repiten el fabricante en el nombre del producto.
+	if p.Vendor != "" && strings.HasPrefix(p.Product, p.Vendor) {
+		name = p.Product
+	}
+	return name
+}
+
+// String Devuelve la descripción de la impresora que se muestra al usuario.
+func (p printer) String() string {
+	var details []string
+	switch p.Kind {
+	case kindParallel:
+		details = append(details, tr("puerto paralelo"))
+	case kindSerial:
+		details = append(details, tr("puerto serie"))
+	case kindNetwork:
+		details = append(details, tr("impresora de red"))
+	}
+	if p.Absent {
+		details = append(details, tr("no conectada"))
+	}
+	if p.PortPath != "" {
+		details = append(details, fmt.Sprintf(tr("puerto USB %s"), p.PortPath))
+	}
+	if p.VendorID != "" && p.ProductID != "" {
+		details = append(details, p.VendorID+":"+p.ProductID)
+	}
+	if p.Serial != "" {
+		details = append(details, fmt.Sprintf(tr("serie %s"), p.Serial))
+	}
+
+	s := p.Path
+	if p.Caps != nil {
+		s = p.Caps.Model + " (" + p.Path + ")"
+	} else if name := p.usbName(); name != "" {
+		s = name + " (" + p.Path + ")"
+	}
+	if len(details) > 0 {
+		s += " [" + strings.Join(details, ", ") + "]"
+	}
+	if p.Label != "" {
+		s += " «" + p.Label + "»"
+	}
+	return s
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// usbdevfsReset Código ioctl USBDEVFS_RESET (_IO('U', 20)) de linux/usbdevice_fs.h.
+const usbdevfsReset = 0x5514
+
+// usbResetTimeout Tiempo máximo de espera para que la impresora vuelva a aparecer
+// después del reinicio del puerto.
+const usbResetTimeout = 15 * time.Second
+
+// usbBusDevicePath Devuelve el nodo /dev/bus/usb/BBB/DDD del dispositivo USB
+// de la impresora, que es sobre el que se puede hacer el reinicio.
+func usbBusDevicePath(p printer) (string, error) {
+	dir, err := usbDeviceDir(p.Path)
+	if err != nil {
+		return "", fmt.Errorf(tr("no se pudo encontrar %s en sysfs: %w"), p.Path, err)
+	}
+	bus, err := strconv.Atoi(readSysfsAttr(dir, "busnum"))
+	if err != nil {
+		return "", fmt.Errorf(tr("no se pudo leer el bus USB de %s: %w"), p.Path, err)
+	}
+	dev, err := strconv.Atoi(readSysfsAttr(dir, "devnum"))
+	if err != nil {
+		return "", fmt.Errorf(tr("no se pudo leer el número de dispositivo USB de %s: %w"), p.Path, err)
+	}
+	return fmt.Sprintf("/dev/bus/usb/%03d/%03d", bus, dev), nil
+}
+
+// resetUSBDevice Ejecuta USBDEVFS_RESET sobre el dispositivo USB de la impresora.
+// Equivale a desconectar y volver a conectar el cable.
+func resetUSBDevice(p printer) error {
+	busPath, err := usbBusDevicePath(p)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(busPath, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf(tr("error al abrir %s: %w"), busPath, err)
+	}
+	defer f.Close()
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), usbdevfsReset, 0)
+	if errno != 0 {
+		return fmt.Errorf(tr("error al reiniciar el puerto USB %s: %w"), busPath, errno)
+	}
+	return nil
+}
+
+// probePrinter Comprueba que el nodo de la impresora existe y se puede abrir
+// para escritura.
+func probePrinter(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// waitForPrinter Espera a que la impresora del puerto USB indicado vuelva a
+// aparecer y responda a la prueba de escritura. El número lpX puede cambiar
+// tras el reinicio, por eso se busca por puerto físico.
+func waitForPrinter(portPath string, timeout time.Duration) (printer, error) {
+	deadline := time.Now().Add(timeout)
+	var lastErr error = errors.New(tr("la impresora no volvió a aparecer"))
+	for time.Now().Before(deadline) {
+		time.Sleep(500 * time.Millisecond)
+
+		printers, err := findPrinters()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, p := range printers {
+			if p.PortPath != portPath {
+				continue
+			}
+			if err := probePrinter(p.Path); err != nil {
+				lastErr = err
+				break
+			}
+			return p, nil
+		}
+	}
+	return printer{}, lastErr
+}
+
+// usbResetFlags Devuelve la opción de relay y serve que reinicia el puerto
+// USB de la impresora colgada.
+func usbResetFlags(opts installOptions) string {
+	if !opts.USBResetOnHang {
+		return ""
+	}
+	return " --usb-reset-on-hang"
+}
+
+// checkUSBReset Rechaza el reinicio automático si la impresora no es USB o
+// si los trabajos van a CUPS, que no pasan por relay.
+func checkUSBReset(opts installOptions) error {
+	switch {
+	case !opts.USBResetOnHang:
+	case opts.Printer.Kind != kindUSB:
+		return fmt.Errorf(tr("%s: el reinicio automático del puerto USB solo funciona con impresoras USB"), opts.Printer.Path)
+	case opts.CUPSQueue != "":
+		return fmt.Errorf(tr("%s: el reinicio automático del puerto USB no admite colas de CUPS"), opts.Printer.Path)
+	}
+	return nil
+}
+
+// usbResetServerFlags Añade a relay y serve la opción de reiniciar el puerto
+// USB cuando la impresora deja de aceptar datos y devuelve la función que lo
+// hace con el error del trabajo; sin la opción, o con otro error, no hace nada.
+func usbResetServerFlags(fs *flag.FlagSet) func(device string, err error) {
+	enabled := fs.Bool("usb-reset-on-hang", false, tr("reiniciar el puerto USB de la impresora si deja de aceptar datos y no responde a DLE EOT"))
+	return func(device string, err error) {
+		var hung *printerHungError
+		if *enabled && errors.As(err, &hung) {
+			resetHungPrinter(device)
+		}
+	}
+}
+
+// resetHungPrinter Reinicia el puerto USB de la impresora del nodo device,
+// que puede ser el enlace estable de udev. Una impresora que responde a DLE
+// EOT no está colgada, solo sin papel o con la tapa abierta, y no se
+// reinicia. El trabajo que falló no se repite: con relay el cliente recibe el
+// error y con la cola de serve se reintenta.
+func resetHungPrinter(device string) {
+	if c := readPrinterCondition(device); c != nil {
+		logger.Warn(fmt.Sprintf(tr("La impresora %s responde (%s); no se reinicia su puerto USB"), device, c), "device", device)
+		return
+	}
+	path, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		logger.Error(fmt.Sprintf(tr("No se pudo reiniciar el puerto USB de %s: %v"), device, err), "device", device)
+		return
+	}
+	logger.Warn(fmt.Sprintf(tr("La impresora %s no responde; se reinicia su puerto USB"), device), "device", device)
+	if err := resetUSBDevice(printer{Path: path}); err != nil {
+		logger.Error(fmt.Sprintf(tr("No se pudo reiniciar el puerto USB de %s: %v"), device, err), "device", device)
+		return
+	}
+	logger.Info(tr("✓ Puerto USB reiniciado."), "device", device)
+}
+
+// runUSBReset Implementa el subcomando "usb-reset <impresora>".
+func runUSBReset(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s usb-reset <impresora>\n"), filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr, tr("La impresora puede indicarse por ruta (/dev/usb/lp0), nombre (lp0), puerto USB (1-1.3) o etiqueta."))
+		os.Exit(2)
+	}
+	requireRoot()
+
+	p, err := lookupPrinter(args[0])
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if p.PortPath == "" {
+		log.Fatalf(tr("Error: no se pudo determinar el puerto USB de %s"), p.Path)
+	}
+
+	logger.Info(fmt.Sprintf(tr("Reiniciando el puerto USB de %s...\n"), p))
+	if err := resetUSBDevice(p); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	logger.Info(tr("✓ Puerto USB reiniciado."))
+
+	logger.Info(tr("Esperando a que la impresora vuelva a estar disponible..."))
+	p, err = waitForPrinter(p.PortPath, usbResetTimeout)
+	if err != nil {
+		log.Fatalf(tr("Error: la impresora no respondió después del reinicio: %v"), err)
+	}
+	logger.Info(fmt.Sprintf(tr("✓ Impresora disponible: %s\n"), p))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+)
+
+// userMode Instalación sin root (--user): las unidades van al gestor de
+// systemd del usuario y se manejan con "systemctl --user". El usuario accede
+// a la impresora por pertenecer al grupo del nodo, normalmente lp.
+var userMode bool
+
+// enableUserMode Cambia las rutas de la instalación a las del usuario:
+// ~/.config/systemd/user para las unidades, ~/.local/bin para el programa y
+// ~/.config/escpos-printer para las etiquetas, los certificados TLS y las
+// copias de seguridad.
+func enableUserMode() error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf(tr("error al buscar el directorio personal: %w"), err)
+	}
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if config == "" {
+		config = filepath.Join(home, ".config")
+	}
+	userMode = true
+	unitDir = filepath.Join(config, "systemd", "user")
+	installedBinaryPath = filepath.Join(home, ".local", "bin", "escpos-socket-install")
+	announceServicePath = filepath.Join(unitDir, "escpos-printer-announce.service")
+	announceTimerPath = filepath.Join(unitDir, "escpos-printer-announce.timer")
+	labelsFilePath = filepath.Join(config, "escpos-printer", "labels.conf")
+	tlsDir = filepath.Join(config, "escpos-printer", "tls")
+	backupDir = filepath.Join(config, "escpos-printer", "backups")
+	return nil
+}
+
+// systemctlArgs Devuelve la línea de systemctl para el gestor que corresponde:
+// el del sistema o, con --user, el del usuario.
+func systemctlArgs(args ...string) []string {
+	if userMode {
+		return append([]string{"systemctl", "--user"}, args...)
+	}
+	return append([]string{"systemctl"}, args...)
+}
+
+// systemctlCommand Prepara la ejecución de systemctl en el gestor que corresponde.
+func systemctlCommand(args ...string) *exec.Cmd {
+	cmdArgs := systemctlArgs(args...)
+	return exec.Command(cmdArgs[0], cmdArgs[1:]...)
+}
+
+// checkUserInstall Rechaza lo que el gestor de un usuario no puede hacer:
+// escuchar en puertos privilegiados, filtrar direcciones IP (necesita BPF),
+// cambiar el dueño del socket Unix,
+// crear el enlace estable (la regla udev la escribe root), deshabilitar
+// servicios del sistema y abrir puertos en el firewall.
+func checkUserInstall(opts installOptions) error {
+	switch {
+	case opts.listensTCP() && opts.Port < 1024:
+		return fmt.Errorf(tr("con --user el puerto debe ser 1024 o mayor (se pidió %d)"), opts.Port)
+	case len(opts.AllowFrom) > 0:
+		return errors.New(tr("--allow no está disponible con --user: systemd solo filtra direcciones en los servicios del sistema"))
+	case opts.Printer.Absent:
+		return fmt.Errorf(tr("%s: con --user solo se pueden instalar impresoras conectadas, porque la regla udev necesita root"), opts.Printer.Path)
+	case opts.Unix != nil && (opts.Unix.User != "" || opts.Unix.Group != ""):
+		return errors.New(tr("con --user el socket Unix pertenece al usuario; no se pueden usar --unix-user ni --unix-group"))
+	case opts.TakeOver:
+		return errors.New(tr("--take-over necesita root para deshabilitar servicios del sistema"))
+	case opts.OpenFirewall:
+		return errors.New(tr("--open-firewall necesita root para cambiar las reglas del firewall"))
+	}
+	return nil
+}
+
+// warnLinger Avisa si el usuario no tiene activado el "linger" de systemd:
+// sin él, sus unidades solo funcionan mientras tiene una sesión abierta.
+func warnLinger() {
+	u, err := user.Current()
+	if err != nil {
+		return
+	}
+	if _, err := os.Stat(filepath.Join("/var/lib/systemd/linger", u.Username)); err == nil {
+		return
+	}
+	logger.Warn(fmt.Sprintf(tr("⚠ Los sockets solo funcionarán mientras %s tenga una sesión abierta; para que arranquen con el equipo ejecuta: loginctl enable-linger %s"), u.Username, u.Username))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// verifyUnits Comprueba las unidades del plan con "systemd-analyze verify"
+// antes de escribirlas en unitDir, para que un error en las directivas (por
+// ejemplo en socket_options) se vea al instalar y no cuando el socket no
+// arranca. Las unidades se copian a un directorio temporal con sus nombres
+// definitivos. Sin systemd-analyze no se comprueba nada.
+func (plan installPlan) verifyUnits() error {
+	analyze, err := exec.LookPath("systemd-analyze")
+	if err != nil {
+		logger.Debug(tr("systemd-analyze no está disponible; no se verifican las unidades"))
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "escpos-verify-")
+	if err != nil {
+		return fmt.Errorf(tr("error al crear el directorio temporal: %w"), err)
+	}
+	defer os.RemoveAll(dir)
+
+	// En una simulación el programa aún no está instalado y systemd-analyze
+	// rechazaría el ExecStart=; se comprueba con este mismo ejecutable.
+	binary := installedBinaryPath
+	if _, err := os.Stat(installedBinaryPath); err != nil {
+		if self, err := os.Executable(); err == nil {
+			binary = self
+		}
+	}
+	// También con --user se verifica como unidades del sistema: la sintaxis
+	// es la misma y "systemd-analyze --user" necesita una sesión abierta.
+	args := []string{"verify"}
+	for _, f := range plan.Files {
+		if filepath.Dir(f.Path) != unitDir {
+			continue // Reglas udev, servicios de Avahi...
+		}
+		switch filepath.Ext(f.Path) {
+		case ".socket", ".service", ".timer":
+		default:
+			continue
+		}
+		path := filepath.Join(dir, filepath.Base(f.Path))
+		content := strings.ReplaceAll(f.Content, installedBinaryPath, binary)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf(tr("error al escribir el archivo de %s: %w"), tr(f.Kind), err)
+		}
+		args = append(args, path)
+	}
+	if len(args) == 1 {
+		return nil
+	}
+
+	out, err := exec.Command(analyze, args...).CombinedOutput()
+	// systemd-analyze solo termina con error en los fallos graves; las claves
+	// desconocidas o los valores que no entiende se ignoran con un aviso, así
+	// que también cuentan los avisos sobre nuestros archivos.
+	var problems []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" && (err != nil || strings.HasPrefix(line, dir)) {
+			problems = append(problems, strings.ReplaceAll(line, dir+"/", ""))
+		}
+	}
+	if len(problems) == 0 && err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return fmt.Errorf(tr("error al ejecutar systemd-analyze: %w"), err)
+		}
+		problems = append(problems, err.Error())
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf(tr("las unidades generadas no son válidas:\n%s"), strings.Join(problems, "\n"))
+	}
+	logger.Info(tr("✓ Unidades verificadas con systemd-analyze.\n"))
+	return nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// websocketGUID Valor fijo con el que se calcula Sec-WebSocket-Accept (RFC 6455).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxWebSocketMessage Tamaño máximo de un mensaje: cada mensaje es un trabajo
+// y se reúne entero antes de imprimirlo.
+const maxWebSocketMessage = 4 << 20
+
+// maxWebSocketControl Bytes de una trama de control (cierre, ping o pong).
+const maxWebSocketControl = 125
+
+// maxWebSocketCloseReason Bytes del motivo de una trama de cierre: el código
+// ocupa dos de los de la trama de control.
+const maxWebSocketCloseReason = maxWebSocketControl - 2
+
+// Códigos de cierre de WebSocket (RFC 6455, 7.4.1).
+const (
+	wsCloseGoingAway     = 1001
+	wsCloseProtocolError = 1002
+	wsCloseInvalidData   = 1007
+	wsCloseTooBig        = 1009
+)
+
+// wsCloseError Error de la conexión que se le comunica al cliente con el
+// código de cierre code.
+type wsCloseError struct {
+	code uint16
+	err  error
+}
+
+func (e *wsCloseError) Error() string { return e.err.Error() }
+
+// wsProtocolError Devuelve un error de protocolo de la trama o el mensaje.
+func wsProtocolError(err error) error {
+	return &wsCloseError{wsCloseProtocolError, err}
+}
+
+// wsTakenError Error del saludo cuando la conexión ya se tomó del servidor
+// HTTP: no se puede contestar con un error HTTP.
+type wsTakenError struct{ err error }
+
+func (e *wsTakenError) Error() string {
+	return fmt.Sprintf(tr("no se pudo completar el saludo de WebSocket: %v"), e.err)
+}
+
+// Códigos de operación de las tramas WebSocket.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// wsConn Conexión WebSocket del lado del servidor.
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	idle time.Duration // Espera máxima de cada trama del cliente, 0 sin límite
+}
+
+// upgradeWebSocket Completa el saludo de WebSocket y toma la conexión del
+// servidor HTTP. Si falla después de tomarla la cierra y devuelve un
+// *wsTakenError.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, idle time.Duration) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		return nil, errors.New(tr("la petición no es un saludo de WebSocket"))
+	}
+	if v := r.Header.Get("Sec-WebSocket-Version"); v != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, fmt.Errorf(tr("versión de WebSocket no admitida %q"), v)
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New(tr("el servidor no permite tomar la conexión"))
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// Los plazos del servidor HTTP ya no se aplican a la conexión tomada.
+	conn.SetDeadline(time.Time{})
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, &wsTakenError{err}
+	}
+	return &wsConn{conn: conn, br: rw.Reader, idle: idle}, nil
+}
+
+// readFrame Lee una trama del cliente y le quita la máscara. La espera de
+// cada trama se limita a idle, como la de los datos en el resto de la API.
+// Rechaza los bits reservados, que ninguna extensión negociada usa, y las
+// tramas de control fragmentadas o de más de maxWebSocketControl bytes.
+func (c *wsConn) readFrame(limit int) (fin bool, opcode byte, payload []byte, err error) {
+	if c.idle > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.idle))
+	}
+	var head [2]byte
+	if _, err = io.ReadFull(c.br, head[:]); err != nil {
+		return
+	}
+	fin, opcode = head[0]&0x80 != 0, head[0]&0x0F
+	if rsv := head[0] & 0x70; rsv != 0 {
+		return fin, opcode, nil, wsProtocolError(fmt.Errorf(tr("trama WebSocket con bits reservados %#x"), rsv))
+	}
+	if head[1]&0x80 == 0 {
+		return fin, opcode, nil, wsProtocolError(errors.New(tr("la trama del cliente no tiene máscara")))
+	}
+	control := opcode&0x8 != 0
+	if control && !fin {
+		return fin, opcode, nil, wsProtocolError(errors.New(tr("trama de control WebSocket fragmentada")))
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext uint16
+		err = binary.Read(c.br, binary.BigEndian, &ext)
+		n = uint64(ext)
+	case 127:
+		err = binary.Read(c.br, binary.BigEndian, &n)
+	}
+	if err != nil {
+		return
+	}
+	if control && n > maxWebSocketControl {
+		return fin, opcode, nil, wsProtocolError(fmt.Errorf(tr("la trama de control WebSocket supera %d bytes"), maxWebSocketControl))
+	}
+	if !control && n > uint64(limit) {
+		return fin, opcode, nil, &wsCloseError{wsCloseTooBig, fmt.Errorf(tr("el mensaje supera %d bytes"), maxWebSocketMessage)}
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// readMessage Lee un mensaje completo, uniendo sus fragmentos y contestando
+// los ping que lleguen entre medias. Devuelve io.EOF cuando el cliente cierra.
+// Los mensajes de texto tienen que ser UTF-8 válido.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var msg bytes.Buffer
+	var kind byte // wsText o wsBinary una vez empezado el mensaje
+	for {
+		fin, opcode, payload, err := c.readFrame(maxWebSocketMessage - msg.Len())
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.writeFrame(wsClose, payload)
+			return nil, io.EOF
+		case wsText, wsBinary:
+			if kind != 0 {
+				return nil, wsProtocolError(errors.New(tr("mensaje WebSocket nuevo antes de terminar el anterior")))
+			}
+			kind = opcode
+		case wsContinuation:
+			if kind == 0 {
+				return nil, wsProtocolError(errors.New(tr("fragmento WebSocket sin mensaje")))
+			}
+		default:
+			return nil, wsProtocolError(fmt.Errorf(tr("trama WebSocket desconocida %#x"), opcode))
+		}
+		msg.Write(payload)
+		if fin {
+			if kind == wsText && !utf8.Valid(msg.Bytes()) {
+				return nil, &wsCloseError{wsCloseInvalidData, errors.New(tr("el mensaje de texto WebSocket no es UTF-8 válido"))}
+			}
+			return msg.Bytes(), nil
+		}
+	}
+}
+
+// writeFrame Envía una trama sin fragmentar; las del servidor no llevan máscara.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	head := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		head = append(head, byte(n))
+	case n <= 0xFFFF:
+		head = append(head, 126)
+		head = binary.BigEndian.AppendUint16(head, uint16(n))
+	default:
+		head = append(head, 127)
+		head = binary.BigEndian.AppendUint64(head, uint64(n))
+	}
+	_, err := c.conn.Write(append(head, payload...))
+	return err
+}
+
+// closeWith Cierra la conexión indicando el código y el motivo al cliente.
+// El motivo se recorta a maxWebSocketCloseReason sin partir un carácter.
+func (c *wsConn) closeWith(code uint16, reason string) {
+	if len(reason) > maxWebSocketCloseReason {
+		reason = reason[:maxWebSocketCloseReason]
+		for !utf8.ValidString(reason) {
+			reason = reason[:len(reason)-1]
+		}
+	}
+	c.writeFrame(wsClose, append(binary.BigEndian.AppendUint16(nil, code), reason...))
+	c.conn.Close()
+}
+
+// serveWebSocket Atiende GET /printers/{name}/ws: cada mensaje, de texto o
+// binario, es un trabajo que se pasa tal cual a la impresora. Después de
+// imprimirlo se contesta con un mensaje de texto con el trabajo en JSON, el
+// mismo que devuelve POST /printers/{name}/jobs.
+func (s *apiServer) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.checkPrinter(w, r) {
+		return
+	}
+	ws, err := upgradeWebSocket(w, r, s.idleTimeout)
+	if taken := (*wsTakenError)(nil); errors.As(err, &taken) {
+		logger.Warn(fmt.Sprintf(tr("Error en la conexión WebSocket de %s: %v"), apiClient(r), err), "client", apiClient(r))
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	client := apiClient(r)
+	logger.Debug(fmt.Sprintf(tr("Conexión WebSocket de %s"), client), "client", client)
+	for {
+		msg, err := ws.readMessage()
+		if err == io.EOF {
+			ws.conn.Close()
+			return
+		}
+		if err != nil {
+			logger.Warn(fmt.Sprintf(tr("Error en la conexión WebSocket de %s: %v"), client, err), "client", client)
+			code := uint16(wsCloseProtocolError)
+			if closeErr := (*wsCloseError)(nil); errors.As(err, &closeErr) {
+				code = closeErr.code
+			} else if errors.Is(err, os.ErrDeadlineExceeded) {
+				code = wsCloseGoingAway // El servidor deja la conexión
+			}
+			ws.closeWith(code, err.Error())
+			return
+		}
+		job := s.print(bytes.NewReader(msg), r)
+		reply, _ := json.Marshal(job)
+		if err := ws.writeFrame(wsText, reply); err != nil {
+			ws.conn.Close()
+			return
+		}
+	}
+}
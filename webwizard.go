@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// wizardTemplate Página única del asistente: formulario, resultado o error.
+// Los textos pasan por tr al generar la página, con el idioma de --lang.
+var wizardTemplate = template.Must(template.New("wizard").Funcs(template.FuncMap{"tr": tr}).Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{tr "Configuración de impresora ESC/POS"}}</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 2em auto; padding: 0 1em; }
+label { display: block; margin: .6em 0; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>{{tr "Configuración de impresora ESC/POS"}}</h1>
+{{if .Done}}
+<p>{{printf (tr "✓ Configuración completa. La máquina está lista para aceptar trabajos de impresión en %s.") .Listen}}</p>
+{{else}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .Printers}}
+<form method="post" action="/">
+<input type="hidden" name="token" value="{{.Token}}">
+<fieldset>
+<legend>{{tr "Impresora"}}</legend>
+{{range $i, $p := .Printers}}
+<label><input type="radio" name="printer" value="{{$i}}"{{if eq $i 0}} checked{{end}}> {{$p}}</label>
+{{end}}
+</fieldset>
+<label>{{tr "Nombre (por ejemplo \"caja izquierda\"):"}} <input type="text" name="label"></label>
+<label>{{tr "Puerto TCP:"}} <input type="number" name="port" min="1" max="65535" value="{{.Port}}"></label>
+<label>{{tr "Escuchar en la dirección:"}} <input type="text" name="bind" value="{{.Bind}}"> {{tr "(0.0.0.0 para todas las interfaces)"}}</label>
+<label><input type="checkbox" name="announce" value="1"> {{tr "Imprimir la IP de la máquina en cada arranque"}}</label>
+<fieldset>
+<legend>{{tr "Seguridad"}}</legend>
+<label>{{tr "Redes que pueden imprimir, separadas por comas (vacío para todas):"}} <input type="text" name="allow" placeholder="192.168.1.0/24"></label>
+<label><input type="checkbox" name="tls" value="1"> {{tr "Cifrar el socket con TLS (certificado autofirmado)"}}</label>
+<label><input type="checkbox" name="http_api" value="1"> {{tr "Atender también la API HTTP"}}</label>
+<label>{{tr "Archivo con las claves de la API HTTP (vacío para no pedir clave):"}} <input type="text" name="http_api_keys" placeholder="/etc/escpos-printer/api-keys"></label>
+</fieldset>
+<button type="submit">{{tr "Instalar"}}</button>
+</form>
+{{else}}
+<p class="error">{{tr "No se encontraron impresoras USB en /dev/usb/lpX. Conecta la impresora y recarga la página."}}</p>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// wizardPage Datos que se muestran en la página del asistente.
+type wizardPage struct {
+	Lang     string
+	Token    string // Se devuelve con el formulario; véase wizardHandler
+	Printers []printer
+	Port     int
+	Bind     string
+	Listen   string // Dirección final del socket, cuando la instalación termina
+	Error    string
+	Done     bool
+}
+
+// newWizardToken Devuelve el token aleatorio de la URL del asistente.
+func newWizardToken() string {
+	var token [16]byte
+	rand.Read(token[:])
+	return hex.EncodeToString(token[:])
+}
+
+// wizardHandler Atiende el formulario del asistente. Solo responde a quien
+// conoce token, que va en la URL que se muestra al arrancar y en el
+// formulario: cualquiera en la red podría instalar como root, o una página
+// ajena enviar el formulario desde el navegador del usuario. Cuando la
+// instalación termina correctamente avisa por done para que el servidor se
+// detenga.
+func wizardHandler(token string, done chan<- struct{}) http.HandlerFunc {
+	var mu sync.Mutex
+	finished := "" // Dirección del socket instalado; vacía mientras no se instala
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		given := r.URL.Query().Get("token")
+		if r.Method == http.MethodPost {
+			given = r.PostFormValue("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, tr("Falta el token del asistente o no es válido: abre la dirección que se mostró al iniciar setup-web."), http.StatusForbidden)
+			return
+		}
+
+		printers, err := discoverPrinters()
+		page := wizardPage{Lang: language, Token: token, Printers: printers, Port: defaultPort, Bind: defaultBind}
+		if err != nil {
+			page.Error = err.Error()
+		}
+
+		// Las instalaciones se serializan: dos navegadores no deben escribir
+		// las unidades a la vez, y una vez terminada no se repite.
+		mu.Lock()
+		if finished != "" {
+			page.Done = true
+			page.Listen = finished
+		} else if r.Method == http.MethodPost && err == nil {
+			if listen, err := applyWizardForm(r, printers); err != nil {
+				page.Error = err.Error()
+			} else {
+				page.Done = true
+				page.Listen = listen
+				finished = listen
+				close(done)
+			}
+		}
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Frame-Options", "DENY")
+		if err := wizardTemplate.Execute(w, page); err != nil {
+			log.Printf(tr("Error al generar la página del asistente: %v"), err)
+		}
+	}
+}
+
+// applyWizardForm Valida el formulario del asistente y ejecuta la instalación.
+// Devuelve la dirección en la que quedó escuchando el socket.
+func applyWizardForm(r *http.Request, printers []printer) (string, error) {
+	i, err := strconv.Atoi(r.FormValue("printer"))
+	if err != nil || i < 0 || i >= len(printers) {
+		return "", errors.New(tr("selecciona una impresora de la lista"))
+	}
+	port, err := strconv.Atoi(r.FormValue("port"))
+	if err != nil || port < 1 || port > 65535 {
+		return "", fmt.Errorf(tr("puerto inválido %q"), r.FormValue("port"))
+	}
+	bind := r.FormValue("bind")
+	if net.ParseIP(bind) == nil {
+		return "", fmt.Errorf(tr("dirección inválida %q"), bind)
+	}
+
+	p := printers[i]
+	if label := r.FormValue("label"); label != "" {
+		if err := setLabel(&p, label); err != nil {
+			return "", err
+		}
+	}
+
+	var allowFrom []string
+	if allow := r.FormValue("allow"); allow != "" {
+		allowFrom = strings.Split(allow, ",")
+	}
+	if err := validateAllowList(allowFrom); err != nil {
+		return "", err
+	}
+	var api *httpSettings
+	keys := r.FormValue("http_api_keys")
+	switch {
+	case r.FormValue("http_api") == "1":
+		api = &httpSettings{KeysFile: keys}
+		if err := api.validate(); err != nil {
+			return "", err
+		}
+	case keys != "":
+		return "", errors.New(tr("el archivo de claves necesita la API HTTP"))
+	}
+	var tlsOptions *tlsSettings
+	if r.FormValue("tls") == "1" {
+		tlsOptions = &tlsSettings{}
+	}
+
+	list := []installOptions{{
+		Printer:   p,
+		Port:      port,
+		Bind:      bind,
+		Serial:    defaultSerial(p),
+		AllowFrom: allowFrom,
+		HTTP:      api,
+		TLS:       tlsOptions,
+	}}
+	// Con --force puede haber otra impresora instalada: no se tocan sus unidades.
+	assignUnitNames(list)
+	return list[0].listenAddr(), installAll(list, r.FormValue("announce") == "1", false)
+}
+
+// runSetupWeb Implementa el subcomando "setup-web", que sirve un asistente de
+// configuración en el navegador para las máquinas que aún no están configuradas.
+func runSetupWeb(args []string) {
+	fs := flag.NewFlagSet("setup-web", flag.ExitOnError)
+	listen := fs.String("listen", ":8080", tr("dirección en la que escucha el asistente"))
+	force := fs.Bool("force", false, tr("servir el asistente aunque la máquina ya esté configurada"))
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, tr("Uso: %s setup-web [--listen DIRECCIÓN] [--force]\n"), filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	requireRoot()
+
+	if installs, _ := readInstallations(); len(installs) > 0 && !*force {
+		log.Fatalf(tr("Error: la máquina ya está configurada (%s existe). Usa --force para volver a configurarla."), socketUnitPath(installs[0].Name))
+	}
+
+	token := newWizardToken()
+	done := make(chan struct{})
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           wizardHandler(token, done),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-done
+		// Da tiempo a que el navegador reciba la página de confirmación.
+		time.Sleep(time.Second)
+		srv.Shutdown(context.Background())
+	}()
+
+	logger.Info(tr("Asistente de configuración disponible en:"))
+	host, port, err := net.SplitHostPort(*listen)
+	if err != nil {
+		log.Fatalf(tr("Error: dirección inválida %q: %v"), *listen, err)
+	}
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		logger.Info(fmt.Sprintf("  http://%s/?token=%s\n", *listen, token))
+	} else if ips, err := hostIPv4s(); err == nil {
+		for _, ip := range ips {
+			logger.Info(fmt.Sprintf("  http://%s/?token=%s\n", net.JoinHostPort(ip.String(), port), token))
+		}
+	}
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Error: %v", err)
+	}
+	logger.Info(tr("\n🎉 ¡Configuración completa desde el asistente web!"))
+}